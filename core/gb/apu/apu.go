@@ -16,6 +16,9 @@ type APU struct {
 	samples     [560 * 2]int16 // [[left, right]...], 549 = 32768 / 59.7275
 	sampleCount uint16
 	Mask        uint8
+	Mute        bool // 生成したサンプルを捨てる (巻き戻し中など)
+
+	External func() int16 // カートリッジのスピーカー (HuC3のブザー) 音量は NR50 に関係なくそのまま足す
 }
 
 func New(audioBuffer io.Writer) *APU {
@@ -49,6 +52,10 @@ func (a *APU) Run(cycles8MHz int64) {
 				lvolume, rvolume := a.PSG.Volume()
 				lsample, rsample := (int(left)*512)-16384, (int(right)*512)-16384
 				lsample, rsample = (lsample*int(lvolume+1))/8, (rsample*int(rvolume+1))/8
+				if a.External != nil {
+					ext := int(a.External())
+					lsample, rsample = lsample+ext, rsample+ext
+				}
 				a.samples[a.sampleCount*2] = int16(lsample) / 2
 				a.samples[a.sampleCount*2+1] = int16(rsample) / 2
 				a.sampleCount++
@@ -58,6 +65,10 @@ func (a *APU) Run(cycles8MHz int64) {
 }
 
 func (a *APU) FlushSamples() {
+	if a.Mute {
+		a.sampleCount = 0
+		return
+	}
 	binary.Write(a.sampleWriter, binary.LittleEndian, a.samples[:a.sampleCount*2])
 	a.sampleCount = 0
 }
@@ -0,0 +1,257 @@
+package cartridge
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+/*
+Pocket Camera (Game Boy Camera) は MAC-GBD と M64282FP イメージセンサーを持つ
+
+	0000..1FFF: 0x0A を書くとRAMへの書き込みを有効化 (読み込みはいつでもできる)
+	2000..3FFF: ROMバンク (0..63)
+	4000..5FFF: 0x00..0x0F ならRAMバンク、bit4 が立っていればセンサーのレジスタ
+	A000..A035: レジスタ (A000 以外は書き込み専用で 0x00 が読める)
+		A000: bit0 撮影開始/撮影中
+		A001: bit7 N, bit5-6 VH(エッジ強調の方向), bit0-4 ゲイン
+		A002, A003: 露光時間 (ビッグエンディアン)
+		A004: bit4-6 エッジ強調の強さ, bit3 反転, bit0-2 基準電圧
+		A005: ゼロ点
+		A006..A035: 4x4のディザリング行列 (1マスに3つのしきい値)
+
+撮影した画像は128x112ピクセル(16x14タイル)の2bppで、RAMバンク0の A100..AEFF に書き込まれる
+*/
+
+const (
+	cameraRAMSize       = 128 * 1024
+	cameraWidth         = 128
+	cameraHeight        = 112
+	cameraImageOffset   = 0x100
+	cameraRegisterCount = 0x36
+)
+
+// エッジ強調の強さ (A004 の bit4-6)
+var cameraEdgeRatios = [8]float64{0.5, 0.75, 1, 1.25, 2, 3, 4, 5}
+
+type PocketCamera struct {
+	c          *Cartridge
+	RAMEnabled bool
+	ROMBank    uint8
+	RAMBank    uint8 // bit4 が立っていればレジスタ
+	Registers  [cameraRegisterCount]uint8
+	Busy       int64 // 撮影が終わるまでの残りマスターサイクル数
+
+	pattern TestPattern // Cartridge.Camera が nil のときに使う
+}
+
+func newPocketCamera(c *Cartridge) *PocketCamera {
+	if len(c.RAM) < cameraRAMSize {
+		c.RAM = make([]uint8, cameraRAMSize)
+	}
+	return &PocketCamera{
+		c:       c,
+		ROMBank: 1,
+	}
+}
+
+func (m *PocketCamera) reset() {
+	m.RAMEnabled = false
+	m.ROMBank, m.RAMBank = 1, 0
+	clear(m.Registers[:])
+	m.Busy = 0
+}
+
+func (m *PocketCamera) read(addr uint16) uint8 {
+	switch addr >> 12 {
+	case 0x0, 0x1, 0x2, 0x3:
+		return m.c.ROM[addr]
+	case 0x4, 0x5, 0x6, 0x7:
+		n := (int(m.ROMBank) << 14) | int(addr&0x3FFF)
+		return m.c.ROM[n%len(m.c.ROM)]
+	case 0xA, 0xB:
+		if m.RAMBank&0x10 != 0 {
+			if addr&0x7F == 0 {
+				return m.Registers[0] & 0x07
+			}
+			return 0x00
+		}
+		if m.Busy > 0 {
+			return 0x00 // 撮影中はRAMが読めない
+		}
+		return m.c.RAM[(int(m.RAMBank&0x0F)<<13)|int(addr&0x1FFF)]
+	}
+	return 0xFF
+}
+
+func (m *PocketCamera) write(addr uint16, val uint8) {
+	switch addr >> 12 {
+	case 0x0, 0x1:
+		m.RAMEnabled = val&0x0F == 0x0A
+	case 0x2, 0x3:
+		m.ROMBank = val & 0x3F
+	case 0x4, 0x5:
+		m.RAMBank = val & 0x1F
+	case 0xA, 0xB:
+		if m.RAMBank&0x10 != 0 {
+			m.writeRegister(uint8(addr&0x7F), val)
+			return
+		}
+		if m.RAMEnabled && m.Busy == 0 {
+			m.c.RAM[(int(m.RAMBank&0x0F)<<13)|int(addr&0x1FFF)] = val
+		}
+	}
+}
+
+func (m *PocketCamera) writeRegister(reg uint8, val uint8) {
+	if int(reg) >= len(m.Registers) {
+		return
+	}
+	if reg != 0 {
+		m.Registers[reg] = val
+		return
+	}
+
+	m.Registers[0] = val & 0x07
+	switch {
+	case val&0x01 != 0 && m.Busy == 0:
+		m.Busy = m.captureCycles()
+	case val&0x01 == 0:
+		m.Busy = 0 // 撮影を止める
+	}
+}
+
+// 撮影にかかる時間 (CPUサイクルで 32446 + N ? 0 : 512 + 16 * 露光時間)
+func (m *PocketCamera) captureCycles() int64 {
+	cycles := 32446 + 16*int64(m.exposure())
+	if m.Registers[1]&0x80 == 0 {
+		cycles += 512
+	}
+	return cycles * 8
+}
+
+func (m *PocketCamera) exposure() uint16 {
+	return uint16(m.Registers[2])<<8 | uint16(m.Registers[3])
+}
+
+func (m *PocketCamera) run(cycles8MHz int64) {
+	if m.Busy <= 0 {
+		return
+	}
+	m.Busy -= cycles8MHz
+	if m.Busy <= 0 {
+		m.Busy = 0
+		m.Registers[0] &^= 0x01
+		m.capture()
+	}
+}
+
+// センサーの出力を、ディザリング行列で4色にしてRAMに書き込む
+// 実際のセンサーのアナログ回路を真似たものではなく、露光時間とゲインに比例して明るくなるだけ (反転、基準電圧、ゼロ点は無視する)
+func (m *PocketCamera) capture() {
+	var src CameraImage = &m.pattern
+	if m.c.Camera != nil {
+		src = m.c.Camera
+	}
+	img := src.Image()
+
+	var light [cameraWidth * cameraHeight]float64
+	scale := float64(m.exposure()) / 0x0800 * cameraGain(m.Registers[1]&0x1F)
+	for i := range light {
+		light[i] = sample(img, i%cameraWidth, i/cameraWidth) * scale
+	}
+
+	ratio := cameraEdgeRatios[(m.Registers[4]>>4)&0x07]
+	vh := (m.Registers[1] >> 5) & 0x03
+	at := func(x, y int) float64 { // 端では外側に同じ明るさが続いているとする
+		x, y = min(max(x, 0), cameraWidth-1), min(max(y, 0), cameraHeight-1)
+		return light[y*cameraWidth+x]
+	}
+	for y := range cameraHeight {
+		for x := range cameraWidth {
+			v := light[y*cameraWidth+x]
+			if vh&0x01 != 0 { // 縦方向
+				v += (2*v - at(x, y-1) - at(x, y+1)) * ratio
+			}
+			if vh&0x02 != 0 { // 横方向
+				v += (2*v - at(x-1, y) - at(x+1, y)) * ratio
+			}
+			m.setPixel(x, y, m.dither(x, y, uint8(min(max(v*255, 0), 255))))
+		}
+	}
+}
+
+// ゲイン(0..31)は 14dB から 1.5dB ずつ大きくなる 0x08 (26dB) を1倍とする
+func cameraGain(gain uint8) float64 {
+	return math.Pow(10, (float64(gain)*1.5-12)/20)
+}
+
+// 明るいほど白(0)になる
+func (m *PocketCamera) dither(x, y int, v uint8) uint8 {
+	t := m.Registers[6+((y&3)*4+(x&3))*3:]
+	switch {
+	case v < t[0]:
+		return 3
+	case v < t[1]:
+		return 2
+	case v < t[2]:
+		return 1
+	}
+	return 0
+}
+
+func (m *PocketCamera) setPixel(x, y int, c uint8) {
+	n := cameraImageOffset + ((y/8)*(cameraWidth/8)+x/8)*16 + (y%8)*2
+	bit := uint8(0x80) >> (x % 8)
+	for plane := range 2 {
+		if c&(1<<plane) != 0 {
+			m.c.RAM[n+plane] |= bit
+		} else {
+			m.c.RAM[n+plane] &^= bit
+		}
+	}
+}
+
+// 画像を 128x112 に拡大縮小したときの (x, y) の明るさ (0..1)
+func sample(img image.Image, x, y int) float64 {
+	if img == nil {
+		return 0
+	}
+	b := img.Bounds()
+	if b.Empty() {
+		return 0
+	}
+	px := b.Min.X + (2*x+1)*b.Dx()/(2*cameraWidth)
+	py := b.Min.Y + (2*y+1)*b.Dy()/(2*cameraHeight)
+	return float64(color.GrayModel.Convert(img.At(px, py)).(color.Gray).Y) / 255
+}
+
+type PocketCameraSnapshot struct {
+	Header     uint64
+	RAMEnabled bool
+	ROMBank    uint8
+	RAMBank    uint8
+	Registers  [cameraRegisterCount]uint8
+	Busy       int64
+}
+
+func (m *PocketCamera) CreateSnapshot() PocketCameraSnapshot {
+	return PocketCameraSnapshot{
+		RAMEnabled: m.RAMEnabled,
+		ROMBank:    m.ROMBank,
+		RAMBank:    m.RAMBank,
+		Registers:  m.Registers,
+		Busy:       m.Busy,
+	}
+}
+
+func (m *PocketCamera) RestoreSnapshot(snap *PocketCameraSnapshot) error {
+	if snap == nil {
+		return errSnapshotNil
+	}
+	m.RAMEnabled = snap.RAMEnabled
+	m.ROMBank, m.RAMBank = snap.ROMBank, snap.RAMBank
+	m.Registers = snap.Registers
+	m.Busy = snap.Busy
+	return nil
+}
@@ -0,0 +1,58 @@
+package cartridge
+
+import (
+	"image"
+	"image/color"
+)
+
+// CameraImage is what the image sensor of Pocket Camera sees.
+//
+// Image is called every time the game takes a picture, which is several times a second in the viewfinder.
+// The image is scaled to 128x112 and converted to grayscale.
+type CameraImage interface {
+	Image() image.Image
+}
+
+// StillImage always shows Picture. (e.g. a PNG file)
+type StillImage struct {
+	Picture image.Image
+}
+
+func (s *StillImage) Image() image.Image { return s.Picture }
+
+// ImageSequence shows Images one by one for each picture taken, and loops.
+type ImageSequence struct {
+	Images []image.Image
+	next   int
+}
+
+func (s *ImageSequence) Image() image.Image {
+	if len(s.Images) == 0 {
+		return nil
+	}
+	img := s.Images[s.next%len(s.Images)]
+	s.next = (s.next + 1) % len(s.Images)
+	return img
+}
+
+// TestPattern is a generated gradient with a square moving a little for each picture taken.
+// It is used when Cartridge.Camera is nil.
+type TestPattern struct {
+	n int
+}
+
+func (p *TestPattern) Image() image.Image {
+	img := image.NewGray(image.Rect(0, 0, cameraWidth, cameraHeight))
+	sx, sy := 16+p.n%(cameraWidth-48), 32
+	for y := range cameraHeight {
+		for x := range cameraWidth {
+			v := uint8(x * 255 / (cameraWidth - 1)) // 左から右に明るくなる
+			if x >= sx && x < sx+32 && y >= sy && y < sy+32 {
+				v = 255 - v
+			}
+			img.SetGray(x, y, color.Gray{v})
+		}
+	}
+	p.n++
+	return img
+}
@@ -2,59 +2,106 @@ package cartridge
 
 import (
 	"fmt"
+	"hash/crc32"
 )
 
 const KB, MB = 1024, 1024 * 1024
 
 type MBC interface {
+	reset()
 	read(addr uint16) uint8
 	write(addr uint16, val uint8)
 }
 
 type Cartridge struct {
-	ROM []uint8
-	RAM []uint8 // SRAM
-	MBC         // mapper
+	Header Header
+	ROM    []uint8
+	RAM    []uint8 // SRAM
+	MBC            // mapper
+	CRC32  uint32  // ROMファイルのCRC32 (セーブステートが同じROMのものか確認するため)
+	Clock  Clock   // RTCが追いつく現実の時刻 (nil なら time.Now)
+	motor  rumbleMBC
+	rumble rumble
+	rtc    clockChip  // 時計(MBC3のRTC, HuC3)がなければ nil
+	tilt   [2]float64 // 加速度センサー(MBC7)が読む値 (G)
+	camera *PocketCamera
+	buzzer buzzerMBC
+
+	Camera CameraImage      // Pocket Camera のセンサーに映る画像 (nil ならテストパターン)
+	IR     IRPort           // HuC1, HuC3 の赤外線LEDと受光部 (nil なら何もつながっていない)
+	OnTone func(tone uint8) // HuC3 のブザーが鳴り始めたときに呼ばれる (音は Sample で出力される)
 }
 
 func New(rom []uint8) (*Cartridge, error) {
+	h, err := ParseHeader(rom)
+	if err != nil {
+		return nil, err
+	}
 	c := &Cartridge{
-		RAM: make([]uint8, 0),
+		Header: *h,
+		RAM:    make([]uint8, 0),
+		CRC32:  crc32.ChecksumIEEE(rom),
 	}
 
-	c.ROM = make([]uint8, calcROMSize(rom[0x148]))
+	c.ROM = make([]uint8, h.ROMSize)
 	copy(c.ROM, rom)
 
-	c.RAM = make([]uint8, calcSRAMSize(rom[0x149])) // これはSRAMチップのサイズであって、MBC2のようなMBCチップにRAMが内蔵されている場合は0になるっぽい
+	c.RAM = make([]uint8, h.RAMSize) // これはSRAMチップのサイズであって、MBC2のようなMBCチップにRAMが内蔵されている場合は0になるっぽい
 
 	mbc, err := createMBC(c)
 	if err != nil {
 		return nil, err
 	}
 	c.MBC = mbc
+	if m, ok := mbc.(rtcMBC); ok {
+		c.rtc = m.rtc()
+	}
+	if m, ok := mbc.(rumbleMBC); ok && h.HasRumble {
+		c.motor = m
+	}
+	if m, ok := mbc.(*PocketCamera); ok {
+		c.camera = m
+	}
+	if m, ok := mbc.(buzzerMBC); ok {
+		c.buzzer = m
+	}
 
 	return c, nil
 }
 
 func createMBC(c *Cartridge) (MBC, error) {
-	mbcType := c.ROM[0x147]
-	switch mbcType {
-	case 0:
+	switch c.Header.Mapper {
+	case MAPPER_NONE:
 		return newMBC0(c), nil
-	case 1, 2, 3:
+	case MAPPER_MBC1:
 		return newMBC1(c), nil
-	case 5, 6:
+	case MAPPER_MBC2:
 		c.RAM = make([]uint8, 512)
 		return newMBC2(c), nil
-	case 16, 19:
+	case MAPPER_MBC3:
 		return newMBC3(c), nil
-	case 25, 26, 27:
+	case MAPPER_MBC5:
 		return newMBC5(c), nil
+	case MAPPER_MBC6:
+		return newMBC6(c), nil
+	case MAPPER_MBC7:
+		return newMBC7(c), nil
+	case MAPPER_CAMERA:
+		return newPocketCamera(c), nil
+	case MAPPER_HUC1:
+		return newHuC1(c), nil
+	case MAPPER_HUC3:
+		return newHuC3(c), nil
 	default:
-		return nil, fmt.Errorf("unsupported mbc type: 0x%02X", mbcType)
+		return nil, fmt.Errorf("unsupported mbc type: 0x%02X (%s)", c.Header.Type, c.Header.Mapper)
 	}
 }
 
+// Reset resets the mapper registers. SRAM and RTC are kept as they are battery-backed.
+func (c *Cartridge) Reset() {
+	c.MBC.reset()
+}
+
 func (c *Cartridge) Read(addr uint16) uint8 {
 	return c.MBC.read(addr)
 }
@@ -63,8 +110,9 @@ func (c *Cartridge) Write(addr uint16, val uint8) {
 	c.MBC.write(addr, val)
 }
 
+// CGBFlag returns the CGB flag of the header. (0x143)
 func (c *Cartridge) CGBFlag() uint8 {
-	return c.ROM[0x143]
+	return c.Header.CGBFlag
 }
 
 func (c *Cartridge) LoadSRAM(data []uint8) error {
@@ -95,6 +143,8 @@ func (c *Cartridge) ROMBankNumber() uint16 {
 		return uint16(mbc.ROMBank)
 	case *MBC5:
 		return mbc.ROMBank
+	case *MBC6:
+		return uint16(mbc.ROMBank[0])
 	}
 	return 1
 }
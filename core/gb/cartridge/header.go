@@ -0,0 +1,200 @@
+package cartridge
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrHeaderChecksum = errors.New("header checksum mismatch")
+	ErrGlobalChecksum = errors.New("global checksum mismatch")
+)
+
+// Mapper is the kind of the memory bank controller.
+type Mapper uint8
+
+const (
+	MAPPER_NONE Mapper = iota // ROM only (and optionally RAM)
+	MAPPER_MBC1
+	MAPPER_MBC2
+	MAPPER_MBC3
+	MAPPER_MBC5
+	MAPPER_MBC6
+	MAPPER_MBC7
+	MAPPER_MMM01
+	MAPPER_CAMERA // Pocket Camera
+	MAPPER_TAMA5
+	MAPPER_HUC1
+	MAPPER_HUC3
+	MAPPER_UNKNOWN
+)
+
+var mapperNames = [...]string{"ROM", "MBC1", "MBC2", "MBC3", "MBC5", "MBC6", "MBC7", "MMM01", "POCKET CAMERA", "TAMA5", "HuC1", "HuC3", "UNKNOWN"}
+
+func (m Mapper) String() string {
+	if int(m) < len(mapperNames) {
+		return mapperNames[m]
+	}
+	return mapperNames[MAPPER_UNKNOWN]
+}
+
+// カートリッジの種類(0x147)ごとの構成
+var cartTypes = map[uint8]struct {
+	mapper                              Mapper
+	ram, battery, timer, rumble, sensor bool
+}{
+	0x00: {mapper: MAPPER_NONE},
+	0x01: {mapper: MAPPER_MBC1},
+	0x02: {mapper: MAPPER_MBC1, ram: true},
+	0x03: {mapper: MAPPER_MBC1, ram: true, battery: true},
+	0x05: {mapper: MAPPER_MBC2, ram: true}, // RAMはMBC2に内蔵されている
+	0x06: {mapper: MAPPER_MBC2, ram: true, battery: true},
+	0x08: {mapper: MAPPER_NONE, ram: true},
+	0x09: {mapper: MAPPER_NONE, ram: true, battery: true},
+	0x0B: {mapper: MAPPER_MMM01},
+	0x0C: {mapper: MAPPER_MMM01, ram: true},
+	0x0D: {mapper: MAPPER_MMM01, ram: true, battery: true},
+	0x0F: {mapper: MAPPER_MBC3, battery: true, timer: true},
+	0x10: {mapper: MAPPER_MBC3, ram: true, battery: true, timer: true},
+	0x11: {mapper: MAPPER_MBC3},
+	0x12: {mapper: MAPPER_MBC3, ram: true},
+	0x13: {mapper: MAPPER_MBC3, ram: true, battery: true},
+	0x19: {mapper: MAPPER_MBC5},
+	0x1A: {mapper: MAPPER_MBC5, ram: true},
+	0x1B: {mapper: MAPPER_MBC5, ram: true, battery: true},
+	0x1C: {mapper: MAPPER_MBC5, rumble: true},
+	0x1D: {mapper: MAPPER_MBC5, ram: true, rumble: true},
+	0x1E: {mapper: MAPPER_MBC5, ram: true, battery: true, rumble: true},
+	0x20: {mapper: MAPPER_MBC6, ram: true, battery: true},
+	0x22: {mapper: MAPPER_MBC7, ram: true, battery: true, sensor: true}, // RAMはEEPROM, 振動モーターは無い
+	0xFC: {mapper: MAPPER_CAMERA, ram: true, battery: true},
+	0xFD: {mapper: MAPPER_TAMA5, battery: true, timer: true},
+	0xFE: {mapper: MAPPER_HUC3, ram: true, battery: true, timer: true},
+	0xFF: {mapper: MAPPER_HUC1, ram: true, battery: true},
+}
+
+// Header is the cartridge header. (0x100..0x14F)
+type Header struct {
+	Title        string
+	Manufacturer string // 0x13F..0x142, 新しいカートリッジにしか無い
+	CGBFlag      uint8  // 0x143; 0x80: CGB対応, 0xC0: CGB専用
+	SGBFlag      uint8  // 0x146; 0x03 ならSGB対応
+	Type         uint8  // 0x147
+
+	Mapper     Mapper
+	HasRAM     bool
+	HasBattery bool
+	HasTimer   bool // RTC
+	HasRumble  bool
+	HasSensor  bool // 加速度センサー(MBC7)
+
+	ROMSize, RAMSize int   // バイト数 (MBC2やMBC7のようにMBCに内蔵されているRAMは含まない)
+	Destination      uint8 // 0x14A; 0: 日本, 1: 海外
+	OldLicensee      uint8 // 0x14B; 0x33 なら NewLicensee を使う
+	NewLicensee      string
+	Version          uint8 // 0x14C
+
+	HeaderChecksum uint8  // 0x14D
+	GlobalChecksum uint16 // 0x14E..0x14F (ビッグエンディアン)
+
+	headerSum uint8 // ROMから計算したもの
+	globalSum uint16
+}
+
+// ParseHeader parses the header of rom. If rom is the whole ROM, the global checksum is also calculated.
+func ParseHeader(rom []uint8) (*Header, error) {
+	if len(rom) < 0x150 {
+		return nil, fmt.Errorf("ROM is too small: %d bytes", len(rom))
+	}
+
+	h := &Header{
+		CGBFlag:        rom[0x143],
+		SGBFlag:        rom[0x146],
+		Type:           rom[0x147],
+		ROMSize:        calcROMSize(rom[0x148]),
+		RAMSize:        calcSRAMSize(rom[0x149]),
+		Destination:    rom[0x14A],
+		OldLicensee:    rom[0x14B],
+		Version:        rom[0x14C],
+		HeaderChecksum: rom[0x14D],
+		GlobalChecksum: uint16(rom[0x14E])<<8 | uint16(rom[0x14F]),
+	}
+
+	// CGB以降のカートリッジは、タイトルの後ろにメーカーコードとCGBフラグが入っている
+	title := rom[0x134:0x144]
+	if h.CGBFlag&0x80 != 0 {
+		title = rom[0x134:0x143]
+		if code := rom[0x13F:0x143]; isCode(code) {
+			h.Manufacturer = string(code)
+			title = rom[0x134:0x13F]
+		}
+	}
+	h.Title = printable(title)
+	if h.OldLicensee == 0x33 {
+		h.NewLicensee = printable(rom[0x144:0x146])
+	}
+
+	if t, ok := cartTypes[h.Type]; ok {
+		h.Mapper = t.mapper
+		h.HasRAM, h.HasBattery, h.HasTimer, h.HasRumble, h.HasSensor = t.ram, t.battery, t.timer, t.rumble, t.sensor
+	} else {
+		h.Mapper = MAPPER_UNKNOWN
+	}
+
+	for _, b := range rom[0x134:0x14D] {
+		h.headerSum = h.headerSum - b - 1
+	}
+	for i, b := range rom {
+		if i != 0x14E && i != 0x14F {
+			h.globalSum += uint16(b)
+		}
+	}
+	return h, nil
+}
+
+// Verify checks the header checksum, which the boot ROM also checks, and the global checksum, which nothing checks on the real hardware.
+// A mismatch usually means a bad dump or a hacked ROM.
+func (h *Header) Verify() error {
+	var errs []error
+	if h.headerSum != h.HeaderChecksum {
+		errs = append(errs, fmt.Errorf("%w: 0x%02X, expected 0x%02X", ErrHeaderChecksum, h.headerSum, h.HeaderChecksum))
+	}
+	if h.globalSum != h.GlobalChecksum {
+		errs = append(errs, fmt.Errorf("%w: 0x%04X, expected 0x%04X", ErrGlobalChecksum, h.globalSum, h.GlobalChecksum))
+	}
+	return errors.Join(errs...)
+}
+
+// SupportsCGB returns true if the game uses CGB features.
+func (h *Header) SupportsCGB() bool { return h.CGBFlag&0x80 != 0 }
+
+// CGBOnly returns true if the game does not run on DMG.
+func (h *Header) CGBOnly() bool { return h.CGBFlag&0xC0 == 0xC0 }
+
+// SupportsSGB returns true if the game uses SGB features. The SGB BIOS also requires the old licensee code to be 0x33.
+func (h *Header) SupportsSGB() bool { return h.SGBFlag == 0x03 && h.OldLicensee == 0x33 }
+
+// メーカーコードは英大文字と数字の4文字
+func isCode(b []uint8) bool {
+	for _, c := range b {
+		if !('A' <= c && c <= 'Z') && !('0' <= c && c <= '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// 最初の0までの、表示できる文字だけを取り出す
+func printable(b []uint8) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c == 0 {
+			break
+		}
+		if 0x20 <= c && c < 0x7F {
+			sb.WriteByte(c)
+		}
+	}
+	return strings.TrimSpace(sb.String())
+}
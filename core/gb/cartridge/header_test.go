@@ -0,0 +1,87 @@
+package cartridge
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	rom := testROM(0x10, 0x05, 0x03)
+	copy(rom[0x134:], "POKEMON CRYSAAAA")
+	copy(rom[0x13F:], "BYTE")
+	rom[0x143], rom[0x146], rom[0x14B] = 0xC0, 0x03, 0x33
+	copy(rom[0x144:], "01")
+	fixChecksums(rom)
+
+	h, err := ParseHeader(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Title != "POKEMON CRY" || h.Manufacturer != "BYTE" || h.NewLicensee != "01" {
+		t.Errorf("title %q, manufacturer %q, licensee %q", h.Title, h.Manufacturer, h.NewLicensee)
+	}
+	if h.Mapper != MAPPER_MBC3 || !h.HasRAM || !h.HasBattery || !h.HasTimer || h.HasRumble {
+		t.Errorf("type 0x10: %+v", h)
+	}
+	if h.ROMSize != 1*MB || h.RAMSize != 32*KB {
+		t.Errorf("ROM %d bytes, RAM %d bytes", h.ROMSize, h.RAMSize)
+	}
+	if !h.SupportsCGB() || !h.CGBOnly() || !h.SupportsSGB() {
+		t.Errorf("CGB %v, CGB only %v, SGB %v", h.SupportsCGB(), h.CGBOnly(), h.SupportsSGB())
+	}
+	if err := h.Verify(); err != nil {
+		t.Errorf("Verify: %v", err)
+	}
+}
+
+func TestCartTypes(t *testing.T) {
+	for _, tt := range []struct {
+		cartType              uint8
+		mapper                Mapper
+		battery, rumble, tilt bool
+	}{
+		{0x1B, MAPPER_MBC5, true, false, false},
+		{0x1E, MAPPER_MBC5, true, true, false},
+		{0x22, MAPPER_MBC7, true, false, true},
+		{0xFE, MAPPER_HUC3, true, false, false},
+	} {
+		h, err := ParseHeader(testROM(tt.cartType, 0x00, 0x00))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Mapper != tt.mapper || h.HasBattery != tt.battery || h.HasRumble != tt.rumble || h.HasSensor != tt.tilt {
+			t.Errorf("type 0x%02X: %+v", tt.cartType, h)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	rom := testROM(0x00, 0x00, 0x00)
+	rom[0x14D]++
+	rom[0x200] = 1
+	h, err := ParseHeader(rom)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = h.Verify()
+	if !errors.Is(err, ErrHeaderChecksum) || !errors.Is(err, ErrGlobalChecksum) {
+		t.Errorf("Verify: %v", err)
+	}
+
+	if _, err := ParseHeader(rom[:0x14F]); err == nil {
+		t.Error("ParseHeader accepted a truncated ROM")
+	}
+}
+
+func TestUnknownMapper(t *testing.T) {
+	h, err := ParseHeader(testROM(0x42, 0x00, 0x00))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Mapper != MAPPER_UNKNOWN {
+		t.Errorf("mapper %s", h.Mapper)
+	}
+	if _, err := New(testROM(0x42, 0x00, 0x00)); err == nil {
+		t.Error("New accepted an unknown mapper")
+	}
+}
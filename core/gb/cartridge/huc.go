@@ -0,0 +1,483 @@
+package cartridge
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// 音を出すMBC
+type buzzerMBC interface {
+	runBuzzer(cycles8MHz int64)
+	sample() int16
+}
+
+// Sample returns the current output of the speaker on the cartridge, i.e. the buzzer of HuC3. It is always 0 for other cartridges.
+func (c *Cartridge) Sample() int16 {
+	if c.buzzer == nil {
+		return 0
+	}
+	return c.buzzer.sample()
+}
+
+// IRPort is the infrared LED and receiver on HuC1 and HuC3 cartridges.
+type IRPort interface {
+	SetLED(on bool)
+	Light() bool // 光を受けているか
+}
+
+// 赤外線LEDを持つMBC
+type irMBC interface {
+	irLED() bool
+}
+
+// IRLED returns whether the infrared LED of the cartridge is on. It is always false for cartridges without infrared port.
+func (c *Cartridge) IRLED() bool {
+	if m, ok := c.MBC.(irMBC); ok {
+		return m.irLED()
+	}
+	return false
+}
+
+func (c *Cartridge) setIRLED(on bool) {
+	if c.IR != nil {
+		c.IR.SetLED(on)
+	}
+}
+
+// 受光していれば bit0 が立つ
+func (c *Cartridge) readIR() uint8 {
+	if c.IR != nil && c.IR.Light() {
+		return 0xC1
+	}
+	return 0xC0
+}
+
+/*
+HuC1 はMBC1に似ているが、RAMの有効化の代わりに A000..BFFF で赤外線ポートを使うかを選ぶ
+
+	0000..1FFF: 0x0E なら赤外線ポート、それ以外ならRAM (RAMは常に書き込める)
+	2000..3FFF: ROMバンク (0..63)
+	4000..5FFF: RAMバンク (0..3)
+	赤外線ポート: bit0 に書き込むとLEDが点灯し、読み込むと bit0 が受光しているか
+*/
+type HuC1 struct {
+	c       *Cartridge
+	IRMode  bool
+	ROMBank uint8
+	RAMBank uint8
+	LED     bool
+}
+
+func newHuC1(c *Cartridge) *HuC1 {
+	return &HuC1{
+		c:       c,
+		ROMBank: 1,
+	}
+}
+
+func (m *HuC1) reset() {
+	m.IRMode = false
+	m.ROMBank, m.RAMBank = 1, 0
+	m.setLED(false)
+}
+
+func (m *HuC1) irLED() bool { return m.LED }
+
+func (m *HuC1) setLED(on bool) {
+	if m.LED != on {
+		m.LED = on
+		m.c.setIRLED(on)
+	}
+}
+
+func (m *HuC1) read(addr uint16) uint8 {
+	switch addr >> 12 {
+	case 0x0, 0x1, 0x2, 0x3:
+		return m.c.ROM[addr]
+	case 0x4, 0x5, 0x6, 0x7:
+		n := (int(m.ROMBank) << 14) | int(addr&0x3FFF)
+		return m.c.ROM[n%len(m.c.ROM)]
+	case 0xA, 0xB:
+		if m.IRMode {
+			return m.c.readIR()
+		}
+		if len(m.c.RAM) > 0 {
+			n := (int(m.RAMBank) << 13) | int(addr&0x1FFF)
+			return m.c.RAM[n%len(m.c.RAM)]
+		}
+	}
+	return 0xFF
+}
+
+func (m *HuC1) write(addr uint16, val uint8) {
+	switch addr >> 12 {
+	case 0x0, 0x1:
+		m.IRMode = val&0x0F == 0x0E
+	case 0x2, 0x3:
+		m.ROMBank = max(val&0x3F, 1)
+	case 0x4, 0x5:
+		m.RAMBank = val & 0x03
+	case 0xA, 0xB:
+		if m.IRMode {
+			m.setLED(val&0x01 != 0)
+			return
+		}
+		if len(m.c.RAM) > 0 {
+			n := (int(m.RAMBank) << 13) | int(addr&0x1FFF)
+			m.c.RAM[n%len(m.c.RAM)] = val
+		}
+	}
+}
+
+type HuC1Snapshot struct {
+	Header  uint64
+	IRMode  bool
+	ROMBank uint8
+	RAMBank uint8
+	LED     bool
+}
+
+func (m *HuC1) CreateSnapshot() HuC1Snapshot {
+	return HuC1Snapshot{
+		IRMode:  m.IRMode,
+		ROMBank: m.ROMBank,
+		RAMBank: m.RAMBank,
+		LED:     m.LED,
+	}
+}
+
+func (m *HuC1) RestoreSnapshot(snap *HuC1Snapshot) error {
+	if snap == nil {
+		return errSnapshotNil
+	}
+	m.IRMode = snap.IRMode
+	m.ROMBank, m.RAMBank = snap.ROMBank, snap.RAMBank
+	m.LED = snap.LED
+	return nil
+}
+
+/*
+HuC3 は時計とブザーを持つマイコンを載せている A000..BFFF の役割は 0000..1FFF に書き込んだモードで決まる
+
+	0x0: RAM (読み込みのみ)
+	0xA: RAM
+	0xB: マイコンへのコマンド (上位4ビットがコマンド、下位4ビットが引数)
+		1: レジスタを読んで、インデックスを1つ進める
+		2: レジスタに書き込む
+		3: レジスタに書き込んで、インデックスを1つ進める
+		4, 5: インデックスの下位, 上位4ビット
+		6: 拡張コマンド (2: 状態を読む, E: 0x27 が 1 なら 0x26 の音をブザーで鳴らす)
+	0xC: コマンドの結果 (下位4ビット)
+	0xD: コマンドの完了 (bit0 が立っていれば完了している 常に完了している)
+	0xE: 赤外線ポート
+
+マイコンのレジスタは4ビットずつで、時計は次のように読み書きする (下位4ビットから)
+
+	0x00..0x02: 分 (0..1439)
+	0x03..0x06: 日
+	0x26: ブザーの音の種類 (0..15)
+	0x27: 1 ならブザーを鳴らせる
+	0x58..0x5A: アラームの分
+	0x5B..0x5E: アラームの日
+	0x5F: アラームを有効にする
+
+ブザーが鳴らす実際の音は分かっていないので、音の種類ごとに C7 (2093Hz) から半音ずつ高い矩形波を0.5秒鳴らす
+*/
+type HuC3 struct {
+	c         *Cartridge
+	Mode      uint8
+	ROMBank   uint8
+	RAMBank   uint8
+	Index     uint8 // マイコンのレジスタのインデックス
+	Result    uint8 // 0xC で読める値
+	Registers [256]uint8
+	LED       bool
+	Clock     HuC3Clock
+
+	Tone       uint8 // ブザーで鳴らしている音の種類
+	ToneCycles int64 // ブザーが鳴り終わるまでの残りマスターサイクル数 (0 なら鳴っていない)
+}
+
+// HuC3Clock is the clock of HuC3, which counts minutes and days.
+type HuC3Clock struct {
+	Minutes      uint16 // 0..1439
+	Days         uint16
+	AlarmMinutes uint16
+	AlarmDays    uint16
+	AlarmEnabled bool
+	Cycles       int64 // 前に1分進んでから経過したマスターサイクル数
+}
+
+const (
+	huc3Minute     = 60 * rtcSecond
+	huc3ToneLength = rtcSecond / 2
+	huc3ToneVolume = 4096
+)
+
+func newHuC3(c *Cartridge) *HuC3 {
+	return &HuC3{
+		c:       c,
+		ROMBank: 1,
+	}
+}
+
+func (m *HuC3) reset() {
+	m.Mode = 0
+	m.ROMBank, m.RAMBank = 1, 0
+	m.Index, m.Result = 0, 0
+	m.setLED(false)
+	m.Tone, m.ToneCycles = 0, 0
+}
+
+func (m *HuC3) rtc() clockChip { return &m.Clock }
+
+func (m *HuC3) irLED() bool { return m.LED }
+
+func (m *HuC3) setLED(on bool) {
+	if m.LED != on {
+		m.LED = on
+		m.c.setIRLED(on)
+	}
+}
+
+func (m *HuC3) read(addr uint16) uint8 {
+	switch addr >> 12 {
+	case 0x0, 0x1, 0x2, 0x3:
+		return m.c.ROM[addr]
+	case 0x4, 0x5, 0x6, 0x7:
+		n := (int(m.ROMBank) << 14) | int(addr&0x3FFF)
+		return m.c.ROM[n%len(m.c.ROM)]
+	case 0xA, 0xB:
+		switch m.Mode {
+		case 0x0, 0xA:
+			if len(m.c.RAM) > 0 {
+				n := (int(m.RAMBank) << 13) | int(addr&0x1FFF)
+				return m.c.RAM[n%len(m.c.RAM)]
+			}
+			return 0xFF
+		case 0xC:
+			return m.Result
+		case 0xE:
+			return m.c.readIR()
+		}
+		return 0x01
+	}
+	return 0xFF
+}
+
+func (m *HuC3) write(addr uint16, val uint8) {
+	switch addr >> 12 {
+	case 0x0, 0x1:
+		m.Mode = val & 0x0F
+	case 0x2, 0x3:
+		m.ROMBank = max(val&0x7F, 1)
+	case 0x4, 0x5:
+		m.RAMBank = val & 0x03
+	case 0xA, 0xB:
+		switch m.Mode {
+		case 0xA:
+			if len(m.c.RAM) > 0 {
+				n := (int(m.RAMBank) << 13) | int(addr&0x1FFF)
+				m.c.RAM[n%len(m.c.RAM)] = val
+			}
+		case 0xB:
+			m.command(val>>4, val&0x0F)
+		case 0xE:
+			m.setLED(val&0x01 != 0)
+		}
+	}
+}
+
+func (m *HuC3) command(cmd, arg uint8) {
+	switch cmd {
+	case 0x1:
+		m.Result = m.readRegister(m.Index)
+		m.Index++
+	case 0x2, 0x3:
+		m.writeRegister(m.Index, arg)
+		if cmd == 0x3 {
+			m.Index++
+		}
+	case 0x4:
+		m.Index = (m.Index & 0xF0) | arg
+	case 0x5:
+		m.Index = (m.Index & 0x0F) | arg<<4
+	case 0x6:
+		switch arg {
+		case 0x2:
+			m.Result = 0x01
+		case 0xE:
+			if m.Registers[0x27] == 0x01 {
+				m.Tone, m.ToneCycles = m.Registers[0x26]&0x0F, huc3ToneLength
+				if m.c.OnTone != nil {
+					m.c.OnTone(m.Tone)
+				}
+			}
+		}
+	}
+}
+
+func (m *HuC3) readRegister(i uint8) uint8 {
+	t := &m.Clock
+	switch {
+	case i <= 0x02:
+		return uint8(t.Minutes>>(i*4)) & 0x0F
+	case i <= 0x06:
+		return uint8(t.Days>>((i-0x03)*4)) & 0x0F
+	case i >= 0x58 && i <= 0x5A:
+		return uint8(t.AlarmMinutes>>((i-0x58)*4)) & 0x0F
+	case i >= 0x5B && i <= 0x5E:
+		return uint8(t.AlarmDays>>((i-0x5B)*4)) & 0x0F
+	case i == 0x5F:
+		if t.AlarmEnabled {
+			return 0x01
+		}
+		return 0x00
+	}
+	return m.Registers[i]
+}
+
+func (m *HuC3) writeRegister(i, val uint8) {
+	t := &m.Clock
+	setNibble := func(v *uint16, n uint8) {
+		*v = *v&^(0x0F<<(n*4)) | uint16(val)<<(n*4)
+	}
+	switch {
+	case i <= 0x02:
+		setNibble(&t.Minutes, i)
+	case i <= 0x06:
+		setNibble(&t.Days, i-0x03)
+	case i >= 0x58 && i <= 0x5A:
+		setNibble(&t.AlarmMinutes, i-0x58)
+	case i >= 0x5B && i <= 0x5E:
+		setNibble(&t.AlarmDays, i-0x5B)
+	case i == 0x5F:
+		t.AlarmEnabled = val&0x01 != 0
+	default:
+		m.Registers[i] = val
+	}
+}
+
+func (m *HuC3) runBuzzer(cycles8MHz int64) {
+	m.ToneCycles = max(m.ToneCycles-cycles8MHz, 0)
+}
+
+func (m *HuC3) sample() int16 {
+	if m.ToneCycles == 0 {
+		return 0
+	}
+	freq := 2093 * math.Pow(2, float64(m.Tone)/12)
+	elapsed := float64(huc3ToneLength-m.ToneCycles) / rtcSecond
+	if int64(elapsed*freq*2)%2 == 0 {
+		return huc3ToneVolume
+	}
+	return -huc3ToneVolume
+}
+
+func (t *HuC3Clock) run(cycles8MHz int64) {
+	t.Cycles += cycles8MHz
+	for t.Cycles >= huc3Minute {
+		t.Cycles -= huc3Minute
+		t.tick()
+	}
+}
+
+func (t *HuC3Clock) tick() {
+	if t.Minutes++; t.Minutes >= 24*60 {
+		t.Minutes = 0
+		t.Days++
+	}
+}
+
+func (t *HuC3Clock) catchUp(now, savedAt time.Time) {
+	d := int64(now.Sub(savedAt) / time.Second)
+	if d <= 0 {
+		return
+	}
+	t.run(d % 60 * rtcSecond)
+	minutes := int64(t.Minutes) + d/60
+	t.Days += uint16(minutes / (24 * 60))
+	t.Minutes = uint16(minutes % (24 * 60))
+}
+
+/*
+HuC3のセーブファイルのフッタ (SameBoy と互換, リトルエンディアン)
+
+	uint64: 保存したときの Unix 時刻
+	uint16: 分, 日, アラームの分, アラームの日
+	uint8:  アラームが有効か
+*/
+const huc3FooterSize = 17
+
+func (t *HuC3Clock) footerSizes() []int { return []int{huc3FooterSize} }
+
+func (t *HuC3Clock) footer(now time.Time) []uint8 {
+	data := make([]uint8, huc3FooterSize)
+	binary.LittleEndian.PutUint64(data, uint64(now.Unix()))
+	for i, v := range []uint16{t.Minutes, t.Days, t.AlarmMinutes, t.AlarmDays} {
+		binary.LittleEndian.PutUint16(data[8+i*2:], v)
+	}
+	if t.AlarmEnabled {
+		data[16] = 1
+	}
+	return data
+}
+
+func (t *HuC3Clock) loadFooter(data []uint8) time.Time {
+	t.Minutes = binary.LittleEndian.Uint16(data[8:]) % (24 * 60)
+	t.Days = binary.LittleEndian.Uint16(data[10:])
+	t.AlarmMinutes = binary.LittleEndian.Uint16(data[12:])
+	t.AlarmDays = binary.LittleEndian.Uint16(data[14:])
+	t.AlarmEnabled = data[16]&0x01 != 0
+	t.Cycles = 0
+	if unix := int64(binary.LittleEndian.Uint64(data)); unix != 0 {
+		return time.Unix(unix, 0)
+	}
+	return time.Time{}
+}
+
+type HuC3Snapshot struct {
+	Header    uint64
+	Mode      uint8
+	ROMBank   uint8
+	RAMBank   uint8
+	Index     uint8
+	Result    uint8
+	Registers [256]uint8
+	LED       bool
+	Clock     HuC3Clock
+
+	Tone       uint8
+	ToneCycles int64
+}
+
+func (m *HuC3) CreateSnapshot() HuC3Snapshot {
+	return HuC3Snapshot{
+		Mode:      m.Mode,
+		ROMBank:   m.ROMBank,
+		RAMBank:   m.RAMBank,
+		Index:     m.Index,
+		Result:    m.Result,
+		Registers: m.Registers,
+		LED:       m.LED,
+		Clock:     m.Clock,
+
+		Tone:       m.Tone,
+		ToneCycles: m.ToneCycles,
+	}
+}
+
+func (m *HuC3) RestoreSnapshot(snap *HuC3Snapshot) error {
+	if snap == nil {
+		return errSnapshotNil
+	}
+	m.Mode = snap.Mode
+	m.ROMBank, m.RAMBank = snap.ROMBank, snap.RAMBank
+	m.Index, m.Result = snap.Index, snap.Result
+	m.Registers = snap.Registers
+	m.LED = snap.LED
+	m.Clock = snap.Clock
+	m.Tone, m.ToneCycles = snap.Tone, snap.ToneCycles
+	return nil
+}
@@ -10,6 +10,8 @@ func newMBC0(c *Cartridge) *MBC0 {
 	}
 }
 
+func (m *MBC0) reset() {}
+
 func (m *MBC0) read(addr uint16) uint8 {
 	switch addr >> 12 {
 	case 0x0, 0x1, 0x2, 0x3, 0x4, 0x5, 0x6, 0x7:
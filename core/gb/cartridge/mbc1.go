@@ -14,6 +14,12 @@ func newMBC1(c *Cartridge) *MBC1 {
 	}
 }
 
+func (m *MBC1) reset() {
+	m.ramEnabled = false
+	m.ROMBank, m.ramBank = 1, 0
+	m.Mode = 0
+}
+
 func (m *MBC1) read(addr uint16) uint8 {
 	switch addr >> 12 {
 	case 0x0, 0x1, 0x2, 0x3:
@@ -4,17 +4,6 @@ import (
 	"github.com/akatsuki105/dawngb/core/gb/internal"
 )
 
-type Time struct {
-	Sec, Min, Hour uint8
-	DayCarry       bool
-	Day            uint16
-}
-
-type RTC struct {
-	Enabled     bool
-	Time, Latch Time
-}
-
 type MBC3 struct {
 	c                *Cartridge
 	RAMEnabled       bool
@@ -28,6 +17,7 @@ func newMBC3(c *Cartridge) *MBC3 {
 		c:          c,
 		ROMBank:    1,
 		RAMBankMax: 4,
+		RTC:        RTC{Enabled: true},
 	}
 	if m.isMBC30() {
 		m.RAMBankMax = 8
@@ -35,6 +25,18 @@ func newMBC3(c *Cartridge) *MBC3 {
 	return m
 }
 
+func (m *MBC3) reset() {
+	m.RAMEnabled = false
+	m.ROMBank, m.RAMBank = 1, 0
+}
+
+func (m *MBC3) rtc() clockChip {
+	if !m.c.Header.HasTimer {
+		return nil
+	}
+	return &m.RTC
+}
+
 // ポケモンクリスタルなどは、MBC30と呼ばれる特殊なMBC3を使っている
 // これを見分ける方法は今のところ、カートリッジヘッダのROMサイズとRAMサイズを見るしかない
 func (m *MBC3) isMBC30() bool {
@@ -99,6 +101,15 @@ func (m *MBC3) write(addr uint16, val uint8) {
 				m.c.RAM[(uint(m.RAMBank)<<13)|uint(addr&0x1FFF)] = val
 			} else {
 				switch m.RAMBank {
+				case 0x8:
+					m.RTC.Time.Sec = val & 0x3F
+					m.RTC.Cycles = 0 // 秒を書き込むと1秒未満のカウンタもリセットされる
+				case 0x9:
+					m.RTC.Time.Min = val & 0x3F
+				case 0xA:
+					m.RTC.Time.Hour = val & 0x1F
+				case 0xB:
+					m.RTC.Time.Day = (m.RTC.Time.Day & 0x100) | uint16(val)
 				case 0xC:
 					m.RTC.Time.Day &= 0xFF
 					m.RTC.Time.Day |= uint16(val&0x1) << 8
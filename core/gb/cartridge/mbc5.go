@@ -3,20 +3,30 @@ package cartridge
 type MBC5 struct {
 	c          *Cartridge
 	hasRam     bool
+	hasRumble  bool
 	RAMEnabled bool
 	ROMBank    uint16 // 0..511
 	RAMBank    uint8  // 0..15
+	Motor      bool   // 振動カートリッジでは、RAMバンクのbit3でモーターを回す
 }
 
 func newMBC5(c *Cartridge) *MBC5 {
-	hasRam := c.ROM[0x147] != 25 && c.ROM[0x147] != 28
 	return &MBC5{
-		c:       c,
-		hasRam:  hasRam,
-		ROMBank: 1,
+		c:         c,
+		hasRam:    c.Header.HasRAM,
+		hasRumble: c.Header.HasRumble,
+		ROMBank:   1,
 	}
 }
 
+func (m *MBC5) reset() {
+	m.RAMEnabled = false
+	m.ROMBank, m.RAMBank = 1, 0
+	m.Motor = false
+}
+
+func (m *MBC5) motor() bool { return m.Motor }
+
 func (m *MBC5) read(addr uint16) uint8 {
 	switch addr >> 12 {
 	case 0x0, 0x1, 0x2, 0x3:
@@ -47,6 +57,10 @@ func (m *MBC5) write(addr uint16, val uint8) {
 		m.ROMBank |= uint16(val&0b1) << 8
 	case 0x4, 0x5:
 		m.RAMBank = (val & 0b1111)
+		if m.hasRumble {
+			m.RAMBank &= 0b0111
+			m.Motor = val&0b1000 != 0
+		}
 	case 0xA, 0xB:
 		if m.hasRam && m.RAMEnabled {
 			n := int((uint(m.RAMBank) << 13) | uint(addr&0x1FFF))
@@ -63,6 +77,7 @@ type MBC5Snapshot struct {
 	RAMEnabled bool
 	ROMBank    uint16
 	RAMBank    uint8
+	Motor      bool
 }
 
 func (m *MBC5) CreateSnapshot() MBC5Snapshot {
@@ -70,6 +85,7 @@ func (m *MBC5) CreateSnapshot() MBC5Snapshot {
 		RAMEnabled: m.RAMEnabled,
 		ROMBank:    m.ROMBank,
 		RAMBank:    m.RAMBank,
+		Motor:      m.Motor,
 	}
 }
 
@@ -79,5 +95,6 @@ func (m *MBC5) RestoreSnapshot(snap *MBC5Snapshot) error {
 	}
 	m.RAMEnabled = snap.RAMEnabled
 	m.ROMBank, m.RAMBank = snap.ROMBank, snap.RAMBank
+	m.Motor = snap.Motor
 	return nil
 }
@@ -0,0 +1,242 @@
+package cartridge
+
+/*
+MBC6 は 4000..5FFF と 6000..7FFF をそれぞれ8KBのROMかフラッシュメモリ(MX29F008, 1MB)に切り替えられる
+
+	0000..03FF: 0x0A を書くとRAMを有効化
+	0400..07FF: RAMバンクA (A000..AFFF, 4KBx8)
+	0800..0BFF: RAMバンクB (B000..BFFF)
+	0C00..0FFF: bit0 フラッシュの有効化 (1000 の bit0 が立っているときだけ書き込める)
+	1000:       bit0 フラッシュへの書き込みの有効化
+	2000..27FF: ROM/フラッシュのバンクA (4000..5FFF, 8KB)
+	2800..2FFF: 0x08 ならバンクAはフラッシュ、それ以外ならROM
+	3000..37FF: ROM/フラッシュのバンクB (6000..7FFF)
+	3800..3FFF: 0x08 ならバンクBはフラッシュ、それ以外ならROM
+
+フラッシュは RAM の後ろに置くので、セーブファイルは RAM(32KB) + フラッシュ(1MB) になる (mGBA と同じ)
+*/
+
+const (
+	mbc6RAMSize    = 32 * KB
+	mbc6FlashSize  = 1 * MB
+	mbc6SectorSize = 128 * KB
+	mbc6PageSize   = 128
+)
+
+type MBC6 struct {
+	c                 *Cartridge
+	RAMEnabled        bool
+	RAMBank           [2]uint8 // A, B
+	ROMBank           [2]uint8 // A, B
+	FlashMapped       [2]bool  // バンクA, B がフラッシュを指しているか
+	FlashEnabled      bool
+	FlashWriteEnabled bool
+	Flash             MX29F008
+}
+
+// MX29F008 is the command state of the flash memory on MBC6. The data is placed after the RAM in Cartridge.RAM.
+type MX29F008 struct {
+	Cycle   uint8 // 受け取ったアンロックサイクル (AA, 55) の数
+	Erase   bool  // 0x80 を受け取って、消去コマンドを待っている
+	ID      bool  // メーカーとデバイスのIDを読むモード
+	Program bool  // 0xA0 を受け取って、ページにデータを書き込んでいる
+	Page    int32 // 書き込んでいるページ (最初の書き込みまでは -1)
+}
+
+func newMBC6(c *Cartridge) *MBC6 {
+	c.RAM = make([]uint8, mbc6RAMSize+mbc6FlashSize)
+	fill(c.RAM[mbc6RAMSize:], 0xFF) // 消去された状態
+	m := &MBC6{c: c}
+	m.reset()
+	return m
+}
+
+func (m *MBC6) reset() {
+	m.RAMEnabled = false
+	m.RAMBank = [2]uint8{}
+	m.ROMBank = [2]uint8{}
+	m.FlashMapped = [2]bool{}
+	m.FlashEnabled, m.FlashWriteEnabled = false, false
+	m.Flash = MX29F008{}
+}
+
+func (m *MBC6) flash() []uint8 {
+	return m.c.RAM[mbc6RAMSize:]
+}
+
+// 4000..7FFF のアドレスのフラッシュ上の位置
+func (m *MBC6) flashAddr(addr uint16) int {
+	i := (addr >> 13) & 0x01
+	return ((int(m.ROMBank[i]) << 13) | int(addr&0x1FFF)) % mbc6FlashSize
+}
+
+func (m *MBC6) read(addr uint16) uint8 {
+	switch addr >> 12 {
+	case 0x0, 0x1, 0x2, 0x3:
+		return m.c.ROM[addr]
+	case 0x4, 0x5, 0x6, 0x7:
+		i := (addr >> 13) & 0x01
+		if m.FlashMapped[i] {
+			return m.Flash.read(m.flash(), m.flashAddr(addr))
+		}
+		n := (int(m.ROMBank[i]) << 13) | int(addr&0x1FFF)
+		return m.c.ROM[n%len(m.c.ROM)]
+	case 0xA, 0xB:
+		if m.RAMEnabled {
+			return m.c.RAM[m.ramAddr(addr)]
+		}
+	}
+	return 0xFF
+}
+
+func (m *MBC6) ramAddr(addr uint16) int {
+	i := (addr >> 12) & 0x01
+	return ((int(m.RAMBank[i]&0x07) << 12) | int(addr&0x0FFF)) % mbc6RAMSize
+}
+
+func (m *MBC6) write(addr uint16, val uint8) {
+	switch {
+	case addr < 0x0400:
+		m.RAMEnabled = val&0x0F == 0x0A
+	case addr < 0x0800:
+		m.RAMBank[0] = val & 0x07
+	case addr < 0x0C00:
+		m.RAMBank[1] = val & 0x07
+	case addr < 0x1000:
+		if m.FlashWriteEnabled {
+			m.FlashEnabled = val&0x01 != 0
+		}
+	case addr == 0x1000:
+		m.FlashWriteEnabled = val&0x01 != 0
+	case addr >= 0x2000 && addr < 0x4000:
+		i := (addr >> 12) & 0x01
+		if addr&0x0800 == 0 {
+			m.ROMBank[i] = val & 0x7F
+		} else {
+			m.FlashMapped[i] = val == 0x08
+		}
+	case addr >= 0x4000 && addr < 0x8000:
+		if m.FlashMapped[(addr>>13)&0x01] {
+			m.Flash.write(m.flash(), m.flashAddr(addr), val, m.FlashEnabled && m.FlashWriteEnabled)
+		}
+	case addr >= 0xA000 && addr < 0xC000:
+		if m.RAMEnabled {
+			m.c.RAM[m.ramAddr(addr)] = val
+		}
+	}
+}
+
+func (f *MX29F008) read(data []uint8, addr int) uint8 {
+	if f.ID {
+		if addr&0x01 == 0 {
+			return 0xC2 // Macronix
+		}
+		return 0x81
+	}
+	return data[addr]
+}
+
+// 消去と書き込みはすぐに終わる (ステータスのポーリングには常に書き込んだ値が返る)
+func (f *MX29F008) write(data []uint8, addr int, val uint8, writable bool) {
+	if f.Program {
+		page := int32(addr / mbc6PageSize)
+		if f.Page < 0 || f.Page == page {
+			f.Page = page
+			if writable {
+				data[addr] &= val // 1 を 0 にすることしかできない
+			}
+			if addr%mbc6PageSize == mbc6PageSize-1 {
+				f.Program = false
+			}
+			return
+		}
+		f.Program = false // ページの外に書き込んだら、コマンドとして扱う
+	}
+
+	if val == 0xF0 { // リセット
+		f.Cycle, f.Erase, f.ID = 0, false, false
+		return
+	}
+
+	a := addr & 0x7FFF
+	switch f.Cycle {
+	case 0:
+		if a == 0x5555 && val == 0xAA {
+			f.Cycle = 1
+		}
+	case 1:
+		f.Cycle = 0
+		if a == 0x2AAA && val == 0x55 {
+			f.Cycle = 2
+		}
+	case 2:
+		f.Cycle = 0
+		if f.Erase {
+			f.Erase = false
+			switch {
+			case val == 0x30: // セクター消去
+				if writable {
+					start := addr &^ (mbc6SectorSize - 1)
+					fill(data[start:start+mbc6SectorSize], 0xFF)
+				}
+			case a == 0x5555 && val == 0x10: // チップ消去
+				if writable {
+					fill(data, 0xFF)
+				}
+			}
+			return
+		}
+		if a != 0x5555 {
+			return
+		}
+		switch val {
+		case 0x80:
+			f.Erase = true
+		case 0x90:
+			f.ID = true
+		case 0xA0:
+			f.Program, f.Page = true, -1
+		}
+	}
+}
+
+func fill(data []uint8, val uint8) {
+	for i := range data {
+		data[i] = val
+	}
+}
+
+type MBC6Snapshot struct {
+	Header            uint64
+	RAMEnabled        bool
+	RAMBank           [2]uint8
+	ROMBank           [2]uint8
+	FlashMapped       [2]bool
+	FlashEnabled      bool
+	FlashWriteEnabled bool
+	Flash             MX29F008
+}
+
+func (m *MBC6) CreateSnapshot() MBC6Snapshot {
+	return MBC6Snapshot{
+		RAMEnabled:        m.RAMEnabled,
+		RAMBank:           m.RAMBank,
+		ROMBank:           m.ROMBank,
+		FlashMapped:       m.FlashMapped,
+		FlashEnabled:      m.FlashEnabled,
+		FlashWriteEnabled: m.FlashWriteEnabled,
+		Flash:             m.Flash,
+	}
+}
+
+func (m *MBC6) RestoreSnapshot(snap *MBC6Snapshot) error {
+	if snap == nil {
+		return errSnapshotNil
+	}
+	m.RAMEnabled = snap.RAMEnabled
+	m.RAMBank, m.ROMBank = snap.RAMBank, snap.ROMBank
+	m.FlashMapped = snap.FlashMapped
+	m.FlashEnabled, m.FlashWriteEnabled = snap.FlashEnabled, snap.FlashWriteEnabled
+	m.Flash = snap.Flash
+	return nil
+}
@@ -0,0 +1,145 @@
+package cartridge
+
+import (
+	"bytes"
+	"testing"
+)
+
+// バンクAをフラッシュのバンク2、バンクBをバンク1にすると、4000..7FFF のアドレスでコマンドを送れる
+func newTestMBC6(t *testing.T, writable bool) *Cartridge {
+	t.Helper()
+	c := newTestCartridge(t, 0x20, 0x00, 0x03)
+	if writable {
+		c.Write(0x1000, 0x01)
+		c.Write(0x0C00, 0x01)
+	}
+	c.Write(0x2800, 0x08)
+	c.Write(0x3800, 0x08)
+	c.Write(0x2000, 0x02)
+	c.Write(0x3000, 0x01)
+	return c
+}
+
+func flashCommand(c *Cartridge, cmd uint8) {
+	c.Write(0x2000, 0x02)
+	c.Write(0x5555, 0xAA) // フラッシュの 5555
+	c.Write(0x6AAA, 0x55) // フラッシュの 2AAA
+	c.Write(0x5555, cmd)
+}
+
+func programPage(c *Cartridge, bank uint8, data []uint8) {
+	flashCommand(c, 0xA0)
+	c.Write(0x2000, bank)
+	for i, b := range data {
+		c.Write(0x4000+uint16(i), b)
+	}
+}
+
+func readFlash(c *Cartridge, bank uint8, n int) []uint8 {
+	c.Write(0x2000, bank)
+	data := make([]uint8, n)
+	for i := range data {
+		data[i] = c.Read(0x4000 + uint16(i))
+	}
+	return data
+}
+
+func testPage() []uint8 {
+	page := make([]uint8, mbc6PageSize)
+	for i := range page {
+		page[i] = uint8(i)
+	}
+	return page
+}
+
+func TestMBC6FlashID(t *testing.T) {
+	c := newTestMBC6(t, false)
+	flashCommand(c, 0x90)
+	if id := readFlash(c, 0x00, 2); id[0] != 0xC2 || id[1] != 0x81 {
+		t.Errorf("ID % X", id)
+	}
+	c.Write(0x4000, 0xF0)
+	if b := readFlash(c, 0x00, 1); b[0] != 0xFF {
+		t.Errorf("after reset: 0x%02X", b[0])
+	}
+}
+
+func TestMBC6FlashProgramAndErase(t *testing.T) {
+	c := newTestMBC6(t, true)
+	page := testPage()
+	programPage(c, 0x04, page)
+	programPage(c, 0x10, page) // 次のセクター
+	if got := readFlash(c, 0x04, mbc6PageSize); !bytes.Equal(got, page) {
+		t.Fatalf("program: % X", got[:8])
+	}
+
+	// 1 を 0 にすることしかできない
+	programPage(c, 0x04, append(bytes.Repeat([]uint8{0xFF}, 0x0F), 0xF3))
+	if b := readFlash(c, 0x04, 0x10); b[0x0F] != 0x03 {
+		t.Errorf("reprogram: 0x%02X", b[0x0F])
+	}
+
+	// ページの外に書き込むと書き込みは終わる
+	flashCommand(c, 0xA0)
+	c.Write(0x2000, 0x04)
+	c.Write(0x4081, 0x00)
+	c.Write(0x4100, 0x00)
+	if got := readFlash(c, 0x04, 0x101); got[0x81] != 0x00 || got[0x100] != 0xFF {
+		t.Errorf("write outside the page: 0x%02X, 0x%02X", got[0x81], got[0x100])
+	}
+
+	flashCommand(c, 0x80)
+	c.Write(0x5555, 0xAA)
+	c.Write(0x6AAA, 0x55)
+	c.Write(0x4000, 0x30) // バンク2 はセクター0
+	if got := readFlash(c, 0x04, mbc6PageSize); !bytes.Equal(got, bytes.Repeat([]uint8{0xFF}, mbc6PageSize)) {
+		t.Errorf("sector erase: % X", got[:8])
+	}
+	if got := readFlash(c, 0x10, mbc6PageSize); !bytes.Equal(got, page) {
+		t.Errorf("sector erase touched the next sector: % X", got[:8])
+	}
+
+	flashCommand(c, 0x80)
+	flashCommand(c, 0x10)
+	if got := readFlash(c, 0x10, mbc6PageSize); !bytes.Equal(got, bytes.Repeat([]uint8{0xFF}, mbc6PageSize)) {
+		t.Errorf("chip erase: % X", got[:8])
+	}
+}
+
+func TestMBC6FlashWriteProtect(t *testing.T) {
+	c := newTestMBC6(t, false)
+
+	// 1000 の bit0 が立っていないとフラッシュを有効にできない
+	c.Write(0x0C00, 0x01)
+	programPage(c, 0x04, testPage())
+	if b := readFlash(c, 0x04, 2); b[0] != 0xFF || b[1] != 0xFF {
+		t.Errorf("write protected flash was programmed: % X", b)
+	}
+}
+
+func TestMBC6Save(t *testing.T) {
+	c := newTestMBC6(t, true)
+	page := testPage()
+	programPage(c, 0x7F, page)
+	c.Write(0x0000, 0x0A)
+	c.Write(0x0400, 0x07)
+	c.Write(0xAFFF, 0x42)
+
+	data := c.Save(false)
+	if len(data) != mbc6RAMSize+mbc6FlashSize {
+		t.Fatalf("save is %d bytes", len(data))
+	}
+
+	c2 := newTestMBC6(t, false)
+	if err := c2.LoadSave(data); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFlash(c2, 0x7F, mbc6PageSize); !bytes.Equal(got, page) {
+		t.Errorf("flash: % X", got[:8])
+	}
+	c2.Write(0x0000, 0x0A)
+	c2.Write(0x0400, 0x07)
+	if b := c2.Read(0xAFFF); b != 0x42 {
+		t.Errorf("RAM: 0x%02X", b)
+	}
+}
@@ -0,0 +1,262 @@
+package cartridge
+
+import (
+	"encoding/binary"
+
+	"github.com/akatsuki105/dawngb/core/gb/internal"
+)
+
+/*
+MBC7 は加速度センサーとシリアルEEPROM(93LC56, 16ビットx128ワード)を持つ
+
+	0000..1FFF: 0x0A を書くと有効化 (1)
+	2000..3FFF: ROMバンク
+	4000..5FFF: 0x40 を書くと有効化 (2)
+	A000..AFFF: 両方が有効ならレジスタ (アドレスのbit4..7で選ぶ)
+		Ax0x: 0x55 を書くとラッチした値を消す (0x8000 になる)
+		Ax1x: 0xAA を書くと加速度をラッチする
+		Ax2x..Ax5x: X(下位, 上位), Y(下位, 上位)
+		Ax8x: EEPROM (bit7: CS, bit6: CLK, bit1: DI, bit0: DO)
+*/
+
+const (
+	mbc7EEPROMSize = 256
+	mbc7Center     = 0x81D0 // 水平のときの値
+	mbc7Gravity    = 0x70   // 1G あたりの変化量
+)
+
+type MBC7 struct {
+	c           *Cartridge
+	RAMEnabled1 bool
+	RAMEnabled2 bool
+	ROMBank     uint8
+	Erased      bool // 0x55 で消された後、まだラッチしていない
+	X, Y        uint16
+	EEPROM      EEPROM93LC56
+}
+
+// EEPROM93LC56 is the state of the serial EEPROM on MBC7. The data is Cartridge.RAM.
+type EEPROM93LC56 struct {
+	CS, CLK, DI, DO bool
+	WriteEnabled    bool
+	Command         uint16 // 受信中のコマンド (スタートビット + オペコード2ビット + アドレス8ビット)
+	ArgBits         uint8  // WRITE, WRAL で受信するデータの残りビット数
+	ReadBits        uint16 // DO に上位ビットから送り出す
+}
+
+func newMBC7(c *Cartridge) *MBC7 {
+	c.RAM = make([]uint8, mbc7EEPROMSize)
+	for i := range c.RAM {
+		c.RAM[i] = 0xFF // 消去された状態
+	}
+	m := &MBC7{c: c}
+	m.reset()
+	return m
+}
+
+func (m *MBC7) reset() {
+	m.RAMEnabled1, m.RAMEnabled2 = false, false
+	m.ROMBank = 1
+	m.Erased = false
+	m.X, m.Y = 0x8000, 0x8000
+	m.EEPROM = EEPROM93LC56{ReadBits: 0xFFFF}
+}
+
+func (m *MBC7) read(addr uint16) uint8 {
+	switch addr >> 12 {
+	case 0x0, 0x1, 0x2, 0x3:
+		return m.c.ROM[addr]
+	case 0x4, 0x5, 0x6, 0x7:
+		n := (int(m.ROMBank) << 14) | int(addr&0x3FFF)
+		return m.c.ROM[n%len(m.c.ROM)]
+	case 0xA:
+		if m.RAMEnabled1 && m.RAMEnabled2 {
+			return m.readRegister(uint8(addr>>4) & 0xF)
+		}
+	}
+	return 0xFF
+}
+
+func (m *MBC7) readRegister(reg uint8) uint8 {
+	switch reg {
+	case 0x2:
+		return uint8(m.X)
+	case 0x3:
+		return uint8(m.X >> 8)
+	case 0x4:
+		return uint8(m.Y)
+	case 0x5:
+		return uint8(m.Y >> 8)
+	case 0x6:
+		return 0x00 // Z軸は無い
+	case 0x8:
+		e := &m.EEPROM
+		val := internal.SetBit(uint8(0), 7, e.CS)
+		val = internal.SetBit(val, 6, e.CLK)
+		val = internal.SetBit(val, 1, e.DI)
+		return internal.SetBit(val, 0, e.DO)
+	}
+	return 0xFF
+}
+
+func (m *MBC7) write(addr uint16, val uint8) {
+	switch addr >> 12 {
+	case 0x0, 0x1:
+		m.RAMEnabled1 = val == 0x0A
+	case 0x2, 0x3:
+		m.ROMBank = val
+	case 0x4, 0x5:
+		m.RAMEnabled2 = val == 0x40
+	case 0xA:
+		if !m.RAMEnabled1 || !m.RAMEnabled2 {
+			return
+		}
+		switch (addr >> 4) & 0xF {
+		case 0x0:
+			if val == 0x55 {
+				m.Erased = true
+				m.X, m.Y = 0x8000, 0x8000
+			}
+		case 0x1:
+			if val == 0xAA && m.Erased {
+				m.Erased = false
+				m.X, m.Y = accel(m.c.tilt[0]), accel(m.c.tilt[1])
+			}
+		case 0x8:
+			m.writeEEPROM(val)
+		}
+	}
+}
+
+func accel(g float64) uint16 {
+	return uint16(min(max(mbc7Center+int(g*mbc7Gravity), 0), 0xFFFF))
+}
+
+func (m *MBC7) writeEEPROM(val uint8) {
+	e := &m.EEPROM
+	cs, clk := val&0x80 != 0, val&0x40 != 0
+	e.DI = val&0x02 != 0
+	if !cs {
+		e.Command, e.ArgBits = 0, 0 // CS を下げるとコマンドの受信をやめる
+	} else if !e.CLK && clk { // CLKの立ち上がりで1ビット送受信する
+		e.DO = e.ReadBits&0x8000 != 0
+		e.ReadBits = e.ReadBits<<1 | 1
+		if e.ArgBits == 0 {
+			e.Command = internal.SetBit(e.Command<<1, 0, e.DI)
+			if e.Command&0x400 != 0 { // スタートビットの後に10ビット受信した
+				m.execute()
+			}
+		} else {
+			m.writeBit()
+		}
+	}
+	e.CS, e.CLK = cs, clk
+}
+
+func (m *MBC7) execute() {
+	e := &m.EEPROM
+	addr := int(e.Command&0x7F) * 2
+	switch (e.Command >> 6) & 0xF {
+	case 0x8, 0x9, 0xA, 0xB: // READ
+		e.ReadBits = binary.LittleEndian.Uint16(m.c.RAM[addr:])
+		e.Command = 0
+	case 0x4, 0x5, 0x6, 0x7: // WRITE (この後16ビットのデータを受け取る)
+		if e.WriteEnabled {
+			m.c.RAM[addr], m.c.RAM[addr+1] = 0, 0
+		}
+		e.ArgBits = 16
+	case 0xC, 0xD, 0xE, 0xF: // ERASE
+		if e.WriteEnabled {
+			m.c.RAM[addr], m.c.RAM[addr+1] = 0xFF, 0xFF
+			e.ReadBits = 0x3FFF // 書き込みが終わるまで少しの間 DO が 0 になる
+		}
+		e.Command = 0
+	case 0x3: // EWEN
+		e.WriteEnabled = true
+		e.Command = 0
+	case 0x2: // ERAL
+		if e.WriteEnabled {
+			for i := range m.c.RAM {
+				m.c.RAM[i] = 0xFF
+			}
+			e.ReadBits = 0x00FF
+		}
+		e.Command = 0
+	case 0x1: // WRAL (この後16ビットのデータを受け取る)
+		if e.WriteEnabled {
+			clear(m.c.RAM)
+		}
+		e.ArgBits = 16
+	case 0x0: // EWDS
+		e.WriteEnabled = false
+		e.Command = 0
+	}
+}
+
+// WRITE, WRAL のデータを上位ビットから1ビット受け取る
+func (m *MBC7) writeBit() {
+	e := &m.EEPROM
+	e.ArgBits--
+	e.DO = true
+	if e.DI && e.WriteEnabled {
+		// ワードはリトルエンディアンで RAM に置く (SameBoy と同じ)
+		i, bit := int(e.ArgBits/8), uint8(1)<<(e.ArgBits%8)
+		if e.Command&0x100 != 0 { // WRITE
+			m.c.RAM[int(e.Command&0x7F)*2+i] |= bit
+		} else {
+			for j := i; j < len(m.c.RAM); j += 2 {
+				m.c.RAM[j] |= bit
+			}
+		}
+	}
+	if e.ArgBits == 0 {
+		e.ReadBits = 0x3FFF
+		if e.Command&0x100 == 0 {
+			e.ReadBits = 0x00FF
+		}
+		e.Command = 0
+	}
+}
+
+// SetTilt sets the acceleration which the accelerometer of MBC7 reads, in G.
+// x is positive when the right side is lowered, and y is positive when the bottom side is lowered.
+func (c *Cartridge) SetTilt(x, y float64) {
+	c.tilt = [2]float64{x, y}
+}
+
+// Tilt returns the acceleration set by SetTilt.
+func (c *Cartridge) Tilt() (x, y float64) { return c.tilt[0], c.tilt[1] }
+
+type MBC7Snapshot struct {
+	Header      uint64
+	RAMEnabled1 bool
+	RAMEnabled2 bool
+	ROMBank     uint8
+	Erased      bool
+	X, Y        uint16
+	EEPROM      EEPROM93LC56
+}
+
+func (m *MBC7) CreateSnapshot() MBC7Snapshot {
+	return MBC7Snapshot{
+		RAMEnabled1: m.RAMEnabled1,
+		RAMEnabled2: m.RAMEnabled2,
+		ROMBank:     m.ROMBank,
+		Erased:      m.Erased,
+		X:           m.X,
+		Y:           m.Y,
+		EEPROM:      m.EEPROM,
+	}
+}
+
+func (m *MBC7) RestoreSnapshot(snap *MBC7Snapshot) error {
+	if snap == nil {
+		return errSnapshotNil
+	}
+	m.RAMEnabled1, m.RAMEnabled2 = snap.RAMEnabled1, snap.RAMEnabled2
+	m.ROMBank = snap.ROMBank
+	m.Erased = snap.Erased
+	m.X, m.Y = snap.X, snap.Y
+	m.EEPROM = snap.EEPROM
+	return nil
+}
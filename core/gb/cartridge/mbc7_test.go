@@ -0,0 +1,116 @@
+package cartridge
+
+import "testing"
+
+func newTestMBC7(t *testing.T) *Cartridge {
+	t.Helper()
+	c := newTestCartridge(t, 0x22, 0x00, 0x00)
+	c.Write(0x0000, 0x0A)
+	c.Write(0x4000, 0x40)
+	return c
+}
+
+// CS を上げたまま CLK を1回上げ下げして1ビット送り、DO を返す
+func clockEEPROM(c *Cartridge, bit bool) bool {
+	di := uint8(0)
+	if bit {
+		di = 0x02
+	}
+	c.Write(0xA080, 0x80|di)
+	c.Write(0xA080, 0xC0|di)
+	return c.Read(0xA080)&0x01 != 0
+}
+
+func sendEEPROM(c *Cartridge, val uint16, bits int) {
+	for i := bits - 1; i >= 0; i-- {
+		clockEEPROM(c, val&(1<<i) != 0)
+	}
+}
+
+// スタートビット + オペコード2ビット + アドレス8ビット
+func commandEEPROM(c *Cartridge, op uint8, addr uint8) {
+	c.Write(0xA080, 0x00)
+	sendEEPROM(c, 0x400|uint16(op)<<8|uint16(addr), 11)
+}
+
+func readEEPROM(c *Cartridge, addr uint8) uint16 {
+	commandEEPROM(c, 0b10, addr)
+	val := uint16(0)
+	for range 16 {
+		val <<= 1
+		if clockEEPROM(c, false) {
+			val |= 1
+		}
+	}
+	c.Write(0xA080, 0x00)
+	return val
+}
+
+func TestMBC7EEPROM(t *testing.T) {
+	c := newTestMBC7(t)
+
+	// EWEN の前は書き込めない
+	commandEEPROM(c, 0b01, 0x05)
+	sendEEPROM(c, 0x1234, 16)
+	if got := readEEPROM(c, 0x05); got != 0xFFFF {
+		t.Fatalf("write before EWEN: word 0x%04X", got)
+	}
+
+	commandEEPROM(c, 0b00, 0xC0) // EWEN
+	commandEEPROM(c, 0b01, 0x05)
+	sendEEPROM(c, 0x1234, 16)
+	c.Write(0xA080, 0x00)
+	if got := readEEPROM(c, 0x05); got != 0x1234 {
+		t.Errorf("WRITE: word 0x%04X, want 0x1234", got)
+	}
+	if c.RAM[10] != 0x34 || c.RAM[11] != 0x12 {
+		t.Errorf("RAM % X, want little endian", c.RAM[10:12])
+	}
+
+	commandEEPROM(c, 0b11, 0x05) // ERASE
+	if got := readEEPROM(c, 0x05); got != 0xFFFF {
+		t.Errorf("ERASE: word 0x%04X", got)
+	}
+
+	commandEEPROM(c, 0b00, 0x40) // WRAL
+	sendEEPROM(c, 0xA55A, 16)
+	c.Write(0xA080, 0x00)
+	for _, addr := range []uint8{0x00, 0x7F} {
+		if got := readEEPROM(c, addr); got != 0xA55A {
+			t.Errorf("WRAL: word %d is 0x%04X", addr, got)
+		}
+	}
+
+	commandEEPROM(c, 0b00, 0x80) // ERAL
+	if got := readEEPROM(c, 0x7F); got != 0xFFFF {
+		t.Errorf("ERAL: word 0x%04X", got)
+	}
+
+	commandEEPROM(c, 0b00, 0x00) // EWDS
+	commandEEPROM(c, 0b11, 0x00)
+	commandEEPROM(c, 0b00, 0x80)
+	commandEEPROM(c, 0b01, 0x00)
+	sendEEPROM(c, 0x0000, 16)
+	if got := readEEPROM(c, 0x00); got != 0xFFFF {
+		t.Errorf("write after EWDS: word 0x%04X", got)
+	}
+}
+
+func TestMBC7Accelerometer(t *testing.T) {
+	c := newTestMBC7(t)
+	c.SetTilt(1, -1)
+	c.Write(0xA000, 0x55)
+	c.Write(0xA010, 0xAA)
+	x := uint16(c.Read(0xA020)) | uint16(c.Read(0xA030))<<8
+	y := uint16(c.Read(0xA040)) | uint16(c.Read(0xA050))<<8
+	if x != mbc7Center+mbc7Gravity || y != mbc7Center-mbc7Gravity {
+		t.Errorf("x 0x%04X, y 0x%04X", x, y)
+	}
+
+	// 0x55 で消さないと、もう一度ラッチできない
+	c.SetTilt(0, 0)
+	c.Write(0xA010, 0xAA)
+	if got := uint16(c.Read(0xA020)) | uint16(c.Read(0xA030))<<8; got != x {
+		t.Errorf("latched again without erasing: x 0x%04X", got)
+	}
+}
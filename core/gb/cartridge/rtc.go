@@ -0,0 +1,137 @@
+package cartridge
+
+import "time"
+
+// 1秒あたりのマスターサイクル数 (RTCはカートリッジの32768Hzの水晶で動くので、倍速モードでも変わらない)
+const rtcSecond = 8 * 1024 * 1024
+
+// Clock is the source of the wall-clock time, which the RTC of the cartridge catches up with for the time the emulator was not running.
+type Clock interface {
+	Now() time.Time
+}
+
+// FixedClock is a Clock which always returns Time, so that the RTC never catches up. (e.g. for tests and movies)
+type FixedClock struct {
+	Time time.Time
+}
+
+func (c FixedClock) Now() time.Time { return c.Time }
+
+type Time struct {
+	Sec, Min, Hour uint8
+	DayCarry       bool
+	Day            uint16
+}
+
+type RTC struct {
+	Enabled     bool // false なら止まっている (DH.6)
+	Time, Latch Time
+	Cycles      int64 // 前に1秒進んでから経過したマスターサイクル数
+}
+
+func (r *RTC) run(cycles8MHz int64) {
+	if !r.Enabled {
+		return
+	}
+	r.Cycles += cycles8MHz
+	for r.Cycles >= rtcSecond {
+		r.Cycles -= rtcSecond
+		r.Time.tick()
+	}
+}
+
+// 1秒進める
+// 範囲外の値(秒が60以上など)が書き込まれていた場合は、桁上がりせずにレジスタのビット数の上限で0に戻る
+func (t *Time) tick() {
+	if t.Sec = (t.Sec + 1) & 0x3F; t.Sec != 60 {
+		return
+	}
+	t.Sec = 0
+	if t.Min = (t.Min + 1) & 0x3F; t.Min != 60 {
+		return
+	}
+	t.Min = 0
+	if t.Hour = (t.Hour + 1) & 0x1F; t.Hour != 24 {
+		return
+	}
+	t.Hour = 0
+	if t.Day = (t.Day + 1) & 0x1FF; t.Day == 0 {
+		t.DayCarry = true
+	}
+}
+
+func (t *Time) valid() bool {
+	return t.Sec < 60 && t.Min < 60 && t.Hour < 24
+}
+
+// seconds 秒進める
+func (t *Time) advance(seconds int64) {
+	for ; seconds > 0 && !t.valid(); seconds-- { // 範囲外の値は1秒ずつ進めて正常な値に戻す
+		t.tick()
+	}
+	if seconds <= 0 {
+		return
+	}
+
+	total := ((int64(t.Day)*24+int64(t.Hour))*60+int64(t.Min))*60 + int64(t.Sec) + seconds
+	days := total / (24 * 60 * 60)
+	if days >= 512 {
+		t.DayCarry = true
+	}
+	t.Day = uint16(days % 512)
+	total %= 24 * 60 * 60
+	t.Hour, t.Min, t.Sec = uint8(total/3600), uint8(total/60%60), uint8(total%60)
+}
+
+// catchUp advances the time by the wall-clock time passed since savedAt.
+func (r *RTC) catchUp(now, savedAt time.Time) {
+	if d := int64(now.Sub(savedAt) / time.Second); r.Enabled && d > 0 {
+		r.Time.advance(d)
+	}
+}
+
+// カートリッジの時計 (MBC3のRTC, HuC3)
+type clockChip interface {
+	run(cycles8MHz int64)
+	catchUp(now, savedAt time.Time)
+	footer(now time.Time) []uint8
+	loadFooter(data []uint8) time.Time // 保存した時刻を返す (不明ならゼロ値)
+	footerSizes() []int                // 読み込めるフッタのサイズ (先頭が footer のサイズ)
+}
+
+// 時計を持つMBC (rtc は、時計が載っていないカートリッジでは nil を返す)
+type rtcMBC interface {
+	rtc() clockChip
+}
+
+// Now returns the current time of Clock.
+func (c *Cartridge) Now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock.Now()
+}
+
+// CatchUpRTC advances the RTC by the wall-clock time passed since savedAt, i.e. while the emulator was not running.
+// It does nothing for cartridges without RTC.
+func (c *Cartridge) CatchUpRTC(savedAt time.Time) {
+	if c.rtc != nil {
+		c.rtc.catchUp(c.Now(), savedAt)
+	}
+}
+
+// Run advances the components of the cartridge which run by themselves, such as RTC, the rumble motor and the camera.
+func (c *Cartridge) Run(cycles8MHz int64) {
+	if c.rtc != nil {
+		c.rtc.run(cycles8MHz)
+	}
+	if c.motor != nil {
+		c.rumble.run(c.motor.motor(), cycles8MHz)
+	}
+	if c.camera != nil {
+		c.camera.run(cycles8MHz)
+	}
+	if c.buzzer != nil {
+		c.buzzer.runBuzzer(cycles8MHz)
+	}
+}
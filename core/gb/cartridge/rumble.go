@@ -0,0 +1,30 @@
+package cartridge
+
+// 振動モーターを持つMBC (motor は、モーターが載っていないカートリッジでは常に false を返す)
+type rumbleMBC interface {
+	motor() bool
+}
+
+type rumble struct {
+	on, total int64 // 前に Rumble が呼ばれてからモーターが回っていたサイクル数と、経過したサイクル数
+}
+
+func (r *rumble) run(on bool, cycles8MHz int64) {
+	if on {
+		r.on += cycles8MHz
+	}
+	r.total += cycles8MHz
+}
+
+// Rumble returns how long the motor was on since the last call, from 0 to 1.
+// Games turn the motor on and off quickly to make weaker vibration, so this is the strength of the vibration.
+// It always returns 0 for cartridges without motor.
+func (c *Cartridge) Rumble() float64 {
+	r := &c.rumble
+	strength := 0.0
+	if r.total > 0 {
+		strength = float64(r.on) / float64(r.total)
+	}
+	r.on, r.total = 0, 0
+	return strength
+}
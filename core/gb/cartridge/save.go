@@ -0,0 +1,145 @@
+package cartridge
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+var ErrInvalidSave = errors.New("invalid save data")
+
+/*
+バッテリーバックアップのセーブファイルの形式 (VBA-M, BGB, mGBA と互換)
+
+	RAM
+	RTCのフッタ (RTCを持つカートリッジのみ)
+
+RTCのフッタはリトルエンディアンで
+
+	uint32 x5: 秒, 分, 時, 日(下位8ビット), DH(bit0: 日の最上位ビット, bit6: 停止, bit7: 繰り上がり)
+	uint32 x5: ラッチされた値 (同上)
+	uint64:    保存したときの Unix 時刻 (古い形式では uint32 で、フッタは44バイトになる)
+
+MBC2のRAMは4ビットx512なので、2つずつ1バイトに詰めた256バイトの形式も読み込める (下位4ビットが先)
+*/
+
+const rtcFooterSize, rtcFooterSize32 = 48, 44
+
+// LoadSave loads a battery save file, i.e. RAM followed by the RTC footer for cartridges with RTC.
+// The footer is optional, and the RTC catches up with the time passed since the file was saved.
+func (c *Cartridge) LoadSave(data []uint8) error {
+	if _, ok := c.MBC.(*MBC2); ok && len(data) == len(c.RAM)/2 {
+		data = unpackNibbles(data)
+	}
+
+	size := len(c.RAM)
+	var footer []uint8
+	switch n := len(data); {
+	case n == size:
+	case c.rtc != nil && slices.Contains(c.rtc.footerSizes(), n-size):
+		footer = data[size:]
+	case n < size:
+		return fmt.Errorf("%w: truncated, %d bytes for %d bytes of RAM", ErrInvalidSave, n, size)
+	default:
+		return fmt.Errorf("%w: oversized, %d bytes for %d bytes of RAM", ErrInvalidSave, n, size)
+	}
+
+	copy(c.RAM, data[:size])
+	if footer != nil {
+		savedAt := c.rtc.loadFooter(footer)
+		if !savedAt.IsZero() {
+			c.CatchUpRTC(savedAt)
+		}
+	}
+	return nil
+}
+
+// Save returns the battery save file which LoadSave reads.
+// If packed is true, the 4bit RAM of MBC2 is packed into 256 bytes. Other cartridges are not affected.
+func (c *Cartridge) Save(packed bool) []uint8 {
+	data := make([]uint8, len(c.RAM))
+	copy(data, c.RAM)
+	if _, ok := c.MBC.(*MBC2); ok && packed {
+		data = packNibbles(data)
+	}
+	if c.rtc != nil {
+		data = append(data, c.rtc.footer(c.Now())...)
+	}
+	return data
+}
+
+func (r *RTC) footer(now time.Time) []uint8 {
+	data := make([]uint8, rtcFooterSize)
+	for i, t := range []Time{r.Time, r.Latch} {
+		for j, val := range r.registers(t) {
+			binary.LittleEndian.PutUint32(data[(i*5+j)*4:], uint32(val))
+		}
+	}
+	binary.LittleEndian.PutUint64(data[40:], uint64(now.Unix()))
+	return data
+}
+
+func (r *RTC) footerSizes() []int { return []int{rtcFooterSize, rtcFooterSize32} }
+
+func (r *RTC) loadFooter(data []uint8) time.Time {
+	var regs [2][5]uint8
+	for i := range regs {
+		for j := range regs[i] {
+			regs[i][j] = uint8(binary.LittleEndian.Uint32(data[(i*5+j)*4:]))
+		}
+	}
+	r.Time, r.Latch = timeOf(regs[0]), timeOf(regs[1])
+	r.Enabled = regs[0][4]&(1<<6) == 0
+	r.Cycles = 0
+
+	var unix int64
+	if len(data) == rtcFooterSize {
+		unix = int64(binary.LittleEndian.Uint64(data[40:]))
+	} else {
+		unix = int64(binary.LittleEndian.Uint32(data[40:]))
+	}
+	if unix == 0 {
+		return time.Time{}
+	}
+	return time.Unix(unix, 0)
+}
+
+// RTCのレジスタ(0x08..0x0C)の値
+func (r *RTC) registers(t Time) [5]uint8 {
+	dh := uint8(t.Day>>8) & 0x01
+	if !r.Enabled {
+		dh |= 1 << 6
+	}
+	if t.DayCarry {
+		dh |= 1 << 7
+	}
+	return [5]uint8{t.Sec, t.Min, t.Hour, uint8(t.Day), dh}
+}
+
+func timeOf(regs [5]uint8) Time {
+	return Time{
+		Sec:      regs[0] & 0x3F,
+		Min:      regs[1] & 0x3F,
+		Hour:     regs[2] & 0x1F,
+		Day:      uint16(regs[3]) | uint16(regs[4]&0x01)<<8,
+		DayCarry: regs[4]&(1<<7) != 0,
+	}
+}
+
+func packNibbles(data []uint8) []uint8 {
+	packed := make([]uint8, len(data)/2)
+	for i := range packed {
+		packed[i] = (data[i*2] & 0x0F) | (data[i*2+1]&0x0F)<<4
+	}
+	return packed
+}
+
+func unpackNibbles(packed []uint8) []uint8 {
+	data := make([]uint8, len(packed)*2)
+	for i, b := range packed {
+		data[i*2], data[i*2+1] = b&0x0F, b>>4
+	}
+	return data
+}
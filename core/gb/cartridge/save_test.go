@@ -0,0 +1,168 @@
+package cartridge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+	"time"
+)
+
+// ヘッダとチェックサムを埋めたROMを作る
+func testROM(cartType, romSize, ramSize uint8) []uint8 {
+	rom := make([]uint8, calcROMSize(romSize))
+	copy(rom[0x134:], "TEST")
+	rom[0x147], rom[0x148], rom[0x149] = cartType, romSize, ramSize
+	fixChecksums(rom)
+	return rom
+}
+
+func fixChecksums(rom []uint8) {
+	sum := uint8(0)
+	for _, b := range rom[0x134:0x14D] {
+		sum = sum - b - 1
+	}
+	rom[0x14D] = sum
+
+	global := uint16(0)
+	for i, b := range rom {
+		if i != 0x14E && i != 0x14F {
+			global += uint16(b)
+		}
+	}
+	rom[0x14E], rom[0x14F] = uint8(global>>8), uint8(global)
+}
+
+func newTestCartridge(t *testing.T, cartType, romSize, ramSize uint8) *Cartridge {
+	t.Helper()
+	c, err := New(testROM(cartType, romSize, ramSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestRTCFooterRoundTrip(t *testing.T) {
+	savedAt := time.Unix(1_700_000_000, 0)
+	c := newTestCartridge(t, 0x10, 0x00, 0x03)
+	c.Clock = FixedClock{savedAt}
+	c.RAM[0], c.RAM[len(c.RAM)-1] = 0x12, 0x34
+	r := &c.MBC.(*MBC3).RTC
+	r.Time = Time{Sec: 59, Min: 59, Hour: 23, Day: 0x1FF}
+	r.Latch = Time{Sec: 1, Min: 2, Hour: 3, Day: 4}
+
+	data := c.Save(false)
+	if len(data) != len(c.RAM)+rtcFooterSize {
+		t.Fatalf("save is %d bytes", len(data))
+	}
+	if unix := binary.LittleEndian.Uint64(data[len(c.RAM)+40:]); unix != uint64(savedAt.Unix()) {
+		t.Errorf("timestamp %d", unix)
+	}
+
+	// 保存してから1時間後に読み込む
+	c2 := newTestCartridge(t, 0x10, 0x00, 0x03)
+	c2.Clock = FixedClock{savedAt.Add(time.Hour)}
+	if err := c2.LoadSave(data); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c2.RAM, c.RAM) {
+		t.Error("RAM was not restored")
+	}
+	r2 := &c2.MBC.(*MBC3).RTC
+	want := Time{Sec: 59, Min: 59, Hour: 0, Day: 0, DayCarry: true}
+	if r2.Time != want {
+		t.Errorf("time %+v, want %+v", r2.Time, want)
+	}
+	if r2.Latch != r.Latch {
+		t.Errorf("latch %+v, want %+v", r2.Latch, r.Latch)
+	}
+}
+
+func TestRTCFooter32(t *testing.T) {
+	savedAt := time.Unix(1_000_000, 0)
+	c := newTestCartridge(t, 0x10, 0x00, 0x03)
+	c.Clock = FixedClock{savedAt}
+	c.MBC.(*MBC3).RTC.Time = Time{Sec: 10}
+	data := c.Save(false)
+	data = data[:len(data)-4] // 古い形式は時刻が uint32
+
+	c2 := newTestCartridge(t, 0x10, 0x00, 0x03)
+	c2.Clock = FixedClock{savedAt.Add(5 * time.Second)}
+	if err := c2.LoadSave(data); err != nil {
+		t.Fatal(err)
+	}
+	if sec := c2.MBC.(*MBC3).RTC.Time.Sec; sec != 15 {
+		t.Errorf("sec %d, want 15", sec)
+	}
+}
+
+func TestStoppedRTCDoesNotCatchUp(t *testing.T) {
+	savedAt := time.Unix(1_000_000, 0)
+	c := newTestCartridge(t, 0x10, 0x00, 0x03)
+	c.Clock = FixedClock{savedAt}
+	c.MBC.(*MBC3).RTC.Enabled = false
+	data := c.Save(false)
+
+	c2 := newTestCartridge(t, 0x10, 0x00, 0x03)
+	c2.Clock = FixedClock{savedAt.Add(time.Hour)}
+	if err := c2.LoadSave(data); err != nil {
+		t.Fatal(err)
+	}
+	r := c2.MBC.(*MBC3).RTC
+	if r.Enabled || r.Time != (Time{}) {
+		t.Errorf("RTC %+v", r)
+	}
+}
+
+func TestLoadSaveSize(t *testing.T) {
+	c := newTestCartridge(t, 0x03, 0x00, 0x02)
+	for _, n := range []int{8*KB - 1, 8*KB + rtcFooterSize, 16 * KB} {
+		if err := c.LoadSave(make([]uint8, n)); !errors.Is(err, ErrInvalidSave) {
+			t.Errorf("%d bytes: %v", n, err)
+		}
+	}
+	if err := c.LoadSave(make([]uint8, 8*KB)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMBC2PackedSave(t *testing.T) {
+	c := newTestCartridge(t, 0x06, 0x00, 0x00)
+	for i := range c.RAM {
+		c.RAM[i] = uint8(i) & 0x0F
+	}
+	packed := c.Save(true)
+	if len(packed) != 256 || packed[0] != 0x10 {
+		t.Fatalf("packed save is %d bytes, first byte 0x%02X", len(packed), packed[0])
+	}
+
+	c2 := newTestCartridge(t, 0x06, 0x00, 0x00)
+	if err := c2.LoadSave(packed); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(c2.RAM, c.RAM) {
+		t.Error("MBC2 RAM was not unpacked")
+	}
+}
+
+func TestHuC3FooterRoundTrip(t *testing.T) {
+	savedAt := time.Unix(1_000_000, 0)
+	c := newTestCartridge(t, 0xFE, 0x00, 0x03)
+	c.Clock = FixedClock{savedAt}
+	m := c.MBC.(*HuC3)
+	m.Clock = HuC3Clock{Minutes: 24*60 - 30, Days: 5, AlarmMinutes: 100, AlarmDays: 6, AlarmEnabled: true}
+	data := c.Save(false)
+	if len(data) != len(c.RAM)+huc3FooterSize {
+		t.Fatalf("save is %d bytes", len(data))
+	}
+
+	c2 := newTestCartridge(t, 0xFE, 0x00, 0x03)
+	c2.Clock = FixedClock{savedAt.Add(time.Hour)}
+	if err := c2.LoadSave(data); err != nil {
+		t.Fatal(err)
+	}
+	want := HuC3Clock{Minutes: 30, Days: 6, AlarmMinutes: 100, AlarmDays: 6, AlarmEnabled: true}
+	if got := c2.MBC.(*HuC3).Clock; got != want {
+		t.Errorf("clock %+v, want %+v", got, want)
+	}
+}
@@ -47,6 +47,31 @@ func (c *Cartridge) UpdateSnapshot(snap *Snapshot) error {
 		binary.Write(tmp, binary.LittleEndian, mbc5)
 		copy(snap.Buffer[:], tmp.Bytes())
 		tmp.Reset()
+	case *MBC6:
+		mbc6 := mapper.CreateSnapshot()
+		binary.Write(tmp, binary.LittleEndian, mbc6)
+		copy(snap.Buffer[:], tmp.Bytes())
+		tmp.Reset()
+	case *MBC7:
+		mbc7 := mapper.CreateSnapshot()
+		binary.Write(tmp, binary.LittleEndian, mbc7)
+		copy(snap.Buffer[:], tmp.Bytes())
+		tmp.Reset()
+	case *PocketCamera:
+		camera := mapper.CreateSnapshot()
+		binary.Write(tmp, binary.LittleEndian, camera)
+		copy(snap.Buffer[:], tmp.Bytes())
+		tmp.Reset()
+	case *HuC1:
+		huc1 := mapper.CreateSnapshot()
+		binary.Write(tmp, binary.LittleEndian, huc1)
+		copy(snap.Buffer[:], tmp.Bytes())
+		tmp.Reset()
+	case *HuC3:
+		huc3 := mapper.CreateSnapshot()
+		binary.Write(tmp, binary.LittleEndian, huc3)
+		copy(snap.Buffer[:], tmp.Bytes())
+		tmp.Reset()
 	}
 	return nil
 }
@@ -80,6 +105,36 @@ func (c *Cartridge) RestoreSnapshot(snap *Snapshot) error {
 		binary.Read(tmp, binary.LittleEndian, &s)
 		mapper.RestoreSnapshot(&s)
 		tmp.Reset()
+	case *MBC6:
+		tmp.Write(snap.Buffer[:])
+		var s MBC6Snapshot
+		binary.Read(tmp, binary.LittleEndian, &s)
+		mapper.RestoreSnapshot(&s)
+		tmp.Reset()
+	case *MBC7:
+		tmp.Write(snap.Buffer[:])
+		var s MBC7Snapshot
+		binary.Read(tmp, binary.LittleEndian, &s)
+		mapper.RestoreSnapshot(&s)
+		tmp.Reset()
+	case *PocketCamera:
+		tmp.Write(snap.Buffer[:])
+		var s PocketCameraSnapshot
+		binary.Read(tmp, binary.LittleEndian, &s)
+		mapper.RestoreSnapshot(&s)
+		tmp.Reset()
+	case *HuC1:
+		tmp.Write(snap.Buffer[:])
+		var s HuC1Snapshot
+		binary.Read(tmp, binary.LittleEndian, &s)
+		mapper.RestoreSnapshot(&s)
+		tmp.Reset()
+	case *HuC3:
+		tmp.Write(snap.Buffer[:])
+		var s HuC3Snapshot
+		binary.Read(tmp, binary.LittleEndian, &s)
+		mapper.RestoreSnapshot(&s)
+		tmp.Reset()
 	}
 	return nil
 }
@@ -4,14 +4,17 @@ func (c *CPU) Read(addr uint16) uint8 {
 	if c.Debugger != nil {
 		c.Debugger.ReadMemoryHook(0, uint64(addr), 1)
 	}
+	return c.read(addr)
+}
 
-	if c.BIOS.FF50 {
-		if addr < 0x100 {
-			return c.BIOS.Data[addr]
-		}
-		if len(c.BIOS.Data) == 2048 && (addr >= 0x200 && addr < 0x900) {
-			return c.BIOS.Data[addr-0x100]
-		}
+// Fetch reads an opcode or an operand. Unlike Read, it doesn't call the debugger's ReadMemoryHook, so watchpoints only see data accesses.
+func (c *CPU) Fetch(addr uint16) uint8 {
+	return c.read(addr)
+}
+
+func (c *CPU) read(addr uint16) uint8 {
+	if val, ok := c.ReadBIOS(addr); ok {
+		return val
 	}
 	if addr >= 0xFF80 && addr <= 0xFFFE { // HRAM
 		return c.HRAM[addr&0x7F]
@@ -30,3 +33,16 @@ func (c *CPU) Write(addr uint16, val uint8) {
 	}
 	c.bus.Write(addr, val)
 }
+
+// ReadBIOS returns the value of the boot ROM if it is mapped at addr.
+func (c *CPU) ReadBIOS(addr uint16) (uint8, bool) {
+	if c.BIOS.FF50 {
+		if addr < 0x100 {
+			return c.BIOS.Data[addr], true
+		}
+		if len(c.BIOS.Data) == 2048 && (addr >= 0x200 && addr < 0x900) {
+			return c.BIOS.Data[addr-0x100], true
+		}
+	}
+	return 0, false
+}
@@ -2,6 +2,7 @@ package cpu
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/akatsuki105/dawngb/core/gb/cpu/sm83"
 	"github.com/akatsuki105/dawngb/internal/debugger"
@@ -29,11 +30,15 @@ type CPU struct {
 	BIOS             BIOS
 	HRAM             [0x7F]uint8
 	Halted           bool
+	Stopped          bool // STOPモード(システムクロックが止まり、ジョイパッドの入力があるまで何も動かない)
 	IE, IF           uint8
 	Key0, Key1       uint8 // FF4C, FF4D
 	FF72, FF73, FF74 uint8
 	Usage            uint32 // フレーム中のCPU使用率(haltしてないときのみカウントしたサイクル数)
 	Debugger         debugger.Debugger
+	BreakRequested   bool // デバッガによって命令の実行前に中断された (RunFrame も抜ける)
+	Tracer           *Tracer
+	sync             func(cycles8MHz int64) // SoCの外にあるコンポーネント(PPU, APU)を進める
 }
 
 // a.k.a. Boot ROM
@@ -42,16 +47,17 @@ type BIOS struct {
 	Data []uint8
 }
 
-func New(isCGB bool, bus sm83.Bus) *CPU {
+func New(isCGB bool, bus sm83.Bus, sync func(cycles8MHz int64)) *CPU {
 	c := &CPU{
 		isCGB: isCGB,
 		bus:   bus,
+		sync:  sync,
 	}
 	c.SM83 = sm83.New(c, c.halt, c.stop, c.wait)
 	c.Timer = newTimer(c.IRQ, &c.Clock)
 	c.Joypad = newJoypad(c.IRQ)
 	c.DMA = newDMA(c)
-	c.Serial = newSerial(c.IRQ)
+	c.Serial = newSerial(c.IRQ, &c.Clock, isCGB)
 	return c
 }
 
@@ -64,7 +70,7 @@ func (c *CPU) Reset() {
 	c.Joypad.reset()
 	c.Serial.reset()
 	clear(c.HRAM[:])
-	c.Halted = false
+	c.Halted, c.Stopped = false, false
 	c.IE, c.IF = 0, 0
 	c.BIOS.FF50 = true
 	c.Key0, c.Key1 = 0, 0
@@ -94,11 +100,20 @@ func (c *CPU) SkipBIOS() {
 	c.R.SP, c.R.PC = 0xFFFE, 0x0100
 }
 
+// n Mサイクル分だけ時間を進める(SM83のメモリアクセスや内部サイクルごとに呼ばれる)
 func (c *CPU) wait(n int64) {
-	c.Cycles += n * c.Clock
+	c.advance(n * c.Clock)
 	c.Usage += uint32(n * c.Clock)
 }
 
+// 他のコンポーネントをCPUに追いつかせる
+func (c *CPU) advance(cycles8MHz int64) {
+	c.Cycles += cycles8MHz
+	c.Timer.run(cycles8MHz)
+	c.Serial.run(cycles8MHz)
+	c.sync(cycles8MHz)
+}
+
 func (c *CPU) LoadBIOS(bios []uint8) error {
 	c.BIOS.FF50 = false
 
@@ -122,14 +137,23 @@ func (c *CPU) LoadBIOS(bios []uint8) error {
 }
 
 func (c *CPU) stop() {
-	if c.Key1&(1<<0) != 0 {
+	if c.isCGB && c.Key1&(1<<0) != 0 { // 速度切り替え
 		if c.Clock == 4 {
 			c.Clock = 8
 		} else {
 			c.Clock = 4
 		}
 		c.Key1 &^= 1 << 0
+		c.Timer.resetDIV()
+		return
+	}
+
+	// ボタンが押されている場合はSTOPモードに入らない
+	if c.Joypad.lines() != 0x0F {
+		return
 	}
+	c.Stopped = true
+	c.Timer.resetDIV()
 }
 
 func (c *CPU) HBlank() {
@@ -138,19 +162,32 @@ func (c *CPU) HBlank() {
 	}
 }
 
+// 1命令(または割り込み, HDMA)を実行して、経過したマスターサイクル数を返す
+// 他のコンポーネントは実行中に同期されるので、呼び出し側で進める必要はない
 func (c *CPU) Step() int64 {
-	cycles := c.step()
-	c.Timer.run(cycles)
-	c.Serial.run(cycles)
-	return cycles
-}
-
-func (c *CPU) step() int64 {
 	prev := c.Cycles
+	if c.Locked {
+		if c.idle(debugger.CPULocked) {
+			return 0
+		}
+		c.advance(c.Clock) // 時間は進むが、割り込みも含めて何も実行されない
+		return c.Cycles - prev
+	}
+	if c.Stopped {
+		if c.Joypad.lines() == 0x0F {
+			if c.idle(debugger.CPUStopped) {
+				return 0
+			}
+			c.Cycles += c.Clock // システムクロックが止まっているので他のコンポーネントは進めない
+			return c.Cycles - prev
+		}
+		c.Stopped = false
+	}
+
 	if c.DMA.doHDMA {
 		c.DMA.doHDMA = false
 		c.DMA.runHDMA()
-		c.Cycles += 64
+		c.advance(64)
 		return c.Cycles - prev
 	}
 
@@ -164,7 +201,10 @@ func (c *CPU) step() int64 {
 			c.instruction()
 		}
 	} else if c.Halted {
-		c.Cycles++
+		if c.idle(debugger.CPUHalted) {
+			return 0
+		}
+		c.advance(c.Clock) // 1Mサイクルずつ割り込みを待つ
 	} else {
 		c.instruction()
 	}
@@ -172,18 +212,42 @@ func (c *CPU) step() int64 {
 	return c.Cycles - prev
 }
 
+// 命令を実行しないステップでもデバッガが止められるようにする 止められたら true を返す
+func (c *CPU) idle(state debugger.CPUState) bool {
+	if h, ok := c.Debugger.(debugger.IdleHooker); ok {
+		h.IdleHook(uint64(c.R.PC), state)
+	}
+	return c.BreakRequested
+}
+
 func (c *CPU) instruction() {
 	if c.Debugger != nil {
 		c.Debugger.InstructionHook(0, uint64(c.R.PC))
+		if c.BreakRequested {
+			return
+		}
+	}
+	if c.Tracer != nil {
+		c.Tracer.trace(c)
 	}
+
+	pc := c.R.PC
 	c.SM83.Step()
+	if c.Locked && c.Debugger != nil {
+		c.Debugger.PrintLog(fmt.Sprintf("CPU locked up by illegal opcode 0x%02X in 0x%04X", c.peek(pc), pc))
+	}
 }
 
 // IRQ id: 0: VBLANK, 1: LCDSTAT, 2: TIMER, 3: SERIAL, 4: JOYPAD
 func (c *CPU) IRQ(id int) { c.IF |= (1 << id) }
 
 func (c *CPU) SendInputs(inputs uint8) {
-	c.Joypad.inputs = inputs
+	c.Joypad.inputs[0] = inputs
+}
+
+// SendPlayerInputs is SendInputs for the other controllers of Super Game Boy. (player: 1..3)
+func (c *CPU) SendPlayerInputs(player int, inputs uint8) {
+	c.Joypad.inputs[player] = inputs
 }
 
 func (c *CPU) checkInterrupt() int {
@@ -202,6 +266,8 @@ func (c *CPU) halt() {
 	} else {
 		if c.checkInterrupt() < 0 {
 			c.Halted = true
+		} else {
+			c.HaltBug = true // HALTせずに、次の命令の1バイト目を2回読む
 		}
 	}
 }
@@ -1,5 +1,13 @@
 package cpu
 
+// PeekIO reads the IO register like ReadIO, but without side effects. (JOYP does not poll the inputs or request the joypad interrupt)
+func (c *CPU) PeekIO(addr uint16) uint8 {
+	if addr == 0xFF00 {
+		return c.Joypad.peek()
+	}
+	return c.ReadIO(addr)
+}
+
 func (c *CPU) ReadIO(addr uint16) uint8 {
 	switch addr {
 	case 0xFF00:
@@ -67,7 +75,7 @@ func (c *CPU) WriteIO(addr uint16, val uint8) {
 	case 0xFF55:
 		if c.isCGB {
 			cycles := c.DMA.Write(addr, val)
-			c.Cycles += cycles
+			c.advance(cycles)
 		}
 	case 0xFF72:
 		c.FF72 = val
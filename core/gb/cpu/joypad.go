@@ -6,45 +6,94 @@ type Joypad struct {
 	P14, P15 bool  // P1.4, P1.5 (P14, P15 は CPUのpinの名前)
 	JOYP     uint8 // P1.0-3
 
-	inputs uint8 // ゲームの実際のキー入力を反映したもの(pollで使用), (Dpad << 4) | Buttons, 0 is pressed, 1 is not pressed
+	inputs [4]uint8 // ゲームの実際のキー入力を反映したもの(pollで使用), (Dpad << 4) | Buttons, 0 is pressed, 1 is not pressed; SGBのマルチプレイヤー以外では [0] だけ使う
+
+	// SGB is non-nil on Super Game Boy, which receives command packets through the writes to JOYP.
+	SGB *JoypadSGB
+	// OnPacket is called with every command packet received on Super Game Boy.
+	OnPacket func(packet [16]uint8)
+}
+
+/*
+SGBのコマンドパケットの送り方 (P14, P15 のパルスで1ビットずつ送る)
+
+	P14=P15=0    リセット (パケットの始まり)
+	P14=0, P15=1 ビット0
+	P14=1, P15=0 ビット1
+	P14=P15=1    各パルスの間に戻す
+
+16バイトをLSBから送った後に、ストップビットとして0を送る
+*/
+
+// JoypadSGB is the state of the joypad port of Super Game Boy.
+type JoypadSGB struct {
+	Packet  [16]uint8
+	Bits    int16 // 受信したビット数 (-1: パケットを受信していない)
+	Players uint8 // MLT_REQ で有効にしたコントローラの数 (1, 2, 4)
+	Player  uint8 // 今読み出せるコントローラ (0..3)
 }
 
 func newJoypad(irq func(n int)) *Joypad {
 	return &Joypad{
 		irq:    irq,
-		inputs: 0xFF,
+		inputs: [4]uint8{0xFF, 0xFF, 0xFF, 0xFF},
 	}
 }
 
 func (j *Joypad) reset() {
 	j.P14, j.P15 = false, false
 	j.JOYP = 0x0F
-	j.inputs = 0xFF
+	j.inputs = [4]uint8{0xFF, 0xFF, 0xFF, 0xFF}
+	if j.SGB != nil {
+		*j.SGB = JoypadSGB{Bits: -1, Players: 1}
+	}
 }
 
 // poll inputs
+func (j *Joypad) poll() {
+	j.JOYP = j.lines()
+	if j.JOYP != 0x0F {
+		j.irq(IRQ_JOYPAD)
+	}
+}
+
+// P10-P13 の状態(選択されているボタンが押されているとそのラインがLowになる)
 //
-//	bit0-3: A, B, SELECT, START
-//	bit4-7: RIGHT, LEFT, UP, DOWN
+//	inputs bit0-3: A, B, SELECT, START
+//	inputs bit4-7: RIGHT, LEFT, UP, DOWN
 //
 // 0 is pressed, 1 is not pressed
-func (j *Joypad) poll(inputs uint8) {
-	j.JOYP = 0x0F
+func (j *Joypad) lines() uint8 {
+	inputs := j.inputs[0]
+	if j.SGB != nil && j.SGB.Players > 1 {
+		inputs = j.inputs[j.SGB.Player]
+		if j.P14 && j.P15 {
+			return 0x0F - j.SGB.Player // どちらも選択していなければコントローラの番号が読める
+		}
+	}
+
+	lines := uint8(0x0F)
 	if !j.P14 {
-		j.JOYP &= (inputs >> 4) & 0x0F
+		lines &= (inputs >> 4) & 0x0F
 	}
 	if !j.P15 {
-		j.JOYP &= inputs & 0x0F
-	}
-
-	if j.JOYP != 0x0F {
-		j.irq(IRQ_JOYPAD)
+		lines &= inputs & 0x0F
 	}
+	return lines
 }
 
 func (j *Joypad) read() uint8 {
-	j.poll(j.inputs)
-	val := j.JOYP | 0xC0
+	j.poll()
+	return j.value(j.JOYP)
+}
+
+// poll せずに今のラインの状態から読める値を作る (JOYP は更新せず、割り込みも起こさない)
+func (j *Joypad) peek() uint8 {
+	return j.value(j.lines())
+}
+
+func (j *Joypad) value(lines uint8) uint8 {
+	val := lines | 0xC0
 	if j.P14 {
 		val |= (1 << 4)
 	}
@@ -55,6 +104,35 @@ func (j *Joypad) read() uint8 {
 }
 
 func (j *Joypad) write(val uint8) {
-	j.P14 = val&(1<<4) != 0
-	j.P15 = val&(1<<5) != 0
+	p14, p15 := val&(1<<4) != 0, val&(1<<5) != 0
+	if j.SGB != nil {
+		j.pulse(p14, p15)
+	}
+	j.P14, j.P15 = p14, p15
+}
+
+// SGBのパケットのビットを受け取る
+func (j *Joypad) pulse(p14, p15 bool) {
+	s := j.SGB
+	switch {
+	case !p14 && !p15:
+		s.Packet, s.Bits = [16]uint8{}, 0
+	case p14 && p15:
+		if !j.P15 && s.Players > 1 { // P15 を戻すたびに次のコントローラに切り替わる
+			s.Player = (s.Player + 1) & (s.Players - 1)
+		}
+	case j.P14 && j.P15 && s.Bits >= 0: // 前のパルスから戻っているときだけ数える
+		bit := !p15
+		if s.Bits == 128 { // ストップビット
+			s.Bits = -1
+			if !bit && j.OnPacket != nil {
+				j.OnPacket(s.Packet)
+			}
+			return
+		}
+		if bit {
+			s.Packet[s.Bits/8] |= 1 << (s.Bits % 8)
+		}
+		s.Bits++
+	}
 }
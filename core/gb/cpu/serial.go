@@ -4,46 +4,136 @@ import (
 	"math"
 )
 
+// SerialDevice is connected to the other end of the serial port. (e.g. another Game Boy over the link cable)
+type SerialDevice interface {
+	// Exchange is called for every bit clocked by this Game Boy. It receives the bit sent out (MSB first) and returns the bit sent back.
+	Exchange(out bool) (in bool)
+}
+
+// ByteSerialDevice is a SerialDevice which cannot answer each bit immediately. (e.g. a link cable over network)
+// A transfer with internal clock is passed to StartTransfer as a whole byte instead of Exchange, and is held until Serial.CompleteTransfer is called.
+type ByteSerialDevice interface {
+	SerialDevice
+	StartTransfer(out uint8)
+}
+
+// ClockedSerialDevice is a SerialDevice which is run along with the CPU.
+type ClockedSerialDevice interface {
+	SerialDevice
+	Run(cycles8MHz int64)
+}
+
 type Serial struct {
-	irq    func(int)
-	until  int64
-	SB, SC uint8
+	irq     func(int)
+	clock   *int64 // CPUのクロック(倍速モードではシリアルクロックも倍になる)
+	isCGB   bool
+	device  SerialDevice // nil なら何も繋がっていない (受信するビットは常に1)
+	byteDev ByteSerialDevice
+	clocked ClockedSerialDevice
+	until   int64 // 内部クロックで次のビットを送るまでのマスターサイクル数
+	bits    uint8 // 転送の残りビット数
+	SB, SC  uint8
 }
 
-func newSerial(irq func(int)) *Serial {
-	return &Serial{irq: irq}
+func newSerial(irq func(int), clock *int64, isCGB bool) *Serial {
+	return &Serial{irq: irq, clock: clock, isCGB: isCGB}
 }
 
 func (s *Serial) reset() {
 	s.until = math.MaxInt64
+	s.bits = 0
 	s.SB, s.SC = 0, 0
 }
 
+// Connect connects d to the serial port. If d is nil, the device is disconnected.
+func (s *Serial) Connect(d SerialDevice) {
+	s.device = d
+	s.byteDev, _ = d.(ByteSerialDevice)
+	s.clocked, _ = d.(ClockedSerialDevice)
+}
+
+// Device returns the connected device, or nil.
+func (s *Serial) Device() SerialDevice { return s.device }
+
 func (s *Serial) run(cycles8MHz int64) {
-	for i := int64(0); i < cycles8MHz; i++ {
-		s.until--
-		if s.until <= 0 {
-			s.until = math.MaxInt64
-			s.dummyTransfer()
+	if s.clocked != nil {
+		s.clocked.Run(cycles8MHz)
+	}
+	if s.SC&0x81 != 0x81 { // 内部クロックで転送中のときだけ、こちらがクロックを出す
+		return
+	}
+	s.until -= cycles8MHz
+	for s.until <= 0 && s.bits > 0 {
+		s.until += s.period()
+		in := true
+		if s.device != nil {
+			in = s.device.Exchange(s.SB&0x80 != 0)
 		}
+		s.shift(in)
+	}
+}
+
+// 内部クロックの1ビットあたりのマスターサイクル数
+// 8192Hz, CGBでSC.1が立っていれば 262144Hz (倍速モードではどちらも2倍)
+func (s *Serial) period() int64 {
+	if s.isCGB && (s.SC&(1<<1)) != 0 {
+		return 4 * (*s.clock)
 	}
+	return 128 * (*s.clock)
 }
 
 func (s *Serial) setSC(val uint8) {
 	s.SC = val
-	// 一部のソフト(ポケモンクリスタル など)は起動時にシリアル通信を実装してないと動かないのでダミーで実装
 	if (val & (1 << 7)) != 0 {
-		s.until = math.MaxInt64
+		s.bits = 8
+		s.until = math.MaxInt64 // 外部クロックなら相手がクロックを出すまで待つ
 		if (s.SC & (1 << 0)) != 0 {
-			s.until = 512 * 8
+			if s.byteDev != nil {
+				s.byteDev.StartTransfer(s.SB) // CompleteTransfer が呼ばれるまで待つ
+			} else {
+				s.until = s.period()
+			}
 		}
 	}
 }
 
-// ポケモンクリスタルの起動にシリアル通信機能が必要なので暫定措置
-func (s *Serial) dummyTransfer() {
+// CompleteTransfer finishes the transfer with internal clock passed to ByteSerialDevice.StartTransfer, receiving in.
+func (s *Serial) CompleteTransfer(in uint8) {
+	if s.SC&0x81 != 0x81 || s.bits == 0 {
+		return
+	}
+	s.SB = in
+	s.complete()
+}
+
+// Exchange receives one bit clocked by the device on the other end and returns the bit shifted out.
+// Only a transfer with external clock is shifted, otherwise it returns 1 as if nothing is connected.
+// This makes Serial itself a SerialDevice, so that two Game Boys can be connected to each other.
+func (s *Serial) Exchange(in bool) bool {
+	if s.SC&0x81 != 0x80 || s.bits == 0 {
+		return true
+	}
+	out := s.SB&0x80 != 0
+	s.shift(in)
+	return out
+}
+
+// MSBから送り出して、LSBに受け取ったビットを入れる 8ビット送ったら転送完了
+func (s *Serial) shift(in bool) {
+	s.SB <<= 1
+	if in {
+		s.SB |= 1
+	}
+	s.bits--
+	if s.bits == 0 {
+		s.complete()
+	}
+}
+
+func (s *Serial) complete() {
+	s.bits = 0
 	s.SC &= 0x7F
-	s.SB = 0xFF
+	s.until = math.MaxInt64
 	s.irq(IRQ_SERIAL)
 }
 
@@ -51,7 +141,8 @@ type SerialSnapshot struct {
 	Header   uint64
 	Until    int64
 	SB, SC   uint8
-	Reserved [14]uint8
+	Bits     uint8
+	Reserved [13]uint8
 }
 
 func (s *Serial) CreateSnapshot() SerialSnapshot {
@@ -59,11 +150,16 @@ func (s *Serial) CreateSnapshot() SerialSnapshot {
 		Until: s.until,
 		SB:    s.SB,
 		SC:    s.SC,
+		Bits:  s.bits,
 	}
 }
 
 func (s *Serial) RestoreSnapshot(snap SerialSnapshot) bool {
 	s.until = snap.Until
 	s.SB, s.SC = snap.SB, snap.SC
+	s.bits = snap.Bits
+	if s.bits == 0 && (s.SC&0x80) != 0 { // Bits が無かった頃のステート
+		s.bits = 8
+	}
 	return true
 }
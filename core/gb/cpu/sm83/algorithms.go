@@ -1,17 +1,12 @@
 package sm83
 
 import (
-	"fmt"
-
 	"github.com/akatsuki105/dawngb/core/gb/internal"
 )
 
-func todo(c *SM83) {
-	if c.inst.CB {
-		panic(fmt.Sprintf("todo opcode: 0xCB+0x%02X in 0x%04X", c.inst.Opcode, c.inst.Addr))
-	} else {
-		panic(fmt.Sprintf("todo opcode: 0x%02X in 0x%04X", c.inst.Opcode, c.inst.Addr))
-	}
+// 未定義命令を実行するとCPUはハングする
+func lockup(c *SM83) {
+	c.Locked = true
 }
 
 func (c *SM83) branch(dst uint16) {
@@ -21,19 +16,19 @@ func (c *SM83) branch(dst uint16) {
 
 func (c *SM83) push8(val uint8) {
 	c.R.SP--
-	c.bus.Write(c.R.SP, val)
-	c.tick(1)
+	c.write(c.R.SP, val)
 }
 
+// SPをデクリメントする内部サイクルの後に上位、下位の順で書き込む
 func (c *SM83) push16(val uint16) {
+	c.tick(1)
 	c.push8(uint8(val >> 8))
 	c.push8(uint8(val))
 }
 
 func (c *SM83) pop8() uint8 {
-	val := c.bus.Read(c.R.SP)
+	val := c.read(c.R.SP)
 	c.R.SP++
-	c.tick(1)
 	return val
 }
 
@@ -44,7 +39,7 @@ func (c *SM83) pop16() uint16 {
 }
 
 func (c *SM83) Interrupt(id int) {
-	c.tick(2)
+	c.tick(1)
 	c.IME = false
 	c.push16(c.R.PC)
 	c.branch([5]uint16{0x40, 0x48, 0x50, 0x58, 0x60}[id])
@@ -59,9 +54,10 @@ func (c *SM83) ret() {
 	c.branch(c.pop16())
 }
 
+// push16 の内部サイクルがあるので、PCの書き換えにはサイクルがかからない
 func (c *SM83) call(dst uint16) {
 	c.push16(c.R.PC)
-	c.branch(dst)
+	c.R.PC = dst
 }
 
 func (c *SM83) cp(val uint8) {
@@ -88,9 +84,9 @@ func (c *SM83) sub(val uint8, carry bool) {
 
 func (c *SM83) set_hl(bit int, b bool) {
 	hl := c.R.HL.Pack()
-	val := c.bus.Read(hl)
+	val := c.read(hl)
 	val = internal.SetBit(val, bit, b)
-	c.bus.Write(hl, val)
+	c.write(hl, val)
 }
 
 func (c *SM83) rr(r *uint8) {
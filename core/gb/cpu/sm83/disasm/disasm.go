@@ -0,0 +1,84 @@
+// Package disasm provides a disassembler for the SM83 instruction set.
+package disasm
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/akatsuki105/dawngb/core/gb/cartridge"
+	"github.com/akatsuki105/dawngb/core/gb/cpu/sm83"
+)
+
+// BankedBus is a bus that knows which ROM bank is mapped to 0x4000..7FFF.
+// If the bus passed to Disassemble implements it, jump targets in ROM are shown with the bank number. (e.g. "$03:4A10")
+type BankedBus interface {
+	sm83.Bus
+	ROMBankNumber() uint16
+}
+
+type cartBus struct {
+	sm83.Bus
+	cart *cartridge.Cartridge
+}
+
+func (b *cartBus) ROMBankNumber() uint16 { return b.cart.ROMBankNumber() }
+
+// WithCartridge returns a bus that reads through bus and reports the current ROM bank of cart.
+func WithCartridge(bus sm83.Bus, cart *cartridge.Cartridge) BankedBus {
+	return &cartBus{Bus: bus, cart: cart}
+}
+
+// Disassemble decodes the instruction at addr and returns its mnemonic and length in bytes.
+// Illegal opcodes are returned as "db $XX" with length 1.
+func Disassemble(bus sm83.Bus, addr uint16) (text string, length int) {
+	opcode := bus.Read(addr)
+	if opcode == 0xCB {
+		return cbTable[bus.Read(addr+1)], 2
+	}
+
+	mnemonic := opTable[opcode]
+	if mnemonic == "" {
+		return fmt.Sprintf("db $%02X", opcode), 1
+	}
+	if opcode == 0x10 { // stop は2バイト命令
+		return mnemonic, 2
+	}
+
+	u8 := func() uint8 { return bus.Read(addr + 1) }
+	u16 := func() uint16 { return uint16(bus.Read(addr+1)) | uint16(bus.Read(addr+2))<<8 }
+
+	operands := []struct {
+		placeholder string
+		length      int
+		format      func() string
+	}{
+		{"n16", 2, func() string { return fmt.Sprintf("$%04X", u16()) }},
+		{"a16", 2, func() string { return fmt.Sprintf("$%04X", u16()) }},
+		{"j16", 2, func() string { return formatTarget(bus, u16()) }},
+		{"n8", 1, func() string { return fmt.Sprintf("$%02X", u8()) }},
+		{"a8", 1, func() string { return fmt.Sprintf("$FF%02X", u8()) }},
+		{"e8", 1, func() string { return formatTarget(bus, addr+2+uint16(int8(u8()))) }},
+		{"s8", 1, func() string { return fmt.Sprintf("%d", int8(u8())) }},
+	}
+	for _, op := range operands {
+		if strings.Contains(mnemonic, op.placeholder) {
+			text = strings.Replace(mnemonic, op.placeholder, op.format(), 1)
+			return strings.Replace(text, "+-", "-", 1), 1 + op.length // sp+-2 -> sp-2
+		}
+	}
+	return mnemonic, 1
+}
+
+// ROM内のジャンプ先はバンク番号を付けて表示する
+func formatTarget(bus sm83.Bus, target uint16) string {
+	b, ok := bus.(BankedBus)
+	if !ok || target >= 0x8000 {
+		return fmt.Sprintf("$%04X", target)
+	}
+
+	bank := uint16(0)
+	if target >= 0x4000 {
+		bank = b.ROMBankNumber()
+	}
+	return fmt.Sprintf("$%02X:%04X", bank, target)
+}
@@ -0,0 +1,83 @@
+package disasm
+
+import (
+	"testing"
+
+	"github.com/akatsuki105/dawngb/core/gb/cpu/sm83"
+)
+
+type memBus struct {
+	mem     [0x10000]uint8
+	fetches int
+}
+
+func (b *memBus) Read(addr uint16) uint8          { return b.mem[addr] }
+func (b *memBus) Write(addr uint16, val uint8)    { b.mem[addr] = val }
+func (b *memBus) Fetch(addr uint16) uint8         { b.fetches++; return b.mem[addr] }
+func (b *memBus) load(addr uint16, data ...uint8) { copy(b.mem[addr:], data) }
+
+// sm83 で実際に実行して、命令が読んだバイト数を数える
+func executedLength(t *testing.T, code ...uint8) int {
+	t.Helper()
+	const start = 0x8000 // ジャンプ先(0x0000..0x0038)と区別できるように
+	bus := &memBus{}
+	bus.load(start, code...)
+	c := sm83.New(bus, func() {}, func() {}, func(int64) {})
+	c.R.PC = start
+	c.Step()
+
+	n := bus.fetches
+	if d := int(c.R.PC - start); d > n && d <= 3 { // stop はフェッチせずに PC を進める
+		n = d
+	}
+	return n
+}
+
+func TestLengthMatchesSM83(t *testing.T) {
+	for op := range 256 {
+		if op == 0xCB {
+			continue
+		}
+		bus := &memBus{}
+		bus.load(0, uint8(op))
+		text, length := Disassemble(bus, 0)
+		if want := executedLength(t, uint8(op)); length != want {
+			t.Errorf("opcode $%02X (%s): length %d, sm83 reads %d bytes", op, text, length, want)
+		}
+	}
+	for op := range 256 {
+		bus := &memBus{}
+		bus.load(0, 0xCB, uint8(op))
+		text, length := Disassemble(bus, 0)
+		if want := executedLength(t, 0xCB, uint8(op)); length != want {
+			t.Errorf("opcode $CB $%02X (%s): length %d, sm83 reads %d bytes", op, text, length, want)
+		}
+	}
+}
+
+func TestDisassemble(t *testing.T) {
+	tests := []struct {
+		code   []uint8
+		text   string
+		length int
+	}{
+		{[]uint8{0x00}, "nop", 1},
+		{[]uint8{0x01, 0x34, 0x12}, "ld bc, $1234", 3},
+		{[]uint8{0x18, 0xFE}, "jr $0100", 2},
+		{[]uint8{0xE0, 0x40}, "ldh ($FF40), a", 2},
+		{[]uint8{0xE8, 0xFE}, "add sp, -2", 2},
+		{[]uint8{0xF8, 0xFE}, "ld hl, sp-2", 2},
+		{[]uint8{0xCD, 0x00, 0xC0}, "call $C000", 3},
+		{[]uint8{0x10, 0x00}, "stop", 2},
+		{[]uint8{0xCB, 0x7E}, "bit 7, (hl)", 2},
+		{[]uint8{0xD3}, "db $D3", 1},
+	}
+	for _, tt := range tests {
+		bus := &memBus{}
+		bus.load(0x100, tt.code...)
+		text, length := Disassemble(bus, 0x100)
+		if text != tt.text || length != tt.length {
+			t.Errorf("% X: got %q (%d), want %q (%d)", tt.code, text, length, tt.text, tt.length)
+		}
+	}
+}
@@ -0,0 +1,53 @@
+package disasm
+
+/*
+オペランドのプレースホルダ
+  - n8:  即値(8bit)
+  - n16: 即値(16bit)
+  - a8:  0xFF00 + 即値(8bit)
+  - a16: アドレス(16bit)
+  - j16: ジャンプ先の絶対アドレス(16bit)
+  - e8:  ジャンプ先の相対アドレス(符号付き8bit)
+  - s8:  符号付き即値(8bit)
+*/
+var opTable = [256]string{
+	/* 0x00 */ "nop", "ld bc, n16", "ld (bc), a", "inc bc", "inc b", "dec b", "ld b, n8", "rlca", "ld (a16), sp", "add hl, bc", "ld a, (bc)", "dec bc", "inc c", "dec c", "ld c, n8", "rrca",
+	/* 0x10 */ "stop", "ld de, n16", "ld (de), a", "inc de", "inc d", "dec d", "ld d, n8", "rla", "jr e8", "add hl, de", "ld a, (de)", "dec de", "inc e", "dec e", "ld e, n8", "rra",
+	/* 0x20 */ "jr nz, e8", "ld hl, n16", "ld (hl+), a", "inc hl", "inc h", "dec h", "ld h, n8", "daa", "jr z, e8", "add hl, hl", "ld a, (hl+)", "dec hl", "inc l", "dec l", "ld l, n8", "cpl",
+	/* 0x30 */ "jr nc, e8", "ld sp, n16", "ld (hl-), a", "inc sp", "inc (hl)", "dec (hl)", "ld (hl), n8", "scf", "jr c, e8", "add hl, sp", "ld a, (hl-)", "dec sp", "inc a", "dec a", "ld a, n8", "ccf",
+	/* 0x40 */ "ld b, b", "ld b, c", "ld b, d", "ld b, e", "ld b, h", "ld b, l", "ld b, (hl)", "ld b, a", "ld c, b", "ld c, c", "ld c, d", "ld c, e", "ld c, h", "ld c, l", "ld c, (hl)", "ld c, a",
+	/* 0x50 */ "ld d, b", "ld d, c", "ld d, d", "ld d, e", "ld d, h", "ld d, l", "ld d, (hl)", "ld d, a", "ld e, b", "ld e, c", "ld e, d", "ld e, e", "ld e, h", "ld e, l", "ld e, (hl)", "ld e, a",
+	/* 0x60 */ "ld h, b", "ld h, c", "ld h, d", "ld h, e", "ld h, h", "ld h, l", "ld h, (hl)", "ld h, a", "ld l, b", "ld l, c", "ld l, d", "ld l, e", "ld l, h", "ld l, l", "ld l, (hl)", "ld l, a",
+	/* 0x70 */ "ld (hl), b", "ld (hl), c", "ld (hl), d", "ld (hl), e", "ld (hl), h", "ld (hl), l", "halt", "ld (hl), a", "ld a, b", "ld a, c", "ld a, d", "ld a, e", "ld a, h", "ld a, l", "ld a, (hl)", "ld a, a",
+	/* 0x80 */ "add a, b", "add a, c", "add a, d", "add a, e", "add a, h", "add a, l", "add a, (hl)", "add a, a", "adc a, b", "adc a, c", "adc a, d", "adc a, e", "adc a, h", "adc a, l", "adc a, (hl)", "adc a, a",
+	/* 0x90 */ "sub a, b", "sub a, c", "sub a, d", "sub a, e", "sub a, h", "sub a, l", "sub a, (hl)", "sub a, a", "sbc a, b", "sbc a, c", "sbc a, d", "sbc a, e", "sbc a, h", "sbc a, l", "sbc a, (hl)", "sbc a, a",
+	/* 0xA0 */ "and a, b", "and a, c", "and a, d", "and a, e", "and a, h", "and a, l", "and a, (hl)", "and a, a", "xor a, b", "xor a, c", "xor a, d", "xor a, e", "xor a, h", "xor a, l", "xor a, (hl)", "xor a, a",
+	/* 0xB0 */ "or a, b", "or a, c", "or a, d", "or a, e", "or a, h", "or a, l", "or a, (hl)", "or a, a", "cp a, b", "cp a, c", "cp a, d", "cp a, e", "cp a, h", "cp a, l", "cp a, (hl)", "cp a, a",
+	/* 0xC0 */ "ret nz", "pop bc", "jp nz, j16", "jp j16", "call nz, j16", "push bc", "add a, n8", "rst $00", "ret z", "ret", "jp z, j16", "", "call z, j16", "call j16", "adc a, n8", "rst $08",
+	/* 0xD0 */ "ret nc", "pop de", "jp nc, j16", "", "call nc, j16", "push de", "sub a, n8", "rst $10", "ret c", "reti", "jp c, j16", "", "call c, j16", "", "sbc a, n8", "rst $18",
+	/* 0xE0 */ "ldh (a8), a", "pop hl", "ld ($FF00+c), a", "", "", "push hl", "and a, n8", "rst $20", "add sp, s8", "jp hl", "ld (a16), a", "", "", "", "xor a, n8", "rst $28",
+	/* 0xF0 */ "ldh a, (a8)", "pop af", "ld a, ($FF00+c)", "di", "", "push af", "or a, n8", "rst $30", "ld hl, sp+s8", "ld sp, hl", "ld a, (a16)", "ei", "", "", "cp a, n8", "rst $38",
+}
+
+// CB命令は規則的なのでテーブルを生成する
+var cbTable = func() [256]string {
+	ops := [8]string{"rlc", "rrc", "rl", "rr", "sla", "sra", "swap", "srl"}
+	regs := [8]string{"b", "c", "d", "e", "h", "l", "(hl)", "a"}
+
+	table := [256]string{}
+	for i := range 256 {
+		reg := regs[i&0b111]
+		bit := (i >> 3) & 0b111
+		switch i >> 6 {
+		case 0:
+			table[i] = ops[bit] + " " + reg
+		case 1:
+			table[i] = "bit " + string(rune('0'+bit)) + ", " + reg
+		case 2:
+			table[i] = "res " + string(rune('0'+bit)) + ", " + reg
+		case 3:
+			table[i] = "set " + string(rune('0'+bit)) + ", " + reg
+		}
+	}
+	return table
+}()
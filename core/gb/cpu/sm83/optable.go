@@ -21,28 +21,9 @@ var opTable = [256]opcode{
 	/* 0xA0 */ opA0, opA1, opA2, opA3, opA4, opA5, opA6, opA7, opA8, opA9, opAA, opAB, opAC, opAD, opAE, opAF,
 	/* 0xB0 */ opB0, opB1, opB2, opB3, opB4, opB5, opB6, opB7, opB8, opB9, opBA, opBB, opBC, opBD, opBE, opBF,
 	/* 0xC0 */ opC0, opC1, opC2, opC3, opC4, opC5, opC6, opC7, opC8, opC9, opCA, opCB, opCC, opCD, opCE, opCF,
-	/* 0xD0 */ opD0, opD1, opD2, todo, opD4, opD5, opD6, opD7, opD8, opD9, opDA, todo, opDC, todo, opDE, opDF,
-	/* 0xE0 */ opE0, opE1, opE2, todo, todo, opE5, opE6, opE7, opE8, opE9, opEA, todo, todo, todo, opEE, opEF,
-	/* 0xF0 */ opF0, opF1, opF2, opF3, todo, opF5, opF6, opF7, opF8, opF9, opFA, opFB, todo, todo, opFE, opFF,
-}
-
-var opCycles = [256]int64{
-	/* 0x00 */ 1, 3, 2, 2, 1, 1, 2, 1, 5, 2, 2, 2, 1, 1, 2, 1,
-	/* 0x10 */ 1, 3, 2, 2, 1, 1, 2, 1, 2, 2, 2, 2, 1, 1, 2, 1,
-	/* 0x20 */ 2, 3, 2, 2, 1, 1, 2, 1, 2, 2, 2, 2, 1, 1, 2, 1,
-	/* 0x30 */ 2, 3, 2, 2, 3, 3, 3, 1, 2, 2, 2, 2, 1, 1, 2, 1,
-	/* 0x40 */ 1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
-	/* 0x50 */ 1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
-	/* 0x60 */ 1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
-	/* 0x70 */ 2, 2, 2, 2, 2, 2, 0, 2, 1, 1, 1, 1, 1, 1, 2, 1,
-	/* 0x80 */ 1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
-	/* 0x90 */ 1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
-	/* 0xA0 */ 1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
-	/* 0xB0 */ 1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
-	/* 0xC0 */ 2, 1, 3, 3, 3, 2, 2, 1, 2, 1, 3, 0, 3, 3, 2, 1,
-	/* 0xD0 */ 2, 1, 3, 0, 3, 2, 2, 1, 2, 1, 3, 0, 3, 0, 2, 1,
-	/* 0xE0 */ 3, 1, 2, 0, 0, 2, 2, 1, 4, 0, 4, 0, 0, 0, 2, 1,
-	/* 0xF0 */ 3, 1, 2, 1, 0, 2, 2, 1, 3, 2, 4, 1, 0, 0, 2, 1,
+	/* 0xD0 */ opD0, opD1, opD2, lockup, opD4, opD5, opD6, opD7, opD8, opD9, opDA, lockup, opDC, lockup, opDE, opDF,
+	/* 0xE0 */ opE0, opE1, opE2, lockup, lockup, opE5, opE6, opE7, opE8, opE9, opEA, lockup, lockup, lockup, opEE, opEF,
+	/* 0xF0 */ opF0, opF1, opF2, opF3, lockup, opF5, opF6, opF7, opF8, opF9, opFA, opFB, lockup, lockup, opFE, opFF,
 }
 
 func op00(c *SM83) { /* nop */ }
@@ -53,9 +34,12 @@ func op01(c *SM83) {
 	c.R.BC.Unpack((hi << 8) | lo)
 }
 
-func op02(c *SM83) { c.bus.Write(c.R.BC.Pack(), c.R.A) }
+func op02(c *SM83) { c.write(c.R.BC.Pack(), c.R.A) }
 
-func op03(c *SM83) { c.R.BC.Unpack(c.R.BC.Pack() + 1) }
+func op03(c *SM83) {
+	c.R.BC.Unpack(c.R.BC.Pack() + 1)
+	c.tick(1)
+}
 
 func op04(c *SM83) {
 	c.R.BC.Hi++
@@ -81,8 +65,8 @@ func op08(c *SM83) {
 	lo := uint16(c.fetch())
 	hi := uint16(c.fetch())
 	addr := (hi << 8) | lo
-	c.bus.Write(addr, uint8(c.R.SP))
-	c.bus.Write(addr+1, uint8(c.R.SP>>8))
+	c.write(addr, uint8(c.R.SP))
+	c.write(addr+1, uint8(c.R.SP>>8))
 }
 
 func op09(c *SM83) {
@@ -90,11 +74,15 @@ func op09(c *SM83) {
 	bc := c.R.BC.Pack()
 	c.R.HL.Unpack(hl + bc)
 	c.R.F.n, c.R.F.h, c.R.F.c = false, ((hl&0x0FFF)+(bc&0x0FFF) > 0x0FFF), (uint(hl)+uint(bc) > 0xFFFF)
+	c.tick(1)
 }
 
-func op0A(c *SM83) { c.R.A = c.bus.Read(c.R.BC.Pack()) }
+func op0A(c *SM83) { c.R.A = c.read(c.R.BC.Pack()) }
 
-func op0B(c *SM83) { c.R.BC.Unpack(c.R.BC.Pack() - 1) }
+func op0B(c *SM83) {
+	c.R.BC.Unpack(c.R.BC.Pack() - 1)
+	c.tick(1)
+}
 
 func op0C(c *SM83) {
 	c.R.BC.Lo++
@@ -127,9 +115,12 @@ func op11(c *SM83) {
 	c.R.DE.Unpack((hi << 8) | lo)
 }
 
-func op12(c *SM83) { c.bus.Write(c.R.DE.Pack(), c.R.A) }
+func op12(c *SM83) { c.write(c.R.DE.Pack(), c.R.A) }
 
-func op13(c *SM83) { c.R.DE.Unpack(c.R.DE.Pack() + 1) }
+func op13(c *SM83) {
+	c.R.DE.Unpack(c.R.DE.Pack() + 1)
+	c.tick(1)
+}
 
 func op14(c *SM83) {
 	c.R.DE.Hi++
@@ -163,11 +154,15 @@ func op19(c *SM83) {
 	c.R.F.n = false
 	c.R.F.h = (hl&0x0FFF)+(de&0x0FFF) > 0x0FFF
 	c.R.F.c = uint(hl)+uint(de) > 0xFFFF
+	c.tick(1)
 }
 
-func op1A(c *SM83) { c.R.A = c.bus.Read(c.R.DE.Pack()) }
+func op1A(c *SM83) { c.R.A = c.read(c.R.DE.Pack()) }
 
-func op1B(c *SM83) { c.R.DE.Unpack(c.R.DE.Pack() - 1) }
+func op1B(c *SM83) {
+	c.R.DE.Unpack(c.R.DE.Pack() - 1)
+	c.tick(1)
+}
 
 func op1C(c *SM83) {
 	c.R.DE.Lo++
@@ -203,11 +198,14 @@ func op21(c *SM83) {
 }
 
 func op22(c *SM83) {
-	c.bus.Write(c.R.HL.Pack(), c.R.A)
+	c.write(c.R.HL.Pack(), c.R.A)
 	c.R.HL.Unpack(c.R.HL.Pack() + 1)
 }
 
-func op23(c *SM83) { c.R.HL.Unpack(c.R.HL.Pack() + 1) }
+func op23(c *SM83) {
+	c.R.HL.Unpack(c.R.HL.Pack() + 1)
+	c.tick(1)
+}
 
 func op24(c *SM83) {
 	c.R.HL.Hi++
@@ -256,14 +254,18 @@ func op29(c *SM83) {
 	result := uint32(hl) + uint32(hl)
 	c.R.HL.Unpack(uint16(result))
 	c.R.F.n, c.R.F.h, c.R.F.c = false, ((hl&0x0FFF)+(hl&0x0FFF) > 0x0FFF), (result > 0xFFFF)
+	c.tick(1)
 }
 
 func op2A(c *SM83) {
-	c.R.A = c.bus.Read(c.R.HL.Pack())
+	c.R.A = c.read(c.R.HL.Pack())
 	c.R.HL.Unpack(c.R.HL.Pack() + 1)
 }
 
-func op2B(c *SM83) { c.R.HL.Unpack(c.R.HL.Pack() - 1) }
+func op2B(c *SM83) {
+	c.R.HL.Unpack(c.R.HL.Pack() - 1)
+	c.tick(1)
+}
 
 func op2C(c *SM83) {
 	c.R.HL.Lo++
@@ -297,32 +299,35 @@ func op31(c *SM83) {
 }
 
 func op32(c *SM83) {
-	c.bus.Write(c.R.HL.Pack(), c.R.A)
+	c.write(c.R.HL.Pack(), c.R.A)
 	c.R.HL.Unpack(c.R.HL.Pack() - 1)
 }
 
-func op33(c *SM83) { c.R.SP++ }
+func op33(c *SM83) {
+	c.R.SP++
+	c.tick(1)
+}
 
 func op34(c *SM83) {
 	hl := c.R.HL.Pack()
-	val := c.bus.Read(hl)
+	val := c.read(hl)
 	val++
-	c.bus.Write(hl, val)
+	c.write(hl, val)
 	c.R.F.z, c.R.F.n, c.R.F.h = (val == 0), false, (val&0x0F == 0x00)
 }
 
 func op35(c *SM83) {
 	hl := c.R.HL.Pack()
-	val := c.bus.Read(hl)
+	val := c.read(hl)
 	val--
-	c.bus.Write(hl, val)
+	c.write(hl, val)
 	c.R.F.z, c.R.F.n, c.R.F.h = (val == 0), true, (val&0x0F == 0x0F)
 }
 
 func op36(c *SM83) {
 	hl := c.R.HL.Pack()
 	val := c.fetch()
-	c.bus.Write(hl, val)
+	c.write(hl, val)
 }
 
 func op37(c *SM83) { c.R.F.n, c.R.F.h, c.R.F.c = false, false, true }
@@ -340,14 +345,18 @@ func op39(c *SM83) {
 	result := uint32(sp) + uint32(hl)
 	c.R.HL.Unpack(uint16(result))
 	c.R.F.n, c.R.F.h, c.R.F.c = false, ((sp&0x0FFF)+(hl&0x0FFF) > 0x0FFF), (result > 0xFFFF)
+	c.tick(1)
 }
 
 func op3A(c *SM83) {
-	c.R.A = c.bus.Read(c.R.HL.Pack())
+	c.R.A = c.read(c.R.HL.Pack())
 	c.R.HL.Unpack(c.R.HL.Pack() - 1)
 }
 
-func op3B(c *SM83) { c.R.SP-- }
+func op3B(c *SM83) {
+	c.R.SP--
+	c.tick(1)
+}
 
 func op3C(c *SM83) {
 	c.R.A++
@@ -375,7 +384,7 @@ func op44(c *SM83) { c.R.BC.Hi = c.R.HL.Hi }
 
 func op45(c *SM83) { c.R.BC.Hi = c.R.HL.Lo }
 
-func op46(c *SM83) { c.R.BC.Hi = c.bus.Read(c.R.HL.Pack()) }
+func op46(c *SM83) { c.R.BC.Hi = c.read(c.R.HL.Pack()) }
 
 func op47(c *SM83) { c.R.BC.Hi = c.R.A }
 
@@ -391,7 +400,7 @@ func op4C(c *SM83) { c.R.BC.Lo = c.R.HL.Hi }
 
 func op4D(c *SM83) { c.R.BC.Lo = c.R.HL.Lo }
 
-func op4E(c *SM83) { c.R.BC.Lo = c.bus.Read(c.R.HL.Pack()) }
+func op4E(c *SM83) { c.R.BC.Lo = c.read(c.R.HL.Pack()) }
 
 func op4F(c *SM83) { c.R.BC.Lo = c.R.A }
 
@@ -407,7 +416,7 @@ func op54(c *SM83) { c.R.DE.Hi = c.R.HL.Hi }
 
 func op55(c *SM83) { c.R.DE.Hi = c.R.HL.Lo }
 
-func op56(c *SM83) { c.R.DE.Hi = c.bus.Read(c.R.HL.Pack()) }
+func op56(c *SM83) { c.R.DE.Hi = c.read(c.R.HL.Pack()) }
 
 func op57(c *SM83) { c.R.DE.Hi = c.R.A }
 
@@ -424,7 +433,7 @@ func op5C(c *SM83) { c.R.DE.Lo = c.R.HL.Hi }
 
 func op5D(c *SM83) { c.R.DE.Lo = c.R.HL.Lo }
 
-func op5E(c *SM83) { c.R.DE.Lo = c.bus.Read(c.R.HL.Pack()) }
+func op5E(c *SM83) { c.R.DE.Lo = c.read(c.R.HL.Pack()) }
 
 func op5F(c *SM83) { c.R.DE.Lo = c.R.A }
 
@@ -440,7 +449,7 @@ func op64(c *SM83) { /* ld h, h */ }
 
 func op65(c *SM83) { c.R.HL.Hi = c.R.HL.Lo }
 
-func op66(c *SM83) { c.R.HL.Hi = c.bus.Read(c.R.HL.Pack()) }
+func op66(c *SM83) { c.R.HL.Hi = c.read(c.R.HL.Pack()) }
 
 func op67(c *SM83) { c.R.HL.Hi = c.R.A }
 
@@ -456,25 +465,25 @@ func op6C(c *SM83) { c.R.HL.Lo = c.R.HL.Hi }
 
 func op6D(c *SM83) { /* ld l, l */ }
 
-func op6E(c *SM83) { c.R.HL.Lo = c.bus.Read(c.R.HL.Pack()) }
+func op6E(c *SM83) { c.R.HL.Lo = c.read(c.R.HL.Pack()) }
 
 func op6F(c *SM83) { c.R.HL.Lo = c.R.A }
 
-func op70(c *SM83) { c.bus.Write(c.R.HL.Pack(), c.R.BC.Hi) }
+func op70(c *SM83) { c.write(c.R.HL.Pack(), c.R.BC.Hi) }
 
-func op71(c *SM83) { c.bus.Write(c.R.HL.Pack(), c.R.BC.Lo) }
+func op71(c *SM83) { c.write(c.R.HL.Pack(), c.R.BC.Lo) }
 
-func op72(c *SM83) { c.bus.Write(c.R.HL.Pack(), c.R.DE.Hi) }
+func op72(c *SM83) { c.write(c.R.HL.Pack(), c.R.DE.Hi) }
 
-func op73(c *SM83) { c.bus.Write(c.R.HL.Pack(), c.R.DE.Lo) }
+func op73(c *SM83) { c.write(c.R.HL.Pack(), c.R.DE.Lo) }
 
-func op74(c *SM83) { c.bus.Write(c.R.HL.Pack(), c.R.HL.Hi) }
+func op74(c *SM83) { c.write(c.R.HL.Pack(), c.R.HL.Hi) }
 
-func op75(c *SM83) { c.bus.Write(c.R.HL.Pack(), c.R.HL.Lo) }
+func op75(c *SM83) { c.write(c.R.HL.Pack(), c.R.HL.Lo) }
 
 func op76(c *SM83) { c.halt() }
 
-func op77(c *SM83) { c.bus.Write(c.R.HL.Pack(), c.R.A) }
+func op77(c *SM83) { c.write(c.R.HL.Pack(), c.R.A) }
 
 func op78(c *SM83) { c.R.A = c.R.BC.Hi }
 
@@ -488,7 +497,7 @@ func op7C(c *SM83) { c.R.A = c.R.HL.Hi }
 
 func op7D(c *SM83) { c.R.A = c.R.HL.Lo }
 
-func op7E(c *SM83) { c.R.A = c.bus.Read(c.R.HL.Pack()) }
+func op7E(c *SM83) { c.R.A = c.read(c.R.HL.Pack()) }
 
 func op7F(c *SM83) { /* ld a, a */ }
 
@@ -504,7 +513,7 @@ func op84(c *SM83) { c.add(c.R.HL.Hi, false) }
 
 func op85(c *SM83) { c.add(c.R.HL.Lo, false) }
 
-func op86(c *SM83) { c.add(c.bus.Read(c.R.HL.Pack()), false) }
+func op86(c *SM83) { c.add(c.read(c.R.HL.Pack()), false) }
 
 func op87(c *SM83) { c.add(c.R.A, false) }
 
@@ -520,7 +529,7 @@ func op8C(c *SM83) { c.add(c.R.HL.Hi, c.R.F.c) }
 
 func op8D(c *SM83) { c.add(c.R.HL.Lo, c.R.F.c) }
 
-func op8E(c *SM83) { c.add(c.bus.Read(c.R.HL.Pack()), c.R.F.c) }
+func op8E(c *SM83) { c.add(c.read(c.R.HL.Pack()), c.R.F.c) }
 
 func op8F(c *SM83) { c.add(c.R.A, c.R.F.c) }
 
@@ -536,7 +545,7 @@ func op94(c *SM83) { c.sub(c.R.HL.Hi, false) }
 
 func op95(c *SM83) { c.sub(c.R.HL.Lo, false) }
 
-func op96(c *SM83) { c.sub(c.bus.Read(c.R.HL.Pack()), false) }
+func op96(c *SM83) { c.sub(c.read(c.R.HL.Pack()), false) }
 
 func op97(c *SM83) { c.sub(c.R.A, false) }
 
@@ -552,7 +561,7 @@ func op9C(c *SM83) { c.sub(c.R.HL.Hi, c.R.F.c) }
 
 func op9D(c *SM83) { c.sub(c.R.HL.Lo, c.R.F.c) }
 
-func op9E(c *SM83) { c.sub(c.bus.Read(c.R.HL.Pack()), c.R.F.c) }
+func op9E(c *SM83) { c.sub(c.read(c.R.HL.Pack()), c.R.F.c) }
 
 func op9F(c *SM83) { c.sub(c.R.A, c.R.F.c) }
 
@@ -587,7 +596,7 @@ func opA5(c *SM83) {
 }
 
 func opA6(c *SM83) {
-	c.R.A &= c.bus.Read(c.R.HL.Pack())
+	c.R.A &= c.read(c.R.HL.Pack())
 	c.R.F.z, c.R.F.n, c.R.F.h, c.R.F.c = (c.R.A == 0), false, true, false
 }
 
@@ -627,7 +636,7 @@ func opAD(c *SM83) {
 }
 
 func opAE(c *SM83) {
-	c.R.A ^= c.bus.Read(c.R.HL.Pack())
+	c.R.A ^= c.read(c.R.HL.Pack())
 	c.R.F.z, c.R.F.n, c.R.F.h, c.R.F.c = (c.R.A == 0), false, false, false
 }
 
@@ -667,7 +676,7 @@ func opB5(c *SM83) {
 }
 
 func opB6(c *SM83) {
-	c.R.A |= c.bus.Read(c.R.HL.Pack())
+	c.R.A |= c.read(c.R.HL.Pack())
 	c.R.F.z, c.R.F.n, c.R.F.h, c.R.F.c = (c.R.A == 0), false, false, false
 }
 
@@ -688,11 +697,12 @@ func opBC(c *SM83) { c.cp(c.R.HL.Hi) }
 
 func opBD(c *SM83) { c.cp(c.R.HL.Lo) }
 
-func opBE(c *SM83) { c.cp(c.bus.Read(c.R.HL.Pack())) }
+func opBE(c *SM83) { c.cp(c.read(c.R.HL.Pack())) }
 
 func opBF(c *SM83) { c.cp(c.R.A) }
 
 func opC0(c *SM83) {
+	c.tick(1)
 	if !c.R.F.z {
 		c.ret()
 	}
@@ -735,6 +745,7 @@ func opC6(c *SM83) {
 func opC7(c *SM83) { c.call(0x00) }
 
 func opC8(c *SM83) {
+	c.tick(1)
 	if c.R.F.z {
 		c.ret()
 	}
@@ -756,7 +767,6 @@ func opCB(c *SM83) {
 	c.inst.CB = true
 
 	(cbTable[opcode])(c)
-	c.tick(cbCycles[opcode])
 }
 
 func opCC(c *SM83) {
@@ -778,6 +788,7 @@ func opCE(c *SM83) { c.add(c.fetch(), c.R.F.c) } // adc a, u8
 func opCF(c *SM83) { c.call(0x08) }
 
 func opD0(c *SM83) {
+	c.tick(1)
 	if !c.R.F.c {
 		c.ret()
 	}
@@ -814,6 +825,7 @@ func opD6(c *SM83) {
 func opD7(c *SM83) { c.call(0x10) }
 
 func opD8(c *SM83) {
+	c.tick(1)
 	if c.R.F.c {
 		c.ret()
 	}
@@ -855,14 +867,14 @@ func opDF(c *SM83) { c.call(0x18) }
 
 func opE0(c *SM83) {
 	addr := 0xFF00 | uint16(c.fetch())
-	c.bus.Write(addr, c.R.A)
+	c.write(addr, c.R.A)
 }
 
 func opE1(c *SM83) { c.R.HL.Unpack(c.pop16()) } // pop hl
 
 func opE2(c *SM83) {
 	addr := 0xFF00 | uint16(c.R.BC.Lo)
-	c.bus.Write(addr, c.R.A)
+	c.write(addr, c.R.A)
 }
 
 func opE5(c *SM83) { c.push16(c.R.HL.Pack()) } // push hl
@@ -881,15 +893,16 @@ func opE8(c *SM83) {
 	val := sp + uint16(rel)
 	c.R.SP = val
 	c.R.F.z, c.R.F.n, c.R.F.h, c.R.F.c = false, false, ((sp&0x0F)+(uint16(rel)&0x0F) > 0x0F), ((val & 0xFF) < (sp & 0xFF))
+	c.tick(2)
 }
 
-func opE9(c *SM83) { c.branch(c.R.HL.Pack()) }
+func opE9(c *SM83) { c.R.PC = c.R.HL.Pack() } // jp hl はPCを書き換えるだけなので内部サイクルがない
 
 func opEA(c *SM83) {
 	lo := uint16(c.fetch())
 	hi := uint16(c.fetch())
 	addr := (hi << 8) | lo
-	c.bus.Write(addr, c.R.A)
+	c.write(addr, c.R.A)
 }
 
 // xor a, u8
@@ -902,7 +915,7 @@ func opEF(c *SM83) { c.call(0x28) }
 
 func opF0(c *SM83) {
 	addr := 0xFF00 | uint16(c.fetch())
-	c.R.A = c.bus.Read(addr)
+	c.R.A = c.read(addr)
 }
 
 func opF1(c *SM83) {
@@ -913,7 +926,7 @@ func opF1(c *SM83) {
 
 func opF2(c *SM83) {
 	addr := 0xFF00 | uint16(c.R.BC.Lo)
-	c.R.A = c.bus.Read(addr)
+	c.R.A = c.read(addr)
 }
 
 func opF3(c *SM83) { c.IME = false }
@@ -938,15 +951,19 @@ func opF8(c *SM83) {
 	val := c.R.SP + uint16(rel)
 	c.R.HL.Unpack(val)
 	c.R.F.z, c.R.F.n, c.R.F.h, c.R.F.c = false, false, ((c.R.SP&0x0F)+(uint16(rel)&0x0F) > 0x0F), ((int(c.R.SP)&0xFF)+int(rel)&0xFF) > 0xFF
+	c.tick(1)
 }
 
-func opF9(c *SM83) { c.R.SP = c.R.HL.Pack() }
+func opF9(c *SM83) {
+	c.R.SP = c.R.HL.Pack()
+	c.tick(1)
+}
 
 func opFA(c *SM83) {
 	lo := uint16(c.fetch())
 	hi := uint16(c.fetch())
 	addr := (hi << 8) | lo
-	c.R.A = c.bus.Read(addr)
+	c.R.A = c.read(addr)
 }
 
 func opFB(c *SM83) { c.IME = true }
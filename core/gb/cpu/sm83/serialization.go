@@ -8,7 +8,8 @@ type Snapshot struct {
 	BC, DE, HL, SP, PC uint16
 	Inst               Context
 	IME                bool
-	Reserved           [8]uint8 // 拡張用
+	HaltBug, Locked    bool
+	Reserved           [6]uint8 // 拡張用
 }
 
 var errSnapshotNil = errors.New("SM83 snapshot is nil")
@@ -22,6 +23,7 @@ func (c *SM83) UpdateSnapshot(snap *Snapshot) error {
 	snap.SP, snap.PC = c.R.SP, c.R.PC
 	snap.Inst = c.inst
 	snap.IME = c.IME
+	snap.HaltBug, snap.Locked = c.HaltBug, c.Locked
 	return nil
 }
 
@@ -38,5 +40,6 @@ func (c *SM83) RestoreSnapshot(snap *Snapshot) error {
 	c.R.PC = snap.PC
 	c.inst = snap.Inst
 	c.IME = snap.IME
+	c.HaltBug, c.Locked = snap.HaltBug, snap.Locked
 	return nil
 }
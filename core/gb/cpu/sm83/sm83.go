@@ -1,14 +1,15 @@
 package sm83
 
-import (
-	"fmt"
-)
-
 type Bus interface {
 	Read(addr uint16) uint8
 	Write(addr uint16, val uint8)
 }
 
+// Fetcher is optionally implemented by a Bus to tell opcode and operand fetches apart from data reads, e.g. for watchpoints.
+type Fetcher interface {
+	Fetch(addr uint16) uint8
+}
+
 type Context struct {
 	Opcode uint8
 	Addr   uint16
@@ -18,50 +19,68 @@ type Context struct {
 type SM83 struct {
 	R          Registers
 	bus        Bus
+	fetchBus   func(addr uint16) uint8 // Fetcher でなければ Bus.Read
 	inst       Context
 	IME        bool
+	HaltBug    bool // IME=0 かつ割り込みが保留されている状態でHALTを実行すると、次のフェッチでPCがインクリメントされない
+	Locked     bool // 未定義命令を実行してCPUが停止している(割り込みでも復帰しない)
 	halt, stop func()
-	tick       func(clockCycles int64)
+	tick       func(mCycles int64)
 }
 
 func New(bus Bus, halt, stop func(), tick func(int64)) *SM83 {
 	if tick == nil {
 		panic("tick function is required")
 	}
-	return &SM83{
-		bus:  bus,
-		halt: halt,
-		stop: stop,
-		tick: tick,
+	c := &SM83{
+		bus:      bus,
+		fetchBus: bus.Read,
+		halt:     halt,
+		stop:     stop,
+		tick:     tick,
 	}
+	if f, ok := bus.(Fetcher); ok {
+		c.fetchBus = f.Fetch
+	}
+	return c
 }
 
 func (c *SM83) Reset() {
 	c.R.reset()
 	c.IME = false
+	c.HaltBug, c.Locked = false, false
 }
 
 func (c *SM83) Step() {
-	pc := c.R.PC
-	c.inst.Addr = pc
+	c.inst.Addr = c.R.PC
 	opcode := c.fetch()
 	c.inst.Opcode = opcode
 	c.inst.CB = false
 
-	fn := opTable[opcode]
-	if fn != nil {
-		fn(c)
+	opTable[opcode](c)
+}
+
+func (c *SM83) fetch() uint8 {
+	pc := c.R.PC
+	if c.HaltBug {
+		c.HaltBug = false
 	} else {
-		panic(fmt.Sprintf("illegal opcode: 0x%02X in 0x%04X", opcode, pc))
+		c.R.PC++
 	}
+	c.tick(1)
+	return c.fetchBus(pc)
+}
 
-	c.tick(opCycles[opcode])
+// メモリアクセスは1つにつき1Mサイクルかかるので、アクセスのたびに他のコンポーネントを進める
+// アクセスはMサイクルの終わりに行われるので、先に進めてから読み書きする
+func (c *SM83) read(addr uint16) uint8 {
+	c.tick(1)
+	return c.bus.Read(addr)
 }
 
-func (c *SM83) fetch() uint8 {
-	pc := c.R.PC
-	c.R.PC++
-	return c.bus.Read(pc)
+func (c *SM83) write(addr uint16, val uint8) {
+	c.tick(1)
+	c.bus.Write(addr, val)
 }
 
 func btou8(b bool) uint8 {
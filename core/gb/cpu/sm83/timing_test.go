@@ -0,0 +1,176 @@
+package sm83
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// blargg の instr_timing と同じ表 (Mサイクル, 分岐しない場合)
+// 0 は STOP, HALT, 未定義命令, CB で、ここでは測らない
+var instrTiming = [256]int64{
+	1, 3, 2, 2, 1, 1, 2, 1, 5, 2, 2, 2, 1, 1, 2, 1,
+	0, 3, 2, 2, 1, 1, 2, 1, 3, 2, 2, 2, 1, 1, 2, 1,
+	2, 3, 2, 2, 1, 1, 2, 1, 2, 2, 2, 2, 1, 1, 2, 1,
+	2, 3, 2, 2, 3, 3, 3, 1, 2, 2, 2, 2, 1, 1, 2, 1,
+	1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
+	1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
+	1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
+	2, 2, 2, 2, 2, 2, 0, 2, 1, 1, 1, 1, 1, 1, 2, 1,
+	1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
+	1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
+	1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
+	1, 1, 1, 1, 1, 1, 2, 1, 1, 1, 1, 1, 1, 1, 2, 1,
+	2, 3, 3, 4, 3, 4, 2, 4, 2, 4, 3, 0, 3, 6, 2, 4,
+	2, 3, 3, 0, 3, 4, 2, 4, 2, 4, 3, 0, 3, 0, 2, 4,
+	3, 3, 2, 0, 0, 4, 2, 4, 4, 1, 4, 0, 0, 0, 2, 4,
+	3, 3, 2, 1, 0, 4, 2, 4, 3, 2, 4, 1, 0, 0, 2, 4,
+}
+
+// 分岐した場合のMサイクル数 (flags は条件が成り立つときのフラグ)
+var branchTiming = map[uint8]struct {
+	cycles int64
+	flags  uint8
+}{
+	0x20: {3, 0x00}, 0x28: {3, 0xF0}, 0x30: {3, 0x00}, 0x38: {3, 0xF0}, // jr cc
+	0xC0: {5, 0x00}, 0xC8: {5, 0xF0}, 0xD0: {5, 0x00}, 0xD8: {5, 0xF0}, // ret cc
+	0xC2: {4, 0x00}, 0xCA: {4, 0xF0}, 0xD2: {4, 0x00}, 0xDA: {4, 0xF0}, // jp cc
+	0xC4: {6, 0x00}, 0xCC: {6, 0xF0}, 0xD4: {6, 0x00}, 0xDC: {6, 0xF0}, // call cc
+}
+
+const (
+	timingCode = 0x8000
+	timingHL   = 0xC000
+	timingBC   = 0xC010
+	timingDE   = 0xC020
+	timingSP   = 0xD000
+)
+
+// アクセスしたMサイクル(命令の最初のMサイクルが1)を記録する
+type timingBus struct {
+	mem    [0x10000]uint8
+	cycles int64
+	events []string
+}
+
+func (b *timingBus) Read(addr uint16) uint8 {
+	if timingCode <= addr && addr < timingCode+4 {
+		b.events = append(b.events, fmt.Sprintf("%df", b.cycles))
+	} else {
+		b.events = append(b.events, fmt.Sprintf("%dr:%04X", b.cycles, addr))
+	}
+	return b.mem[addr]
+}
+
+func (b *timingBus) Write(addr uint16, val uint8) {
+	b.events = append(b.events, fmt.Sprintf("%dw:%04X", b.cycles, addr))
+	b.mem[addr] = val
+}
+
+func newTimingCPU(flags uint8, code ...uint8) (*SM83, *timingBus) {
+	b := &timingBus{}
+	copy(b.mem[timingCode:], code)
+	c := New(b, func() {}, func() {}, func(n int64) { b.cycles += n })
+	c.R.PC, c.R.SP = timingCode, timingSP
+	c.R.HL.Unpack(timingHL)
+	c.R.BC.Unpack(timingBC)
+	c.R.DE.Unpack(timingDE)
+	c.R.F.Unpack(flags)
+	return c, b
+}
+
+// operand は nn = 0xC100, n = 0x00
+func runTiming(flags uint8, code ...uint8) (int64, string) {
+	c, b := newTimingCPU(flags, append(code, 0x00, 0xC1)...)
+	c.Step()
+	return b.cycles, strings.Join(b.events, " ")
+}
+
+func TestInstrTiming(t *testing.T) {
+	for op, want := range instrTiming {
+		if want == 0 {
+			continue
+		}
+		flags := uint8(0xF0)
+		if b, ok := branchTiming[uint8(op)]; ok {
+			flags = ^b.flags & 0xF0
+		}
+		if got, _ := runTiming(flags, uint8(op)); got != want {
+			t.Errorf("opcode $%02X: %d cycles, want %d", op, got, want)
+		}
+	}
+	for op, b := range branchTiming {
+		if got, _ := runTiming(b.flags, op); got != b.cycles {
+			t.Errorf("opcode $%02X (taken): %d cycles, want %d", op, got, b.cycles)
+		}
+	}
+	for op := range 256 {
+		want := int64(2)
+		if op&0x07 == 6 { // (hl)
+			want = 4
+			if 0x40 <= op && op < 0x80 { // bit
+				want = 3
+			}
+		}
+		if got, _ := runTiming(0, 0xCB, uint8(op)); got != want {
+			t.Errorf("opcode $CB $%02X: %d cycles, want %d", op, got, want)
+		}
+	}
+}
+
+// blargg の mem_timing, mem_timing-2 が調べる、読み書きが命令の何Mサイクル目に起こるか
+// f: フェッチ, r: 読み込み, w: 書き込み
+func TestMemTiming(t *testing.T) {
+	tests := []struct {
+		code   []uint8
+		events string
+	}{
+		{[]uint8{0x02}, "1f 2w:C010"},                  // ld (bc), a
+		{[]uint8{0x0A}, "1f 2r:C010"},                  // ld a, (bc)
+		{[]uint8{0x12}, "1f 2w:C020"},                  // ld (de), a
+		{[]uint8{0x1A}, "1f 2r:C020"},                  // ld a, (de)
+		{[]uint8{0x22}, "1f 2w:C000"},                  // ld (hl+), a
+		{[]uint8{0x3A}, "1f 2r:C000"},                  // ld a, (hl-)
+		{[]uint8{0x34}, "1f 2r:C000 3w:C000"},          // inc (hl)
+		{[]uint8{0x35}, "1f 2r:C000 3w:C000"},          // dec (hl)
+		{[]uint8{0x36}, "1f 2f 3w:C000"},               // ld (hl), u8
+		{[]uint8{0x46}, "1f 2r:C000"},                  // ld b, (hl)
+		{[]uint8{0x70}, "1f 2w:C000"},                  // ld (hl), b
+		{[]uint8{0x86}, "1f 2r:C000"},                  // add a, (hl)
+		{[]uint8{0xBE}, "1f 2r:C000"},                  // cp a, (hl)
+		{[]uint8{0x08}, "1f 2f 3f 4w:C100 5w:C101"},    // ld (u16), sp
+		{[]uint8{0xC1}, "1f 2r:D000 3r:D001"},          // pop bc
+		{[]uint8{0xC5}, "1f 3w:CFFF 4w:CFFE"},          // push bc
+		{[]uint8{0xC9}, "1f 2r:D000 3r:D001"},          // ret
+		{[]uint8{0xC0}, "1f 3r:D000 4r:D001"},          // ret nz
+		{[]uint8{0xCD}, "1f 2f 3f 5w:CFFF 6w:CFFE"},    // call u16
+		{[]uint8{0xC4}, "1f 2f 3f 5w:CFFF 6w:CFFE"},    // call nz, u16
+		{[]uint8{0xC7}, "1f 3w:CFFF 4w:CFFE"},          // rst $00
+		{[]uint8{0xE0}, "1f 2f 3w:FF00"},               // ldh (u8), a
+		{[]uint8{0xF0}, "1f 2f 3r:FF00"},               // ldh a, (u8)
+		{[]uint8{0xE2}, "1f 2w:FF10"},                  // ld (c), a
+		{[]uint8{0xF2}, "1f 2r:FF10"},                  // ld a, (c)
+		{[]uint8{0xEA}, "1f 2f 3f 4w:C100"},            // ld (u16), a
+		{[]uint8{0xFA}, "1f 2f 3f 4r:C100"},            // ld a, (u16)
+		{[]uint8{0xCB, 0x46}, "1f 2f 3r:C000"},         // bit 0, (hl)
+		{[]uint8{0xCB, 0x06}, "1f 2f 3r:C000 4w:C000"}, // rlc (hl)
+		{[]uint8{0xCB, 0x36}, "1f 2f 3r:C000 4w:C000"}, // swap (hl)
+		{[]uint8{0xCB, 0x86}, "1f 2f 3r:C000 4w:C000"}, // res 0, (hl)
+		{[]uint8{0xCB, 0xFE}, "1f 2f 3r:C000 4w:C000"}, // set 7, (hl)
+	}
+	for _, tt := range tests {
+		if _, got := runTiming(0, tt.code...); got != tt.events {
+			t.Errorf("% X: %q, want %q", tt.code, got, tt.events)
+		}
+	}
+}
+
+// 割り込みは2つの待機サイクルの後にPCを積み、5Mサイクル目にジャンプする
+func TestInterruptTiming(t *testing.T) {
+	c, b := newTimingCPU(0)
+	c.IME = true
+	c.Interrupt(2)
+	if got, want := strings.Join(b.events, " "), "3w:CFFF 4w:CFFE"; got != want || b.cycles != 5 || c.R.PC != 0x50 {
+		t.Errorf("%q in %d cycles, PC $%04X; want %q in 5 cycles, PC $0050", got, b.cycles, c.R.PC, want)
+	}
+}
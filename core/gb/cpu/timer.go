@@ -46,6 +46,10 @@ func (t *Timer) update() {
 	}
 }
 
+func (t *Timer) resetDIV() {
+	t.counter = 0
+}
+
 func (t *Timer) Read(addr uint16) uint8 {
 	x := (*t.clock) / 4
 	switch addr {
@@ -65,7 +69,7 @@ func (t *Timer) Read(addr uint16) uint8 {
 func (t *Timer) Write(addr uint16, val uint8) {
 	switch addr {
 	case 0xFF04:
-		t.counter = 0
+		t.resetDIV()
 	case 0xFF05:
 		t.TIMA = val
 	case 0xFF06:
@@ -0,0 +1,100 @@
+package cpu
+
+import (
+	"fmt"
+	"io"
+)
+
+// NoPC disables StartPC or StopPC in TraceOptions.
+const NoPC = -1
+
+// TraceOptions controls when the tracer starts and stops logging.
+type TraceOptions struct {
+	StartFrame uint64 // このフレームから記録を始める
+	StopFrame  uint64 // このフレームになったら記録をやめる(0なら制限なし)
+	StartPC    int    // このPCの命令を実行するまで記録を始めない(NoPCなら無効)
+	StopPC     int    // このPCの命令を実行しようとしたら記録をやめる(NoPCなら無効)
+	MaxBytes   int64  // ログの最大サイズ(0なら制限なし)
+}
+
+// Tracer writes one line per executed instruction in Gameboy Doctor format.
+//
+//	A:00 F:11 B:22 C:33 D:44 E:55 H:66 L:77 SP:8888 PC:9999 PCMEM:AA,BB,CC,DD
+type Tracer struct {
+	w       io.Writer
+	opts    TraceOptions
+	frame   func() uint64
+	started bool
+	stopped bool
+	written int64
+	err     error
+}
+
+// NewTracer creates a tracer. frame returns the current frame number and is used for StartFrame and StopFrame.
+func NewTracer(w io.Writer, opts TraceOptions, frame func() uint64) *Tracer {
+	return &Tracer{
+		w:     w,
+		opts:  opts,
+		frame: frame,
+	}
+}
+
+// Stopped returns true if the tracer has finished logging.
+func (t *Tracer) Stopped() bool { return t.stopped }
+
+// Err returns the first error that occurred while writing.
+func (t *Tracer) Err() error { return t.err }
+
+func (t *Tracer) trace(c *CPU) {
+	if t.stopped {
+		return
+	}
+
+	pc := c.R.PC
+	frame := t.frame()
+	if (t.opts.StopFrame > 0 && frame >= t.opts.StopFrame) || (t.opts.StopPC != NoPC && int(pc) == t.opts.StopPC && t.started) {
+		t.stopped = true
+		return
+	}
+	if !t.started {
+		if frame < t.opts.StartFrame || (t.opts.StartPC != NoPC && int(pc) != t.opts.StartPC) {
+			return
+		}
+		t.started = true
+	}
+
+	line := fmt.Sprintf("A:%02X F:%02X B:%02X C:%02X D:%02X E:%02X H:%02X L:%02X SP:%04X PC:%04X PCMEM:%02X,%02X,%02X,%02X\n",
+		c.R.A, c.R.F.Pack(), c.R.BC.Hi, c.R.BC.Lo, c.R.DE.Hi, c.R.DE.Lo, c.R.HL.Hi, c.R.HL.Lo, c.R.SP, pc,
+		c.peek(pc), c.peek(pc+1), c.peek(pc+2), c.peek(pc+3),
+	)
+	if t.opts.MaxBytes > 0 && t.written+int64(len(line)) > t.opts.MaxBytes {
+		t.stopped = true
+		return
+	}
+
+	n, err := io.WriteString(t.w, line)
+	t.written += int64(n)
+	if err != nil {
+		t.err = err
+		t.stopped = true
+	}
+}
+
+// Peeker is implemented by the bus if it can be read without side effects, e.g. on the wave RAM or the IO registers.
+type Peeker interface {
+	Peek(addr uint16) uint8
+}
+
+// デバッガのフックを呼ばずに、副作用なしでメモリを読む
+func (c *CPU) peek(addr uint16) uint8 {
+	if p, ok := c.bus.(Peeker); ok {
+		return p.Peek(addr)
+	}
+	if val, ok := c.ReadBIOS(addr); ok {
+		return val
+	}
+	if addr >= 0xFF80 && addr <= 0xFFFE { // HRAM
+		return c.HRAM[addr&0x7F]
+	}
+	return c.bus.Read(addr)
+}
@@ -1,6 +1,10 @@
 package gb
 
 import (
+	"io"
+
+	"github.com/akatsuki105/dawngb/core/gb/cpu"
+	"github.com/akatsuki105/dawngb/core/gb/cpu/sm83/disasm"
 	"github.com/akatsuki105/dawngb/internal/debugger"
 	"github.com/akatsuki105/dawngb/internal/unsafeslice"
 )
@@ -10,6 +14,34 @@ func (g *GB) AttachDebugger(d debugger.Debugger) {
 	g.CPU.Debugger = d
 }
 
+// AttachTracer starts logging executed instructions to w in Gameboy Doctor format.
+// If w is nil, the tracer is detached.
+func (g *GB) AttachTracer(w io.Writer, opts cpu.TraceOptions) *cpu.Tracer {
+	if w == nil {
+		g.CPU.Tracer = nil
+		return nil
+	}
+	g.CPU.Tracer = cpu.NewTracer(w, opts, func() uint64 { return g.PPU.Frame })
+	return g.CPU.Tracer
+}
+
+// Step executes one instruction (or waits one M-cycle while halted) and returns the elapsed master cycles.
+func (g *GB) Step() int64 {
+	g.CPU.BreakRequested = false
+	return g.CPU.Step()
+}
+
+// Break stops the emulation before the current instruction is executed and makes RunFrame return early.
+// It is intended to be called from Debugger.InstructionHook.
+func (g *GB) Break() {
+	g.CPU.BreakRequested = true
+}
+
+// Broken reports whether the last RunFrame or Step was stopped by Break.
+func (g *GB) Broken() bool {
+	return g.CPU.BreakRequested
+}
+
 // GetValue returns the value of the specified state.
 func (g *GB) GetValue(which uint64) uint64 {
 	category := which >> 56
@@ -104,7 +136,8 @@ func (g *GB) PokeMemory(memID int, addr uint32, width int, data uint32) bool {
 	case addr16 < 0x8000: // ROM
 		return false
 	case addr16 < 0xA000: // VRAM
-		return false
+		g.PPU.RAM.Data[(uint(g.PPU.RAM.Bank)<<13)|uint(addr16&0x1FFF)] = uint8(data)
+		return true
 	case addr16 < 0xC000: // SRAM
 		return false
 	case addr16 < 0xD000: // WRAM0
@@ -120,7 +153,8 @@ func (g *GB) PokeMemory(memID int, addr uint32, width int, data uint32) bool {
 		g.WRAM.Data[(uint(g.WRAM.Bank)<<12)|uint(addr16&0xFFF)] = uint8(data)
 		return true
 	case addr16 < 0xFEA0: // OAM
-		return false
+		g.PPU.OAM[addr16-0xFE00] = uint8(data)
+		return true
 	case addr16 < 0xFF00: // unused
 		return false
 	case addr16 < 0xFF80: // I/O
@@ -130,6 +164,7 @@ func (g *GB) PokeMemory(memID int, addr uint32, width int, data uint32) bool {
 		return true
 	case addr16 == 0xFFFF: // IE
 		g.CPU.IE = uint8(data)
+		return true
 	}
 	return false
 }
@@ -161,3 +196,22 @@ func (g *GB) GetChunk(chunkID uint64) []uint8 {
 	}
 	return nil
 }
+
+// Peek reads the memory as the CPU sees it, without side effects and without calling the debugger hooks.
+func (g *GB) Peek(addr uint16) uint8 {
+	if val, ok := g.CPU.ReadBIOS(addr); ok {
+		return val
+	}
+	return g.read(addr, true)
+}
+
+// デバッガ用に副作用なしでCPUから見えるメモリを読むバス
+type peekBus struct{ g *GB }
+
+func (b peekBus) Read(addr uint16) uint8       { return b.g.Peek(addr) }
+func (b peekBus) Write(addr uint16, val uint8) {}
+
+// Disassemble returns the mnemonic and the length of the instruction at addr in the CPU address space.
+func (g *GB) Disassemble(addr uint16) (string, int) {
+	return disasm.Disassemble(disasm.WithCartridge(peekBus{g}, g.Cart), addr)
+}
@@ -0,0 +1,29 @@
+package gb
+
+import (
+	"testing"
+
+	"github.com/akatsuki105/dawngb/core/gb/cpu"
+)
+
+func TestPeekJoypad(t *testing.T) {
+	g := newTestGB(t, MODEL_DMG, "PEEK")
+	g.Write(0xFF00, 0x10)  // ボタンを選択
+	g.CPU.SendInputs(0xFE) // A
+	g.CPU.IF = 0
+	joyp := g.CPU.Joypad.JOYP
+
+	if val := g.Peek(0xFF00); val != 0xDE {
+		t.Errorf("Peek(0xFF00) = 0x%02X, want 0xDE", val)
+	}
+	if val := g.ViewMemory(0, 0xFF00, 1); val != 0xDE {
+		t.Errorf("ViewMemory(0xFF00) = 0x%02X, want 0xDE", val)
+	}
+	if g.CPU.IF != 0 || g.CPU.Joypad.JOYP != joyp {
+		t.Errorf("peek changed the state: IF 0x%02X, JOYP 0x%02X", g.CPU.IF, g.CPU.Joypad.JOYP)
+	}
+
+	if val := g.Read(0xFF00); val != 0xDE || g.CPU.IF&(1<<cpu.IRQ_JOYPAD) == 0 {
+		t.Errorf("Read(0xFF00) = 0x%02X, IF 0x%02X", val, g.CPU.IF)
+	}
+}
@@ -37,7 +37,8 @@ const (
 type DumpCmd = uint8
 
 const (
-	DUMP_SAVE DumpCmd = iota
+	DUMP_SAVE        DumpCmd = iota
+	DUMP_SAVE_PACKED         // DUMP_SAVE と同じだが、MBC2のRAMは256バイトに詰める
 )
 
 var buttons = [8]string{"A", "B", "SELECT", "START", "RIGHT", "LEFT", "UP", "DOWN"}
@@ -50,8 +51,18 @@ type GB struct {
 	Cart   *cartridge.Cartridge
 	inputs uint8 // 押されている時にビットを立てる; bit0: A, bit1: B, bit2: SELECT, bit3: START, bit4: RIGHT, bit5: LEFT, bit6: UP, bit7: DOWN
 	WRAM   WRAM
+	IR     Infrared // CGB only
+	SGB    *SGB     // MODEL_SGB only (nil otherwise)
 	Snap   Snapshot
 	debugger.Debugger
+
+	players [3]uint8 // 2P..4P の inputs (SGBのマルチプレイヤー用)
+	rumble  float64  // 前のフレームの振動の強さ
+
+	frame struct {
+		start  int64  // フレーム開始時の CPU.Cycles
+		number uint64 // フレーム開始時の PPU.Frame
+	}
 }
 
 type WRAM struct {
@@ -64,10 +75,13 @@ func New(model Model, audioBuffer io.Writer) *GB {
 		Model: model,
 		Snap:  *NewSnapshot(0),
 	}
-	g.CPU = cpu.New(g.IsColor(), g)
+	g.CPU = cpu.New(g.IsColor(), g, g.sync)
 	g.PPU = ppu.New(g.CPU)
 	g.APU = apu.New(audioBuffer)
 	g.WRAM.Bank = 1
+	if model == MODEL_SGB {
+		g.SGB = newSGB(g)
+	}
 	return g
 }
 
@@ -78,7 +92,14 @@ func (g *GB) Reset() {
 		g.CPU.Reset()
 		g.PPU.Reset()
 		g.APU.Reset()
+		g.Cart.Reset()
+		g.IR.reset()
+		if g.SGB != nil {
+			g.SGB.reset()
+		}
 		g.inputs = 0
+		g.players = [3]uint8{}
+		g.rumble = 0
 	}
 }
 
@@ -109,7 +130,7 @@ func (g *GB) skipBIOS() {
 	g.APU.SkipBIOS()
 	g.Write(0xFF02, 0x7F) // SC
 	g.Write(0xFF0F, 0xE1) // IF
-	cgbflag := g.Cart.ROM[0x143]
+	cgbflag := g.Cart.Header.CGBFlag
 	if cgbflag&0x80 == 0 {
 		g.Write(0xFF4C, 4) // KEY0
 	}
@@ -137,7 +158,9 @@ func (g *GB) Load(cmd LoadCmd, args ...any) error {
 		if err != nil {
 			return err
 		}
+		cartridge.IR = cartIR{g}
 		g.Cart = cartridge
+		g.APU.External = cartridge.Sample
 
 	case LOAD_SAVE:
 		if len(args) != 1 {
@@ -150,7 +173,7 @@ func (g *GB) Load(cmd LoadCmd, args ...any) error {
 		if !ok {
 			return fmt.Errorf("LOAD_SAVE command requires []uint8")
 		}
-		err := g.Cart.LoadSRAM(sram)
+		err := g.Cart.LoadSave(sram)
 		if err != nil {
 			return err
 		}
@@ -191,11 +214,11 @@ func (g *GB) LoadSave(savedata []uint8) error {
 
 func (g *GB) Dump(cmd DumpCmd, args ...any) ([]uint8, error) {
 	switch cmd {
-	case DUMP_SAVE:
+	case DUMP_SAVE, DUMP_SAVE_PACKED:
 		if g.Cart == nil {
 			return []uint8{}, fmt.Errorf("no cartridge loaded")
 		}
-		return g.Cart.SRAM(), nil
+		return g.Cart.Save(cmd == DUMP_SAVE_PACKED), nil
 	default:
 		return nil, errInvalidCmd
 	}
@@ -204,31 +227,70 @@ func (g *GB) Dump(cmd DumpCmd, args ...any) ([]uint8, error) {
 func (g *GB) RunFrame() {
 	if g.Cart != nil {
 		// defer g.onPanic()
+		g.beginFrame()
+		for !g.frameDone() {
+			g.step()
+		}
+		g.endFrame()
+	}
+}
 
-		g.CPU.SendInputs(g.inputs ^ 0xFF) // ボタンの状態をCPUに送る(ただし、押されてないボタンのビットを立てる)
-		g.inputs = 0
+const frameCycles = 70224 * ppu.CYCLE // LCDがオフのときはVBlankが来ないので、この長さで1フレームとする
 
-		g.CPU.Usage = 0
+// 1フレームの実行は beginFrame, frameDone が true になるまで step, endFrame の順に行う
+// LinkCable のように複数のGBを少しずつ交互に進める場合もこれを使う
+func (g *GB) beginFrame() {
+	g.CPU.SendInputs(g.inputs ^ 0xFF) // ボタンの状態をCPUに送る(ただし、押されてないボタンのビットを立てる)
+	g.inputs = 0
+	for i, inputs := range g.players {
+		g.CPU.SendPlayerInputs(i+1, inputs^0xFF)
+	}
+	g.players = [3]uint8{}
 
-		const FRAME = 70224 * ppu.CYCLE
-		start := g.CPU.Cycles
+	g.CPU.Usage = 0
+	g.frame.start, g.frame.number = g.CPU.Cycles, g.PPU.Frame
+	g.CPU.BreakRequested = false
+}
 
-		frame := g.PPU.Frame
-		for frame == g.PPU.Frame && ((g.CPU.Cycles - start) < FRAME) {
-			g.step()
-		}
-		g.APU.FlushSamples()
+func (g *GB) frameDone() bool {
+	return g.frame.number != g.PPU.Frame || (g.CPU.Cycles-g.frame.start) >= frameCycles || g.CPU.BreakRequested
+}
+
+func (g *GB) endFrame() {
+	if g.CPU.Stopped {
+		g.PPU.Blank()
+	}
+	if g.SGB != nil {
+		g.SGB.endFrame()
 	}
+	g.rumble = g.Cart.Rumble()
+	g.APU.FlushSamples()
 }
 
 func (g *GB) step() {
-	delta := g.CPU.Step() // CPUで1命令実行して、その後に他のコンポーネントを同期させる
-	g.PPU.Run(delta)
-	g.APU.Run(delta)
+	g.CPU.Step() // PPU, APU はCPUのメモリアクセスごとに sync で同期される
 }
 
-func (g *GB) Resolution() (w int, h int) { return 160, 144 }
-func (g *GB) Screen() []color.NRGBA      { return g.PPU.Screen() }
+func (g *GB) sync(cycles8MHz int64) {
+	g.PPU.Run(cycles8MHz)
+	g.APU.Run(cycles8MHz)
+	g.Cart.Run(cycles8MHz)
+}
+
+// Resolution returns the size of Screen. It is 256x224 on Super Game Boy with the border.
+func (g *GB) Resolution() (w int, h int) {
+	if g.SGB != nil && g.SGB.Border {
+		return sgbWidth, sgbHeight
+	}
+	return 160, 144
+}
+
+func (g *GB) Screen() []color.NRGBA {
+	if g.SGB != nil {
+		return g.SGB.render(g.PPU.Screen())
+	}
+	return g.PPU.Screen()
+}
 
 func (g *GB) SetKeyInput(key string, press bool) {
 	if press {
@@ -241,6 +303,45 @@ func (g *GB) SetKeyInput(key string, press bool) {
 	}
 }
 
+// KeyInputs returns the buttons pressed for the next frame as a bitmask. (bit0..7: A, B, SELECT, START, RIGHT, LEFT, UP, DOWN)
+func (g *GB) KeyInputs() uint8 { return g.inputs }
+
+// SetKeyInputs replaces the buttons pressed for the next frame with the bitmask returned by KeyInputs.
+func (g *GB) SetKeyInputs(inputs uint8) { g.inputs = inputs }
+
+// SetPlayerKeyInputs is SetKeyInputs for the controller of the player (1..4).
+// The controllers of players 2 to 4 are only read by Super Game Boy games in multiplayer mode.
+func (g *GB) SetPlayerKeyInputs(player int, inputs uint8) {
+	switch {
+	case player == 1:
+		g.inputs = inputs
+	case player >= 2 && player <= 4:
+		g.players[player-2] = inputs
+	}
+}
+
+// SetTilt sets how much the Game Boy is tilted, for the accelerometer of MBC7 cartridges. x and y are in G, usually from -1 to 1.
+// x is positive when the right side is lowered, and y is positive when the bottom side is lowered.
+func (g *GB) SetTilt(x, y float64) {
+	if g.Cart != nil {
+		g.Cart.SetTilt(x, y)
+	}
+}
+
+// Tilt returns the tilt set by SetTilt.
+func (g *GB) Tilt() (x, y float64) {
+	if g.Cart != nil {
+		return g.Cart.Tilt()
+	}
+	return 0, 0
+}
+
+// Rumble returns the strength of the vibration of the rumble cartridge in the last frame, from 0 to 1.
+func (g *GB) Rumble() float64 { return g.rumble }
+
+// HasBIOS returns true if a boot ROM is loaded.
+func (g *GB) HasBIOS() bool { return len(g.CPU.BIOS.Data) > 0 }
+
 // IsCGBMode returns true if the hardware has CGB features (i.e., it's a CGB or AGB).
 func (g *GB) IsColor() bool {
 	return g.Model == MODEL_CGB || g.Model == MODEL_AGB
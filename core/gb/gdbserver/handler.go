@@ -0,0 +1,273 @@
+package gdbserver
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/akatsuki105/dawngb/internal/debugger"
+)
+
+type action uint8
+
+const (
+	actionReply  action = iota
+	actionResume        // c, s
+	actionDetach        // D
+	actionKill          // k
+)
+
+// gdb の z80 アーキテクチャのレジスタ配置 (Reference: https://www.chciken.com/tlmboy/2022/04/03/gdb-z80.html)
+//
+//	AF BC DE HL SP PC IX IY AF' BC' DE' HL' IR
+const numRegs = 13
+
+const errReply = "E01"
+
+// Z0..Z4
+var pointKinds = [...]debugger.Kind{debugger.Exec, debugger.Exec, debugger.Write, debugger.Read, debugger.Access}
+
+func (s *Server) handle(sess *session, w *writer, packet, lastStop string) (string, action) {
+	if packet == "" {
+		return "", actionReply
+	}
+
+	args := packet[1:]
+	switch packet[0] {
+	case '?':
+		return lastStop, actionReply
+
+	case 'g':
+		reply := ""
+		for i := range numRegs {
+			reply += s.readRegister(i)
+		}
+		return reply, actionReply
+
+	case 'G':
+		for i := 0; i < numRegs && len(args) >= (i+1)*4; i++ {
+			if !s.writeRegister(i, args[i*4:(i+1)*4]) {
+				return errReply, actionReply
+			}
+		}
+		return "OK", actionReply
+
+	case 'p': // e.g. 'p5': PCを返す
+		n, err := strconv.ParseUint(args, 16, 8)
+		if err != nil || n >= numRegs {
+			return errReply, actionReply
+		}
+		return s.readRegister(int(n)), actionReply
+
+	case 'P': // e.g. 'P5=5001': PCに0x0150を書き込む
+		n, val, ok := strings.Cut(args, "=")
+		if !ok {
+			return errReply, actionReply
+		}
+		i, err := strconv.ParseUint(n, 16, 8)
+		if err != nil || i >= numRegs || !s.writeRegister(int(i), val) {
+			return errReply, actionReply
+		}
+		return "OK", actionReply
+
+	case 'm': // e.g. 'm34,c': アドレス0x0034 から 12バイト読み込んで返す
+		addr, size, ok := parseAddrSize(args)
+		if !ok {
+			return errReply, actionReply
+		}
+		data := make([]uint8, size)
+		for i := range data {
+			data[i] = uint8(s.g.ViewMemory(0, uint32(addr)+uint32(i), 1))
+		}
+		return hex.EncodeToString(data), actionReply
+
+	case 'M': // e.g. 'MC000,2:0102': アドレス0xC000 に 0x01, 0x02 を書き込む
+		header, payload, _ := strings.Cut(args, ":")
+		addr, size, ok := parseAddrSize(header)
+		if !ok {
+			return errReply, actionReply
+		}
+		data, err := hex.DecodeString(payload)
+		if err != nil || len(data) != int(size) {
+			return errReply, actionReply
+		}
+		return s.writeMemory(addr, data), actionReply
+
+	case 'X': // M のバイナリ版
+		header, payload, _ := strings.Cut(args, ":")
+		addr, size, ok := parseAddrSize(header)
+		if !ok {
+			return errReply, actionReply
+		}
+		data := unescape(payload)
+		if len(data) != int(size) {
+			return errReply, actionReply
+		}
+		return s.writeMemory(addr, data), actionReply
+
+	case 'c', 's': // 'c[addr]', 's[addr]'
+		if args != "" {
+			addr, err := strconv.ParseUint(args, 16, 16)
+			if err != nil {
+				return errReply, actionReply
+			}
+			s.g.CPU.R.PC = uint16(addr)
+		}
+		if packet[0] == 's' {
+			s.m.Step()
+		}
+		return "", actionResume
+
+	case 'Z', 'z': // e.g. 'Z0,150,1': 0x0150 にブレークポイントを設定
+		fields := strings.Split(args, ",")
+		if len(fields) < 3 {
+			return errReply, actionReply
+		}
+		addr, size, ok := parseAddrSize(fields[1] + "," + fields[2])
+		if !ok {
+			return errReply, actionReply
+		}
+		if len(fields[0]) != 1 {
+			return "", actionReply
+		}
+		kind := uint8(fields[0][0] - '0')
+		if kind > 4 {
+			return "", actionReply
+		}
+		if size == 0 || kind <= 1 { // ソフトウェア, ハードウェアブレークポイントは区別しない
+			size = 1
+		}
+
+		p := point{kind, addr, size}
+		if packet[0] == 'z' {
+			if id, ok := sess.points[p]; ok {
+				s.m.Remove(id)
+				delete(sess.points, p)
+			}
+			return "OK", actionReply
+		}
+		if _, ok := sess.points[p]; ok {
+			return "OK", actionReply
+		}
+		end := min(uint32(addr)+uint32(size)-1, 0xFFFF) // 0xFFFF を越える範囲は 0xFFFF まで
+		bp, err := s.m.Add(pointKinds[kind], fmt.Sprintf("%04X-%04X", addr, end), debugger.Options{})
+		if err != nil {
+			return errReply, actionReply
+		}
+		sess.points[p] = bp.ID
+		return "OK", actionReply
+
+	case 'D':
+		return "OK", actionDetach
+
+	case 'k':
+		return "", actionKill
+
+	case 'H': // スレッドは1つしかない
+		return "OK", actionReply
+
+	case 'q', 'Q':
+		return s.query(w, packet), actionReply
+	}
+
+	return "", actionReply
+}
+
+func (s *Server) query(w *writer, packet string) string {
+	name, _, _ := strings.Cut(packet, ":")
+	switch name {
+	case "qSupported":
+		return "PacketSize=1000;QStartNoAckMode+"
+	case "QStartNoAckMode":
+		w.noAck = true
+		return "OK"
+	case "qAttached":
+		return "1"
+	case "qC":
+		return "QC1"
+	case "qfThreadInfo":
+		return "m1"
+	case "qsThreadInfo":
+		return "l"
+	}
+	return ""
+}
+
+// 16bitのレジスタをリトルエンディアンで返す
+func (s *Server) readRegister(i int) string {
+	r := &s.g.CPU.R
+	val := uint16(0)
+	switch i {
+	case 0:
+		val = uint16(r.A)<<8 | uint16(r.F.Pack())
+	case 1:
+		val = r.BC.Pack()
+	case 2:
+		val = r.DE.Pack()
+	case 3:
+		val = r.HL.Pack()
+	case 4:
+		val = r.SP
+	case 5:
+		val = r.PC
+	default: // SM83 には存在しない
+		return "xxxx"
+	}
+	return fmt.Sprintf("%02x%02x", uint8(val), uint8(val>>8))
+}
+
+func (s *Server) writeRegister(i int, data string) bool {
+	if strings.Contains(data, "x") { // 値が不明なレジスタは書き換えない
+		return true
+	}
+	b, err := hex.DecodeString(data)
+	if err != nil || len(b) != 2 {
+		return false
+	}
+
+	val := uint16(b[0]) | uint16(b[1])<<8
+	r := &s.g.CPU.R
+	switch i {
+	case 0:
+		r.A = uint8(val >> 8)
+		r.F.Unpack(uint8(val))
+	case 1:
+		r.BC.Unpack(val)
+	case 2:
+		r.DE.Unpack(val)
+	case 3:
+		r.HL.Unpack(val)
+	case 4:
+		r.SP = val
+	case 5:
+		r.PC = val
+	}
+	return true
+}
+
+func (s *Server) writeMemory(addr uint16, data []uint8) string {
+	for i, b := range data {
+		if !s.g.PokeMemory(0, uint32(addr)+uint32(i), 1, uint32(b)) {
+			return errReply
+		}
+	}
+	return "OK"
+}
+
+// "addr,size" をパースする
+func parseAddrSize(s string) (uint16, uint16, bool) {
+	a, b, ok := strings.Cut(s, ",")
+	if !ok {
+		return 0, 0, false
+	}
+	addr, err := strconv.ParseUint(a, 16, 16)
+	if err != nil {
+		return 0, 0, false
+	}
+	size, err := strconv.ParseUint(b, 16, 16)
+	if err != nil {
+		return 0, 0, false
+	}
+	return uint16(addr), uint16(size), true
+}
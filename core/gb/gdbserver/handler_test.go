@@ -0,0 +1,110 @@
+package gdbserver
+
+import (
+	"io"
+	"testing"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+)
+
+func newTestServer(t *testing.T) (*Server, *session) {
+	t.Helper()
+	rom := make([]uint8, 32*1024)
+	copy(rom[0x150:], []uint8{0x3C, 0x18, 0xFD}) // INC A; JR -3
+	g := gb.New(gb.MODEL_DMG, nil)
+	if err := g.LoadROM(rom); err != nil {
+		t.Fatal(err)
+	}
+	return New(g), &session{points: map[point]int{}}
+}
+
+func TestHandle(t *testing.T) {
+	s, sess := newTestServer(t)
+	w := &writer{w: io.Discard}
+	for _, tt := range []struct {
+		packet, reply string
+		act           action
+	}{
+		{"", "", actionReply},
+		{"?", "S05", actionReply},
+		{"P5=5001", "OK", actionReply},
+		{"p5", "5001", actionReply},
+		{"p0d", errReply, actionReply},
+		{"pzz", errReply, actionReply},
+		{"P5", errReply, actionReply},
+		{"P5=50", errReply, actionReply},
+		{"m150,3", "3c18fd", actionReply},
+		{"m150", errReply, actionReply},
+		{"MC000,2:0102", "OK", actionReply},
+		{"mC000,2", "0102", actionReply},
+		{"MC000,2:01", errReply, actionReply},
+		{"XC002,2:}\x03}]", "OK", actionReply},
+		{"mC002,2", "237d", actionReply},
+		{"cZZ", errReply, actionReply},
+		{"D", "OK", actionDetach},
+		{"k", "", actionKill},
+		{"qSupported:multiprocess+", "PacketSize=1000;QStartNoAckMode+", actionReply},
+		{"qUnknown", "", actionReply},
+		{"vMustReplyEmpty", "", actionReply},
+	} {
+		reply, act := s.handle(sess, w, tt.packet, "S05")
+		if reply != tt.reply || act != tt.act {
+			t.Errorf("%q: got %q (%d), want %q (%d)", tt.packet, reply, act, tt.reply, tt.act)
+		}
+	}
+
+	if reply, _ := s.handle(sess, w, "g", ""); len(reply) != numRegs*4 || reply[20:24] != "5001" {
+		t.Errorf("g: %q", reply)
+	}
+	s.handle(sess, w, "QStartNoAckMode", "")
+	if !w.noAck {
+		t.Error("QStartNoAckMode did not disable acks")
+	}
+}
+
+func TestHandleBreakpoints(t *testing.T) {
+	s, sess := newTestServer(t)
+	w := &writer{w: io.Discard}
+
+	// 不正なパケットで panic しない
+	for _, packet := range []string{"Z,150,1", "z,150,1", "Z9,150,1", "Z00,150,1", "Z0,150", "Z0,zz,1", "Z"} {
+		reply, act := s.handle(sess, w, packet, "")
+		if (reply != "" && reply != errReply) || act != actionReply {
+			t.Errorf("%q: got %q (%d)", packet, reply, act)
+		}
+	}
+	if n := len(s.m.Breakpoints()); n != 0 {
+		t.Fatalf("%d breakpoints after malformed packets", n)
+	}
+
+	for _, packet := range []string{"Z0,150,1", "Z0,150,1", "Z2,c000,2", "Z4,c100,0"} {
+		if reply, _ := s.handle(sess, w, packet, ""); reply != "OK" {
+			t.Errorf("%q: got %q", packet, reply)
+		}
+	}
+	if n := len(s.m.Breakpoints()); n != 3 {
+		t.Errorf("%d breakpoints, want 3", n)
+	}
+	if _, ok := sess.points[point{4, 0xC100, 1}]; !ok {
+		t.Errorf("size 0 watchpoint: %v", sess.points)
+	}
+
+	// 0xFFFF を越える範囲
+	if reply, _ := s.handle(sess, w, "Z2,fffe,4", ""); reply != "OK" {
+		t.Fatalf("Z2,fffe,4: got %q", reply)
+	}
+	bps := s.m.Breakpoints()
+	if bp := bps[len(bps)-1]; bp.Start != 0xFFFE || bp.End != 0xFFFF {
+		t.Errorf("Z2,fffe,4: range %04X-%04X", bp.Start, bp.End)
+	}
+	s.handle(sess, w, "z2,fffe,4", "")
+
+	for _, packet := range []string{"z0,150,1", "z2,c000,2", "z2,c000,2"} {
+		if reply, _ := s.handle(sess, w, packet, ""); reply != "OK" {
+			t.Errorf("%q: got %q", packet, reply)
+		}
+	}
+	if n := len(s.m.Breakpoints()); n != 1 || len(sess.points) != 1 {
+		t.Errorf("%d breakpoints, %d points after removing", n, len(sess.points))
+	}
+}
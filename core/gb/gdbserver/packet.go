@@ -0,0 +1,105 @@
+package gdbserver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Reference: https://sourceware.org/gdb/current/onlinedocs/gdb.html/Overview.html
+
+const interrupt = 0x03 // Ctrl-C
+
+// 受信したパケット または Ctrl-C など
+type event struct {
+	packet    string
+	interrupt bool
+	resend    bool // '-' を受信した
+	corrupted bool // チェックサムが一致しなかった
+	err       error
+}
+
+// 読み込みは専用のgoroutineで行うので、書き込みに関する状態は持たない
+type reader struct {
+	r *bufio.Reader
+}
+
+// $[data]#[checksum] を1つ読む
+func (r *reader) read() event {
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return event{err: err}
+		}
+
+		switch b {
+		case '-':
+			return event{resend: true}
+		case interrupt:
+			return event{interrupt: true}
+		case '$':
+			data, err := r.r.ReadString('#')
+			if err != nil {
+				return event{err: err}
+			}
+			data = data[:len(data)-1]
+
+			sum := make([]uint8, 2)
+			if _, err := io.ReadFull(r.r, sum); err != nil {
+				return event{err: err}
+			}
+			expected, err := strconv.ParseUint(string(sum), 16, 8)
+			if err != nil || uint8(expected) != checksum(data) {
+				return event{corrupted: true}
+			}
+			return event{packet: data}
+		}
+	}
+}
+
+type writer struct {
+	w     io.Writer
+	noAck bool // QStartNoAckMode
+	last  string
+}
+
+func (w *writer) ack(ok bool) error {
+	if w.noAck {
+		return nil
+	}
+	b := uint8('+')
+	if !ok {
+		b = '-'
+	}
+	_, err := w.w.Write([]uint8{b})
+	return err
+}
+
+func (w *writer) send(data string) error {
+	w.last = data
+	_, err := fmt.Fprintf(w.w, "$%s#%02x", data, checksum(data))
+	return err
+}
+
+func checksum(data string) uint8 {
+	sum := uint8(0)
+	for i := 0; i < len(data); i++ {
+		sum += data[i]
+	}
+	return sum
+}
+
+// X パケットのバイナリデータは '}' でエスケープされている
+func unescape(data string) []uint8 {
+	out := make([]uint8, 0, len(data))
+	for i := 0; i < len(data); i++ {
+		if data[i] == '}' && i+1 < len(data) {
+			i++
+			out = append(out, data[i]^0x20)
+			continue
+		}
+		out = append(out, data[i])
+	}
+	return out
+}
@@ -0,0 +1,66 @@
+package gdbserver
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	r := &reader{bufio.NewReader(strings.NewReader("+$m150,2#61\x03-$g#00$qC#b4"))}
+	for _, want := range []event{
+		{packet: "m150,2"},
+		{interrupt: true},
+		{resend: true},
+		{corrupted: true},
+		{packet: "qC"},
+		{err: io.EOF},
+	} {
+		if got := r.read(); got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestReaderTruncated(t *testing.T) {
+	for _, data := range []string{"$m150,2", "$m150,2#6", "$m150,2#zz"} {
+		r := &reader{bufio.NewReader(strings.NewReader(data))}
+		if got := r.read(); got.packet != "" || (got.err == nil && !got.corrupted) {
+			t.Errorf("%q: %+v", data, got)
+		}
+	}
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := &writer{w: &buf}
+	w.ack(true)
+	w.send("OK")
+	w.ack(false)
+	w.noAck = true
+	w.ack(true)
+	w.send("")
+	if got, want := buf.String(), "+$OK#9a-$#00"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	if w.last != "" {
+		t.Errorf("last %q", w.last)
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []uint8
+	}{
+		{"abc", []uint8("abc")},
+		{"}\x03}\x04}]}\x0a", []uint8{'#', '$', '}', '*'}},
+		{"a}", []uint8("a}")}, // 末尾の '}' はそのまま
+	} {
+		if got := unescape(tt.in); !bytes.Equal(got, tt.want) {
+			t.Errorf("%q: got % X, want % X", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Package gdbserver implements a GDB Remote Serial Protocol server for debugging GB software with gdb or IDE frontends.
+package gdbserver
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+	"github.com/akatsuki105/dawngb/internal/debugger"
+)
+
+// gdbのシグナル番号
+const (
+	sigINT  = 2
+	sigILL  = 4
+	sigTRAP = 5
+)
+
+// Z, z パケットで指定されたブレークポイント
+type point struct {
+	kind       uint8 // 0..4
+	addr, size uint16
+}
+
+// Server is a GDB Remote Serial Protocol server.
+// Breakpoints are managed by a debugger.Manager, and the server stops the emulation inside its OnBreak callback, so the goroutine running GB.RunFrame is blocked while gdb is looking at the target.
+type Server struct {
+	g    *gb.GB
+	m    *debugger.Manager
+	sess atomic.Pointer[session]
+}
+
+// 1つのgdbとの接続
+type session struct {
+	points  map[point]int // ManagerのブレークポイントID
+	stopped chan string
+	resume  chan struct{}
+	done    chan struct{}
+}
+
+// New creates a server and attaches its breakpoint manager to g as the debugger.
+func New(g *gb.GB) *Server {
+	s := &Server{g: g, m: debugger.NewManager(g)}
+	s.m.OnBreak = s.onBreak
+	g.AttachDebugger(s.m)
+	return s
+}
+
+// Manager returns the breakpoint manager used by the server.
+func (s *Server) Manager() *debugger.Manager { return s.m }
+
+// ListenAndServe listens on the TCP address and serves gdb connections one at a time.
+func (s *Server) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+
+	for {
+		c, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		s.Serve(c)
+	}
+}
+
+// Serve handles a gdb connection until it is closed or gdb detaches.
+// The target is stopped as soon as gdb connects.
+func (s *Server) Serve(rw io.ReadWriteCloser) error {
+	defer rw.Close()
+
+	sess := &session{
+		points:  map[point]int{},
+		stopped: make(chan string),
+		resume:  make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	s.sess.Store(sess)
+	s.m.Pause()
+	defer func() {
+		s.sess.Store(nil)
+		for _, id := range sess.points {
+			s.m.Remove(id)
+		}
+		close(sess.done) // 停止中ならエミュレーションを再開させる
+	}()
+
+	events := make(chan event)
+	go func() {
+		r := &reader{r: bufio.NewReader(rw)}
+		for {
+			ev := r.read()
+			select {
+			case events <- ev:
+			case <-sess.done:
+				return
+			}
+			if ev.err != nil {
+				return
+			}
+		}
+	}()
+
+	w := &writer{w: rw}
+	halted := false
+	waiting := false // c, s に対する停止理由の返信待ち
+	lastStop := fmt.Sprintf("S%02x", sigTRAP)
+	var pending []string // 停止を待っている間に受け取ったパケット
+
+	// パケットを処理する 接続を終えるなら true を返す
+	handle := func(packet string) (bool, error) {
+		reply, action := s.handle(sess, w, packet, lastStop)
+		switch action {
+		case actionReply:
+			return false, w.send(reply)
+		case actionResume:
+			halted, waiting = false, true
+			sess.resume <- struct{}{}
+			return false, nil
+		case actionDetach:
+			return true, w.send(reply)
+		}
+		return true, nil // actionKill
+	}
+
+	for {
+		select {
+		case reason := <-sess.stopped:
+			halted, lastStop = true, reason
+			if waiting {
+				waiting = false
+				if err := w.send(reason); err != nil {
+					return err
+				}
+			}
+			for halted && len(pending) > 0 {
+				packet := pending[0]
+				pending = pending[1:]
+				if done, err := handle(packet); done || err != nil {
+					return err
+				}
+			}
+
+		case ev := <-events:
+			switch {
+			case ev.err != nil:
+				if errors.Is(ev.err, io.EOF) {
+					return nil
+				}
+				return ev.err
+			case ev.interrupt:
+				if !halted {
+					s.m.Pause()
+				}
+				continue
+			case ev.resend:
+				if err := w.send(w.last); err != nil {
+					return err
+				}
+				continue
+			case ev.corrupted:
+				if err := w.ack(false); err != nil {
+					return err
+				}
+				continue
+			}
+
+			if err := w.ack(true); err != nil {
+				return err
+			}
+
+			// gdbは停止中にしかパケットを送ってこないので、動いているなら止まってから処理する
+			// フロントエンドがエミュレーションを進めていなくても、接続が切れたら抜けられるようにここでは待たない
+			if !halted {
+				s.m.Pause()
+				pending = append(pending, ev.packet)
+				continue
+			}
+			if done, err := handle(ev.packet); done || err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (s *Server) onBreak(hit debugger.Hit) {
+	sess := s.sess.Load()
+	if sess == nil {
+		return
+	}
+
+	reason := fmt.Sprintf("S%02x", sigTRAP)
+	switch hit.Reason {
+	case debugger.HitPaused:
+		reason = fmt.Sprintf("S%02x", sigINT)
+	case debugger.HitWatchpoint:
+		name := [...]string{debugger.Read: "rwatch", debugger.Write: "watch", debugger.Access: "awatch"}[hit.Breakpoint.Kind]
+		reason = fmt.Sprintf("T%02x%s:%04x;", sigTRAP, name, hit.Addr)
+	}
+	if hit.CPU == debugger.CPULocked { // 不正なオペコードで止まっていて、もう命令を実行しない
+		reason = fmt.Sprintf("S%02x", sigILL)
+	}
+
+	// gdbから再開の指示があるまでエミュレーションを止める
+	select {
+	case sess.stopped <- reason:
+	case <-sess.done:
+		return
+	}
+	select {
+	case <-sess.resume:
+	case <-sess.done:
+	}
+}
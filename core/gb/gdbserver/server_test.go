@@ -0,0 +1,72 @@
+package gdbserver
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func serve(t *testing.T, s *Server) (net.Conn, chan error) {
+	t.Helper()
+	client, conn := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- s.Serve(conn) }()
+	t.Cleanup(func() { client.Close() })
+	return client, done
+}
+
+func waitServe(t *testing.T, done chan error) error {
+	t.Helper()
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return")
+		return nil
+	}
+}
+
+// フロントエンドがエミュレーションを進めていなくても、接続が切れたら Serve は終わる
+func TestServeCloseWhileRunning(t *testing.T) {
+	s, _ := newTestServer(t)
+	client, done := serve(t, s)
+	if _, err := client.Write([]uint8("$g#67")); err != nil {
+		t.Fatal(err)
+	}
+	ack := make([]uint8, 1)
+	if _, err := io.ReadFull(client, ack); err != nil || ack[0] != '+' {
+		t.Fatalf("ack %q: %v", ack, err)
+	}
+	client.Close()
+	if err := waitServe(t, done); err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
+
+// 停止を待っている間に受け取ったパケットは、停止してから返信する
+func TestServeReplyAfterStop(t *testing.T) {
+	s, _ := newTestServer(t)
+	client, done := serve(t, s)
+
+	if _, err := client.Write([]uint8("$?#3f")); err != nil {
+		t.Fatal(err)
+	}
+	go s.g.RunFrame() // 最初の命令の前で止まる (Serve が終わると再開する)
+
+	r := bufio.NewReader(client)
+	reply := make([]uint8, len("+$S02#b5"))
+	if _, err := io.ReadFull(r, reply); err != nil {
+		t.Fatal(err)
+	}
+	if string(reply) != "+$S02#b5" {
+		t.Errorf("got %q", reply)
+	}
+
+	client.Write([]uint8("+$k#6b"))
+	io.ReadFull(r, reply[:1])
+	if err := waitServe(t, done); err != nil {
+		t.Errorf("Serve: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package gb
+
+// IRSource is what the infrared port receives light from.
+type IRSource interface {
+	// Light reports whether infrared light reaches the port at the given time. (CPU.Cycles of the receiving Game Boy)
+	Light(now int64) bool
+}
+
+// LEDの点灯状態の変化
+type irEdge struct {
+	at int64 // CPU.Cycles
+	on bool
+}
+
+// Infrared is the infrared port of CGB (RP, FF56), and that of HuC1 and HuC3 cartridges.
+//
+// The receivers always receive the light of the LEDs of the same Game Boy, as the real hardware does.
+type Infrared struct {
+	RP      uint8    // bit0: LED, bit6-7: 受信を有効にする(3)
+	Source  IRSource // nil なら何もない
+	cartLED bool     // カートリッジのLED
+	edges   [32]irEdge
+	n       int // edges に記録した数 (最新は edges[(n-1)%32])
+}
+
+func (ir *Infrared) reset() {
+	ir.RP = 0
+	ir.cartLED = false
+	ir.n = 0
+}
+
+// CGB とカートリッジのどちらかのLEDが点灯しているか
+func (ir *Infrared) on() bool {
+	return ir.RP&0x01 != 0 || ir.cartLED
+}
+
+func (ir *Infrared) light(now int64) bool {
+	return ir.on() || (ir.Source != nil && ir.Source.Light(now))
+}
+
+func (ir *Infrared) read(now int64) uint8 {
+	val := (ir.RP & 0xC1) | 0x3E // bit1: 0なら受信している
+	if (ir.RP&0xC0) == 0xC0 && ir.light(now) {
+		val &^= 0x02
+	}
+	return val
+}
+
+func (ir *Infrared) write(now int64, val uint8) {
+	ir.setLED(now, val&0xC1, ir.cartLED)
+}
+
+func (ir *Infrared) setLED(now int64, rp uint8, cart bool) {
+	before := ir.on()
+	ir.RP, ir.cartLED = rp, cart
+	if on := ir.on(); on != before {
+		ir.edges[ir.n%len(ir.edges)] = irEdge{now, on}
+		ir.n++
+	}
+}
+
+// LED returns whether the LED was on at the given time. Only the recent changes are kept, so older times are approximated.
+func (ir *Infrared) LED(at int64) bool {
+	on := ir.on()
+	for i := 0; i < min(ir.n, len(ir.edges)); i++ {
+		e := ir.edges[(ir.n-1-i)%len(ir.edges)]
+		if e.at <= at {
+			return e.on
+		}
+		on = !e.on // この変化の前の状態
+	}
+	return on
+}
+
+// カートリッジの赤外線ポートを Infrared につなぐ
+type cartIR struct {
+	g *GB
+}
+
+func (p cartIR) SetLED(on bool) { p.g.IR.setLED(p.g.CPU.Cycles, p.g.IR.RP, on) }
+
+func (p cartIR) Light() bool { return p.g.IR.light(p.g.CPU.Cycles) }
+
+// 相手のLEDを相手の時刻に直して見る
+type irPeer struct {
+	peer *GB
+	pair *pair
+	sign int64 // a から b を見るなら 1, b から a を見るなら -1
+}
+
+func (s *irPeer) Light(now int64) bool {
+	return s.peer.IR.LED(now + s.sign*s.pair.offset)
+}
+
+// IRLink places the infrared ports of two Game Boys in the same process face to face.
+//
+// Both Game Boys must be run through IRLink.RunFrame. b is run after a in every short slice,
+// so a sees the LED of b up to 16 master cycles late, while b sees the LED of a at the exact time.
+type IRLink struct {
+	pair
+}
+
+// NewIRLink makes a and b see each other's LED.
+func NewIRLink(a, b *GB) *IRLink {
+	l := &IRLink{pair{a: a, b: b}}
+	a.IR.Source = &irPeer{peer: b, pair: &l.pair, sign: 1}
+	b.IR.Source = &irPeer{peer: a, pair: &l.pair, sign: -1}
+	return l
+}
+
+// Disconnect moves the Game Boys apart.
+func (l *IRLink) Disconnect() {
+	l.a.IR.Source, l.b.IR.Source = nil, nil
+}
+
+// IRNoise is an IRSource which flickers randomly like sunlight or a remote control nearby.
+// It is deterministic for the same seed.
+type IRNoise struct {
+	Seed    uint64
+	Density float64 // 光が当たっている時間の割合 (0..1)
+}
+
+const irNoiseCycles = 256 // この長さごとに光のオンオフが変わる
+
+func (n *IRNoise) Light(now int64) bool {
+	// splitmix64
+	x := n.Seed + uint64(now/irNoiseCycles)*0x9E3779B97F4A7C15
+	x = (x ^ (x >> 30)) * 0xBF58476D1CE4E5B9
+	x = (x ^ (x >> 27)) * 0x94D049BB133111EB
+	x ^= x >> 31
+	return float64(x>>11)/(1<<53) < n.Density
+}
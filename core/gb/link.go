@@ -0,0 +1,79 @@
+package gb
+
+// 通信のタイミングがずれないように、この間隔(マスターサイクル)で2台を交互に進める
+// CGBの高速モードかつ倍速モードでは 16 マスターサイクルごとに1ビット送られる
+const linkSlice = 16
+
+// 同じプロセス内の2台のGBを、少しずつ交互に進める
+type pair struct {
+	a, b     *GB
+	bRunning bool  // b のフレームが始まっているか
+	offset   int64 // a の時刻(CPU.Cycles)に対応する b の時刻との差
+	synced   bool
+}
+
+// RunFrame runs a for a frame and b for the same number of cycles in lockstep.
+// The frames of b are not aligned to a, so b's screen may be in the middle of a frame when this returns.
+func (p *pair) RunFrame() {
+	a, b := p.a, p.b
+	if a.Cart == nil || b.Cart == nil {
+		return
+	}
+
+	a.beginFrame()
+	b.CPU.BreakRequested = false
+	if !p.bRunning {
+		b.beginFrame()
+		p.bRunning = true
+	}
+
+	// 初回やどちらかがリセットされたときは、今の時刻同士を対応させる
+	if diff := b.CPU.Cycles - (a.CPU.Cycles + p.offset); !p.synced || diff > frameCycles || diff < -frameCycles {
+		p.offset = b.CPU.Cycles - a.CPU.Cycles
+		p.synced = true
+	}
+
+	for !a.frameDone() && !b.CPU.BreakRequested {
+		end := a.CPU.Cycles + linkSlice
+		for a.CPU.Cycles < end && !a.frameDone() {
+			a.step()
+		}
+		p.runB(a.CPU.Cycles + p.offset)
+	}
+	a.endFrame()
+}
+
+// b を a に追いつかせる b のフレームの区切りはその都度処理する
+func (p *pair) runB(until int64) {
+	b := p.b
+	for b.CPU.Cycles < until {
+		if b.frameDone() {
+			if b.CPU.BreakRequested {
+				return
+			}
+			b.endFrame()
+			b.beginFrame()
+		}
+		b.step()
+	}
+}
+
+// LinkCable connects the serial ports of two Game Boys in the same process.
+//
+// Both Game Boys must be run through LinkCable.RunFrame instead of their own RunFrame, so that they are stepped in lockstep.
+type LinkCable struct {
+	pair
+}
+
+// NewLinkCable connects a and b with the link cable.
+func NewLinkCable(a, b *GB) *LinkCable {
+	a.CPU.Serial.Connect(b.CPU.Serial)
+	b.CPU.Serial.Connect(a.CPU.Serial)
+	return &LinkCable{pair{a: a, b: b}}
+}
+
+// Disconnect unplugs the link cable.
+func (l *LinkCable) Disconnect() {
+	l.a.CPU.Serial.Connect(nil)
+	l.b.CPU.Serial.Connect(nil)
+}
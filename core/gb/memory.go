@@ -32,6 +32,9 @@ func (g *GB) read(addr uint16, peek bool) uint8 {
 
 	switch addr {
 	case 0xFF00, 0xFF01, 0xFF02, 0xFF04, 0xFF05, 0xFF06, 0xFF07, 0xFF0F: // CPU
+		if peek {
+			return g.CPU.PeekIO(addr)
+		}
 		return g.CPU.ReadIO(addr)
 	case 0xFF10, 0xFF11, 0xFF12, 0xFF13, 0xFF14, 0xFF16, 0xFF17, 0xFF18, 0xFF19, 0xFF1A, 0xFF1B, 0xFF1C, 0xFF1D, 0xFF1E, 0xFF20, 0xFF21, 0xFF22, 0xFF23, 0xFF24, 0xFF25, 0xFF26, 0xFF30, 0xFF31, 0xFF32, 0xFF33, 0xFF34, 0xFF35, 0xFF36, 0xFF37, 0xFF38, 0xFF39, 0xFF3A, 0xFF3B, 0xFF3C, 0xFF3D, 0xFF3E, 0xFF3F: // APU
 		return g.APU.Read(addr, peek)
@@ -51,7 +54,9 @@ func (g *GB) read(addr uint16, peek bool) uint8 {
 			return g.PPU.Read(addr)
 		}
 	case 0xFF56: // RP
-		return 0x02 // TODO: infrared
+		if g.IsColor() {
+			return g.IR.read(g.CPU.Cycles)
+		}
 	case 0xFF70:
 		if g.IsColor() {
 			return g.WRAM.Bank
@@ -118,6 +123,11 @@ func (g *GB) write(addr uint16, val uint8, poke bool) {
 			g.PPU.Write(addr, val)
 		}
 		return
+	case 0xFF56: // RP
+		if g.IsColor() {
+			g.IR.write(g.CPU.Cycles, val)
+		}
+		return
 	case 0xFF70:
 		if g.IsColor() {
 			g.WRAM.Bank = (val & 0b111)
@@ -0,0 +1,173 @@
+package movie
+
+import (
+	"archive/zip"
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+)
+
+// BizHawk のボタン名と GB.KeyInputs のビット
+var bk2Buttons = map[string]uint8{
+	"A":      1 << 0,
+	"B":      1 << 1,
+	"Select": 1 << 2,
+	"Start":  1 << 3,
+	"Right":  1 << 4,
+	"Left":   1 << 5,
+	"Up":     1 << 6,
+	"Down":   1 << 7,
+}
+
+// ImportBK2 converts a BizHawk movie (.bk2) recorded on Game Boy to a Movie for the ROM loaded in g.
+//
+// Only movies starting from power-on are supported. The movie starts with the boot ROM if g has one loaded.
+// Note that frame boundaries of BizHawk's cores are not the same as this emulator's, so a movie which relies on exact frame timing may desync.
+func ImportBK2(r io.ReaderAt, size int64, g *gb.GB) (*Movie, error) {
+	if g.Cart == nil {
+		return nil, errors.New("no cartridge loaded")
+	}
+	z, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, err
+	}
+
+	header, err := readBK2Header(z)
+	if err != nil {
+		return nil, err
+	}
+	if strings.EqualFold(header["StartsFromSavestate"], "True") {
+		return nil, errors.New("bk2: movies starting from a savestate are not supported")
+	}
+	switch header["Platform"] {
+	case "GB", "GBC", "":
+		// Gambatte コアは GBC のムービーでも Platform が GB になっていることがある
+		if (header["Platform"] == "GBC" || strings.EqualFold(header["IsCGBMode"], "True")) && !g.IsColor() {
+			return nil, errors.New("bk2: movie is for Game Boy Color")
+		}
+	default:
+		return nil, fmt.Errorf("bk2: unsupported platform %q", header["Platform"])
+	}
+	if want := header["SHA1"]; want != "" {
+		sum := sha1.Sum(g.Cart.ROM)
+		if !strings.EqualFold(want, hex.EncodeToString(sum[:])) {
+			return nil, fmt.Errorf("bk2: movie is for another ROM (SHA1 %s)", want)
+		}
+	}
+
+	m := &Movie{ROMChecksum: g.Cart.CRC32, Model: g.Model, BIOS: g.HasBIOS()}
+	if f := findBK2File(z, "SaveRam"); f != nil {
+		if m.SRAM, err = readBK2File(f); err != nil {
+			return nil, err
+		}
+	}
+
+	f := findBK2File(z, "Input Log.txt")
+	if f == nil {
+		return nil, errors.New("bk2: Input Log.txt not found")
+	}
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	if m.Inputs, err = parseBK2Inputs(rc); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// "Key Value" の行からなる
+func readBK2Header(z *zip.Reader) (map[string]string, error) {
+	f := findBK2File(z, "Header.txt")
+	if f == nil {
+		return nil, errors.New("bk2: Header.txt not found")
+	}
+	data, err := readBK2File(f)
+	if err != nil {
+		return nil, err
+	}
+	header := map[string]string{}
+	for _, line := range strings.Split(string(data), "\n") {
+		key, val, _ := strings.Cut(strings.TrimSpace(line), " ")
+		if key != "" {
+			header[key] = val
+		}
+	}
+	return header, nil
+}
+
+/*
+Input Log.txt の形式
+
+	[Input]
+	LogKey:#Up|Down|Left|Right|Start|Select|B|A|Power|
+	|.......A.|
+	...
+	[/Input]
+
+LogKey の各ボタンが、入力行の同じ位置の文字に対応する。'.' なら押されていない。
+*/
+func parseBK2Inputs(r io.Reader) ([]uint8, error) {
+	var keys []uint8 // 各文字の位置のビット (0 なら無視するボタン)
+	inputs := []uint8{}
+
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		line := strings.TrimSpace(s.Text())
+		switch {
+		case strings.HasPrefix(line, "LogKey:"):
+			keys = []uint8{}
+			for _, group := range strings.Split(strings.TrimPrefix(strings.TrimPrefix(line, "LogKey:"), "#"), "#") {
+				for _, name := range strings.Split(group, "|") {
+					if name == "" {
+						continue
+					}
+					name = strings.TrimPrefix(name, "P1 ")
+					keys = append(keys, bk2Buttons[name])
+				}
+			}
+
+		case strings.HasPrefix(line, "|"):
+			if keys == nil {
+				return nil, errors.New("bk2: LogKey not found")
+			}
+			buttons := strings.ReplaceAll(line, "|", "")
+			if len(buttons) != len(keys) {
+				return nil, fmt.Errorf("bk2: frame %d has %d buttons, expected %d", len(inputs), len(buttons), len(keys))
+			}
+			mask := uint8(0)
+			for i := range len(buttons) {
+				if buttons[i] != '.' && buttons[i] != ' ' {
+					mask |= keys[i]
+				}
+			}
+			inputs = append(inputs, mask)
+		}
+	}
+	return inputs, s.Err()
+}
+
+func findBK2File(z *zip.Reader, name string) *zip.File {
+	for _, f := range z.File {
+		if f.Name == name {
+			return f
+		}
+	}
+	return nil
+}
+
+func readBK2File(f *zip.File) ([]uint8, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
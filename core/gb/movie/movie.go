@@ -0,0 +1,266 @@
+// Package movie records the per-frame button inputs (and the tilt for MBC7) and plays them back deterministically.
+package movie
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+	"github.com/akatsuki105/dawngb/core/gb/cartridge"
+)
+
+/*
+ファイルの形式 (リトルエンディアン)
+
+	header
+	flateで圧縮された [SRAM][Snapshot][Inputs][Tilts]
+
+Tilts は flagTilt が立っているときだけあり、フレームごとに float64 の X, Y を持つ (バージョン2 から)
+*/
+
+const version = 2
+
+var magic = [4]uint8{'D', 'M', 'O', 'V'}
+
+var ErrInvalidMovie = errors.New("invalid movie")
+
+const (
+	flagBIOS = 1 << 0
+	flagTilt = 1 << 1
+)
+
+var errTilts = errors.New("the number of tilts does not match the number of frames")
+
+type header struct {
+	Magic        [4]uint8 // "DMOV"
+	Version      uint16
+	Model        uint8
+	Flags        uint8
+	ROMChecksum  uint32 // ROMファイルのCRC32
+	Frames       uint32
+	SRAMSize     uint32
+	SnapshotSize uint32
+}
+
+// Tilt is the tilt of a frame, the arguments of GB.SetTilt.
+type Tilt struct {
+	X, Y float64
+}
+
+// Movie is a recording of the button mask of every frame.
+// The tilt of every frame is also recorded for cartridges with the accelerometer (MBC7).
+type Movie struct {
+	ROMChecksum uint32
+	Model       gb.Model
+	BIOS        bool    // ブートROMから起動したか
+	SRAM        []uint8 // 電源投入時のセーブデータ (RTCのフッタも含む, Snapshot から始まる場合は使わない)
+	Snapshot    []uint8 // GB.SaveState の形式, 空なら電源投入から始まる
+	Inputs      []uint8 // フレームごとの GB.KeyInputs
+	Tilts       []Tilt  // フレームごとの GB.Tilt, 加速度センサーが無ければ空
+}
+
+func (m *Movie) Frames() int { return len(m.Inputs) }
+
+// Write writes the movie to w.
+func (m *Movie) Write(w io.Writer) error {
+	h := header{
+		Magic:        magic,
+		Version:      version,
+		Model:        uint8(m.Model),
+		ROMChecksum:  m.ROMChecksum,
+		Frames:       uint32(len(m.Inputs)),
+		SRAMSize:     uint32(len(m.SRAM)),
+		SnapshotSize: uint32(len(m.Snapshot)),
+	}
+	if m.BIOS {
+		h.Flags |= flagBIOS
+	}
+	if len(m.Tilts) > 0 {
+		if len(m.Tilts) != len(m.Inputs) {
+			return errTilts
+		}
+		h.Flags |= flagTilt
+	}
+	if err := binary.Write(w, binary.LittleEndian, h); err != nil {
+		return err
+	}
+
+	fw, _ := flate.NewWriter(w, flate.BestCompression)
+	for _, data := range [][]uint8{m.SRAM, m.Snapshot, m.Inputs} {
+		if _, err := fw.Write(data); err != nil {
+			return err
+		}
+	}
+	if err := binary.Write(fw, binary.LittleEndian, m.Tilts); err != nil {
+		return err
+	}
+	return fw.Close()
+}
+
+// Read reads a movie written by Movie.Write.
+func Read(r io.Reader) (*Movie, error) {
+	var h header
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidMovie, err)
+	}
+	if h.Magic != magic {
+		return nil, fmt.Errorf("%w: bad magic", ErrInvalidMovie)
+	}
+	if h.Version > version {
+		return nil, fmt.Errorf("%w: version %d is not supported", ErrInvalidMovie, h.Version)
+	}
+
+	m := &Movie{
+		ROMChecksum: h.ROMChecksum,
+		Model:       gb.Model(h.Model),
+		BIOS:        h.Flags&flagBIOS != 0,
+	}
+	fr := flate.NewReader(r)
+	defer fr.Close()
+	for _, c := range []struct {
+		dst  *[]uint8
+		size uint32
+	}{
+		{&m.SRAM, h.SRAMSize},
+		{&m.Snapshot, h.SnapshotSize},
+		{&m.Inputs, h.Frames},
+	} {
+		// 壊れたヘッダで巨大な領域を確保しないように、読めた分だけ伸ばす
+		buf := bytes.Buffer{}
+		if _, err := io.CopyN(&buf, fr, int64(c.size)); err != nil {
+			return nil, fmt.Errorf("%w: truncated", ErrInvalidMovie)
+		}
+		*c.dst = buf.Bytes()
+	}
+	if h.Flags&flagTilt != 0 {
+		buf := bytes.Buffer{}
+		size := int64(h.Frames) * int64(binary.Size(Tilt{}))
+		if _, err := io.CopyN(&buf, fr, size); err != nil {
+			return nil, fmt.Errorf("%w: truncated", ErrInvalidMovie)
+		}
+		m.Tilts = make([]Tilt, h.Frames)
+		binary.Read(&buf, binary.LittleEndian, m.Tilts)
+	}
+	return m, nil
+}
+
+// Recorder records a movie. Call Capture right before each GB.RunFrame.
+type Recorder struct {
+	g     *gb.GB
+	movie *Movie
+	tilt  bool // 加速度センサー(MBC7)の傾きも記録する
+}
+
+// NewRecorder starts recording.
+// If fromSnapshot is false, the emulator is reset and the movie starts from power-on. Otherwise it starts from the current state.
+func NewRecorder(g *gb.GB, fromSnapshot bool) (*Recorder, error) {
+	if g.Cart == nil {
+		return nil, errors.New("no cartridge loaded")
+	}
+	m := &Movie{ROMChecksum: g.Cart.CRC32, Model: g.Model, BIOS: g.HasBIOS()}
+	tilt := g.Cart.Header.HasSensor
+	if fromSnapshot {
+		buf := bytes.Buffer{}
+		if err := g.SaveState(&buf, true); err != nil {
+			return nil, err
+		}
+		m.Snapshot = buf.Bytes()
+	} else {
+		m.SRAM, _ = g.Dump(gb.DUMP_SAVE)
+		if err := loadSave(g, m.SRAM); err != nil { // RTCの1秒未満のカウンタを再生時と揃える
+			return nil, err
+		}
+		powerOn(g, m.BIOS)
+	}
+	return &Recorder{g: g, movie: m, tilt: tilt}, nil
+}
+
+// Capture records the inputs of the frame about to run.
+func (r *Recorder) Capture() {
+	r.movie.Inputs = append(r.movie.Inputs, r.g.KeyInputs())
+	if r.tilt {
+		x, y := r.g.Tilt()
+		r.movie.Tilts = append(r.movie.Tilts, Tilt{x, y})
+	}
+}
+
+// Movie returns the recorded movie so far.
+func (r *Recorder) Movie() *Movie { return r.movie }
+
+// Player plays a movie back. Call Next right before each GB.RunFrame.
+type Player struct {
+	g     *gb.GB
+	movie *Movie
+	frame int
+}
+
+// NewPlayer checks that the movie was recorded with the loaded ROM and model, and restores its starting state.
+func NewPlayer(g *gb.GB, m *Movie) (*Player, error) {
+	if g.Cart == nil {
+		return nil, errors.New("no cartridge loaded")
+	}
+	if m.ROMChecksum != g.Cart.CRC32 {
+		return nil, fmt.Errorf("movie is for another ROM: CRC32 %08X, loaded ROM %08X", m.ROMChecksum, g.Cart.CRC32)
+	}
+	if m.Model != g.Model {
+		return nil, fmt.Errorf("movie is for another model: recorded on model %d, running model %d", m.Model, g.Model)
+	}
+
+	if len(m.Tilts) > 0 && len(m.Tilts) != len(m.Inputs) {
+		return nil, errTilts
+	}
+
+	if len(m.Snapshot) > 0 {
+		if err := g.LoadState(bytes.NewReader(m.Snapshot)); err != nil {
+			return nil, err
+		}
+	} else {
+		if m.BIOS && !g.HasBIOS() {
+			return nil, errors.New("movie was recorded with boot ROM, but it is not loaded")
+		}
+		clear(g.Cart.SRAM()) // 録画時のSRAMが空だった場合に備えて先に消しておく
+		if len(m.SRAM) > 0 {
+			if err := loadSave(g, m.SRAM); err != nil {
+				return nil, err
+			}
+		}
+		powerOn(g, m.BIOS)
+	}
+	return &Player{g: g, movie: m}, nil
+}
+
+// Next sets the inputs of the next frame. It returns false when the movie has ended.
+func (p *Player) Next() bool {
+	if p.frame >= len(p.movie.Inputs) {
+		return false
+	}
+	p.g.SetKeyInputs(p.movie.Inputs[p.frame])
+	if len(p.movie.Tilts) > 0 {
+		t := p.movie.Tilts[p.frame]
+		p.g.SetTilt(t.X, t.Y)
+	}
+	p.frame++
+	return true
+}
+
+// Frame returns the number of frames played.
+func (p *Player) Frame() int { return p.frame }
+
+// RTCが現実の時刻に追いつかないようにして読み込む (録画時と再生時で同じ状態になる)
+func loadSave(g *gb.GB, data []uint8) error {
+	clock := g.Cart.Clock
+	g.Cart.Clock = cartridge.FixedClock{}
+	defer func() { g.Cart.Clock = clock }()
+	return g.Load(gb.LOAD_SAVE, data)
+}
+
+func powerOn(g *gb.GB, bios bool) {
+	g.Reset()
+	if !bios {
+		g.DirectBoot()
+	}
+}
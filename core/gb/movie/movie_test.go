@@ -0,0 +1,45 @@
+package movie
+
+import (
+	"bytes"
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestMovieRoundTrip(t *testing.T) {
+	for _, m := range []*Movie{
+		{ROMChecksum: 0x12345678, Model: 2, BIOS: true, SRAM: []uint8{1, 2, 3}, Inputs: []uint8{0x01, 0x80, 0x00}},
+		{ROMChecksum: 0x9ABCDEF0, Snapshot: []uint8{4, 5}, Inputs: []uint8{0x08, 0x10}, Tilts: []Tilt{{0.5, -0.25}, {-1, 1}}},
+	} {
+		var buf bytes.Buffer
+		if err := m.Write(&buf); err != nil {
+			t.Fatal(err)
+		}
+		got, err := Read(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.ROMChecksum != m.ROMChecksum || got.Model != m.Model || got.BIOS != m.BIOS ||
+			!bytes.Equal(got.SRAM, m.SRAM) || !bytes.Equal(got.Snapshot, m.Snapshot) || !bytes.Equal(got.Inputs, m.Inputs) || !slices.Equal(got.Tilts, m.Tilts) {
+			t.Errorf("%+v, want %+v", got, m)
+		}
+	}
+}
+
+func TestMovieTiltsLength(t *testing.T) {
+	m := &Movie{Inputs: []uint8{0x00, 0x00}, Tilts: []Tilt{{1, 1}}}
+	if err := m.Write(&bytes.Buffer{}); !errors.Is(err, errTilts) {
+		t.Errorf("got %v, want %v", err, errTilts)
+	}
+
+	// 傾きのフレームが足りないものは壊れている
+	var buf bytes.Buffer
+	m.Tilts = []Tilt{{1, 1}, {1, 1}}
+	if err := m.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Read(bytes.NewReader(buf.Bytes()[:buf.Len()-8])); !errors.Is(err, ErrInvalidMovie) {
+		t.Errorf("truncated: %v", err)
+	}
+}
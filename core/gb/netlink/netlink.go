@@ -0,0 +1,363 @@
+// Package netlink connects the serial ports of two emulators over TCP, as if they were connected with a link cable.
+package netlink
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+	"github.com/akatsuki105/dawngb/core/gb/ppu"
+)
+
+/*
+同期の方法
+
+両者ともエミュレーション上の時間を Quantum マスターサイクルごとの区間に区切り、区間 k で起きたシリアル通信のイベントを
+区間の終わりに相手に送る。相手はそれを区間 k+Delay の同じ位置(区間の先頭からのサイクル数)で適用する。
+区間 k+Delay を始める前に相手の区間 k のイベントが届くまで待つので、通信の遅延やタイミングに関係なく、両者の実行結果は常に同じになる。
+
+内部クロック側が転送を始めると、そのバイトを相手に送り、相手がそれを外部クロックで受け取って返したバイトが届いた時点で転送が完了する。
+そのため1バイトの転送には 2*Delay 区間かかる。
+*/
+
+const (
+	DefaultQuantum = 70224 * ppu.CYCLE / 4 // 1/4フレーム
+	DefaultDelay   = 2
+	DefaultTimeout = 10 * time.Second
+)
+
+const version = 1
+
+var magic = [4]uint8{'D', 'L', 'N', 'K'}
+
+var ErrMismatch = errors.New("netlink: options of the peer do not match")
+
+type Options struct {
+	Quantum int64         // 何マスターサイクルごとに同期するか
+	Delay   int           // 相手のイベントを何区間遅らせて適用するか (通信の遅延をこれで吸収する)
+	Timeout time.Duration // 相手からの応答をこれ以上待ったら切断する
+}
+
+type hello struct {
+	Magic   [4]uint8 // "DLNK"
+	Version uint16
+	Delay   uint16
+	Quantum int64
+}
+
+const (
+	eventStart uint8 = iota // 内部クロックで転送を始めた
+	eventReply              // eventStart を外部クロックで受け取り、送り返した
+)
+
+type event struct {
+	Stamp uint32 // 区間の先頭からのマスターサイクル数
+	Kind  uint8
+	Data  uint8
+}
+
+type message struct {
+	Quantum uint32
+	Count   uint16
+}
+
+// 相手のイベントと、それを適用する時刻
+type pending struct {
+	at int64
+	event
+}
+
+type received struct {
+	quantum uint32
+	events  []event
+	err     error
+}
+
+// Link is a link cable over TCP. It is connected to the serial port of the emulator as a cpu.SerialDevice.
+//
+// Both emulators must be started from the same point (e.g. power-on) right after they are connected.
+// The emulation blocks while waiting for the peer, so pausing one side makes the other wait until Timeout.
+// All methods except Close must be called from the goroutine running the emulator.
+type Link struct {
+	OnError func(err error) // 通信が切れたときに呼ばれる (以後は何も繋がっていない状態になる)
+
+	g    *gb.GB
+	conn net.Conn
+	w    *bufio.Writer
+	opts Options
+	recv chan received
+	done chan struct{} // Close されたか、切断されたら閉じる
+	once sync.Once
+	err  error // エミュレーションのゴルーチンだけが触る
+
+	now, start, end int64  // 接続してからのマスターサイクル数, 今の区間の範囲
+	quantum         uint32 // 今の区間
+	outgoing        []event
+	incoming        []pending
+}
+
+// Listen waits for a peer on the TCP address and connects it to g.
+func Listen(addr string, g *gb.GB, opts Options) (*Link, error) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer ln.Close()
+	c, err := ln.Accept()
+	if err != nil {
+		return nil, err
+	}
+	return New(c, g, opts)
+}
+
+// Dial connects to a peer waiting with Listen.
+func Dial(addr string, g *gb.GB, opts Options) (*Link, error) {
+	c, err := net.DialTimeout("tcp", addr, opts.timeout())
+	if err != nil {
+		return nil, err
+	}
+	return New(c, g, opts)
+}
+
+// New exchanges the options with the peer over conn and connects the link to the serial port of g.
+// Both peers must use the same Quantum and Delay.
+func New(conn net.Conn, g *gb.GB, opts Options) (*Link, error) {
+	if opts.Quantum <= 0 {
+		opts.Quantum = DefaultQuantum
+	}
+	if opts.Delay <= 0 {
+		opts.Delay = DefaultDelay
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = DefaultTimeout
+	}
+
+	l := &Link{
+		g:    g,
+		conn: conn,
+		w:    bufio.NewWriter(conn),
+		opts: opts,
+		recv: make(chan received, opts.Delay+1),
+		done: make(chan struct{}),
+		end:  opts.Quantum,
+	}
+	if err := l.handshake(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go l.readLoop(bufio.NewReader(conn))
+	g.CPU.Serial.Connect(l)
+	return l, nil
+}
+
+func (o Options) timeout() time.Duration {
+	if o.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return o.Timeout
+}
+
+func (l *Link) handshake() error {
+	l.conn.SetDeadline(time.Now().Add(l.opts.Timeout))
+	defer l.conn.SetDeadline(time.Time{})
+
+	h := hello{Magic: magic, Version: version, Delay: uint16(l.opts.Delay), Quantum: l.opts.Quantum}
+	if err := binary.Write(l.w, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	if err := l.w.Flush(); err != nil {
+		return err
+	}
+
+	var peer hello
+	if err := binary.Read(l.conn, binary.LittleEndian, &peer); err != nil {
+		return err
+	}
+	switch {
+	case peer.Magic != magic:
+		return errors.New("netlink: peer is not a DawnGB link")
+	case peer.Version != version:
+		return fmt.Errorf("netlink: peer uses protocol version %d, expected %d", peer.Version, version)
+	case peer.Delay != h.Delay || peer.Quantum != h.Quantum:
+		return fmt.Errorf("%w: delay %d, quantum %d", ErrMismatch, peer.Delay, peer.Quantum)
+	}
+	return nil
+}
+
+// Close disconnects the link. It can be called from any goroutine.
+// The link is detached from the serial port by the emulator at the next synchronization, without calling OnError.
+func (l *Link) Close() error {
+	l.shutdown()
+	return nil
+}
+
+// RemoteAddr returns the address of the peer.
+func (l *Link) RemoteAddr() net.Addr { return l.conn.RemoteAddr() }
+
+// Err returns the error which stopped the link, or nil if it is connected.
+func (l *Link) Err() error {
+	if errors.Is(l.err, net.ErrClosed) {
+		return nil
+	}
+	return l.err
+}
+
+// 通信を止める 待っている Run と readLoop はこれで抜ける
+func (l *Link) shutdown() {
+	l.once.Do(func() {
+		close(l.done)
+		l.conn.Close()
+	})
+}
+
+func (l *Link) closed() bool {
+	select {
+	case <-l.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// エミュレーションのゴルーチンから呼ぶ
+func (l *Link) fail(err error) {
+	if l.err != nil {
+		return
+	}
+	if l.closed() { // Close されたので、接続を切ったことによるエラーは無視する
+		err = net.ErrClosed
+	}
+	l.err = err
+	l.shutdown()
+	l.g.CPU.Serial.Connect(nil)
+	l.g.CPU.Serial.CompleteTransfer(0xFF) // 返事を待っている転送は、何も繋がっていないときと同じ結果にする
+	if l.OnError != nil && !errors.Is(err, net.ErrClosed) {
+		l.OnError(err)
+	}
+}
+
+// Exchange implements cpu.SerialDevice. Transfers with internal clock go through StartTransfer, so it is never called.
+func (l *Link) Exchange(out bool) bool { return true }
+
+// StartTransfer implements cpu.ByteSerialDevice.
+func (l *Link) StartTransfer(out uint8) {
+	l.record(eventStart, out)
+}
+
+// Run implements cpu.ClockedSerialDevice. It applies the events of the peer and synchronizes at the end of every quantum.
+func (l *Link) Run(cycles8MHz int64) {
+	l.now += cycles8MHz
+	for l.err == nil {
+		for len(l.incoming) > 0 && l.incoming[0].at <= l.now {
+			ev := l.incoming[0]
+			l.incoming = l.incoming[1:]
+			l.apply(ev.event)
+		}
+		if l.now < l.end {
+			return
+		}
+		if err := l.next(); err != nil {
+			l.fail(err)
+		}
+	}
+}
+
+func (l *Link) record(kind, data uint8) {
+	l.outgoing = append(l.outgoing, event{Stamp: uint32(l.now - l.start), Kind: kind, Data: data})
+}
+
+func (l *Link) apply(ev event) {
+	serial := l.g.CPU.Serial
+	switch ev.Kind {
+	case eventStart:
+		// 相手が出したクロックで1ビットずつ交換する (外部クロックで待っていなければ 0xFF が返る)
+		out := uint8(0)
+		for i := 7; i >= 0; i-- {
+			out <<= 1
+			if serial.Exchange((ev.Data>>i)&1 != 0) {
+				out |= 1
+			}
+		}
+		l.record(eventReply, out)
+	case eventReply:
+		serial.CompleteTransfer(ev.Data)
+	}
+}
+
+// 今の区間のイベントを送り、次の区間で適用する相手のイベントを受け取る
+func (l *Link) next() error {
+	if l.closed() {
+		return net.ErrClosed
+	}
+	if err := l.send(); err != nil {
+		return err
+	}
+	l.quantum++
+	l.start, l.end = l.end, l.end+l.opts.Quantum
+	if int(l.quantum) < l.opts.Delay {
+		return nil
+	}
+
+	want := l.quantum - uint32(l.opts.Delay)
+	select {
+	case r := <-l.recv:
+		if r.err != nil {
+			return r.err
+		}
+		if r.quantum != want {
+			return fmt.Errorf("netlink: received quantum %d, expected %d", r.quantum, want)
+		}
+		for _, ev := range r.events {
+			l.incoming = append(l.incoming, pending{l.start + int64(ev.Stamp), ev})
+		}
+		return nil
+	case <-l.done:
+		return net.ErrClosed
+	case <-time.After(l.opts.Timeout):
+		return errors.New("netlink: peer timed out")
+	}
+}
+
+func (l *Link) send() error {
+	l.conn.SetWriteDeadline(time.Now().Add(l.opts.Timeout))
+	msg := message{Quantum: l.quantum, Count: uint16(len(l.outgoing))}
+	if err := binary.Write(l.w, binary.LittleEndian, msg); err != nil {
+		return err
+	}
+	if err := binary.Write(l.w, binary.LittleEndian, l.outgoing); err != nil {
+		return err
+	}
+	l.outgoing = l.outgoing[:0]
+	return l.w.Flush()
+}
+
+func (l *Link) readLoop(r io.Reader) {
+	for {
+		var msg message
+		err := binary.Read(r, binary.LittleEndian, &msg)
+		var events []event
+		if err == nil {
+			events = make([]event, msg.Count)
+			err = binary.Read(r, binary.LittleEndian, events)
+		}
+		if err == io.EOF {
+			err = errors.New("netlink: peer disconnected")
+		}
+
+		select {
+		case l.recv <- received{msg.Quantum, events, err}:
+		case <-l.done:
+			return
+		}
+		if err != nil {
+			return
+		}
+	}
+}
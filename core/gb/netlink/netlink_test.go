@@ -0,0 +1,144 @@
+package netlink
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+)
+
+// 0x0150 で止まっているだけのROM
+func testROM() []uint8 {
+	rom := make([]uint8, 32*1024)
+	copy(rom[0x100:], []uint8{0x00, 0xC3, 0x50, 0x01})
+	copy(rom[0x134:], "LINK")
+	copy(rom[0x150:], []uint8{0x18, 0xFE})
+	sum := uint8(0)
+	for _, b := range rom[0x134:0x14D] {
+		sum = sum - b - 1
+	}
+	rom[0x14D] = sum
+	return rom
+}
+
+func newTestGB(t *testing.T) *gb.GB {
+	t.Helper()
+	g := gb.New(gb.MODEL_DMG, nil)
+	if err := g.LoadROM(testROM()); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+// localhost で2台を繋ぐ
+func newTestLinks(t *testing.T) (g1, g2 *gb.GB, l1, l2 *Link) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	g1, g2 = newTestGB(t), newTestGB(t)
+	opts := Options{Timeout: 5 * time.Second}
+	type result struct {
+		l   *Link
+		err error
+	}
+	accepted := make(chan result)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			accepted <- result{nil, err}
+			return
+		}
+		l, err := New(c, g2, opts)
+		accepted <- result{l, err}
+	}()
+	l1, err = Dial(ln.Addr().String(), g1, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := <-accepted
+	if r.err != nil {
+		t.Fatal(r.err)
+	}
+	return g1, g2, l1, r.l
+}
+
+func TestLinkRoundTrip(t *testing.T) {
+	g1, g2, l1, l2 := newTestLinks(t)
+	defer l1.Close()
+	defer l2.Close()
+
+	g1.Write(0xFF01, 0x42)
+	g1.Write(0xFF02, 0x81) // 内部クロックで送る
+	g2.Write(0xFF01, 0x99)
+	g2.Write(0xFF02, 0x80) // 外部クロックで待つ
+
+	// 相手を待ってブロックするので、別々のゴルーチンで動かす
+	done := make(chan struct{})
+	go func() {
+		for range 4 {
+			g2.RunFrame()
+		}
+		close(done)
+	}()
+	for range 4 {
+		g1.RunFrame()
+	}
+	<-done
+
+	if a, b := g1.Read(0xFF01), g2.Read(0xFF01); a != 0x99 || b != 0x42 {
+		t.Errorf("SB 0x%02X, 0x%02X; want 0x99, 0x42", a, b)
+	}
+	if sc := g1.Read(0xFF02); sc&0x80 != 0 {
+		t.Errorf("transfer is not completed: SC 0x%02X", sc)
+	}
+	if err := l1.Err(); err != nil {
+		t.Error(err)
+	}
+}
+
+// 動いているエミュレータのリンクを別のゴルーチンから閉じる
+func TestLinkCloseWhileRunning(t *testing.T) {
+	g1, g2, l1, l2 := newTestLinks(t)
+	peerErr := make(chan error, 1)
+	l2.OnError = func(err error) { peerErr <- err }
+	l1.OnError = func(err error) { t.Errorf("OnError is called after Close: %v", err) }
+
+	go func() {
+		for l2.Err() == nil {
+			g2.RunFrame()
+		}
+	}()
+	detached := make(chan error)
+	go func() {
+		for g1.CPU.Serial.Device() != nil {
+			g1.RunFrame()
+		}
+		detached <- l1.Err()
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	l1.Close()
+	l1.Close()
+
+	select {
+	case err := <-detached:
+		if err != nil {
+			t.Errorf("Err after Close: %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("the link is not detached after Close")
+	}
+	select {
+	case err := <-peerErr:
+		if err == nil {
+			t.Error("peer got nil error")
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("peer did not notice the disconnection")
+	}
+}
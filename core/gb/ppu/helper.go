@@ -1,5 +1,7 @@
 package ppu
 
+import "image/color"
+
 type rgb555 = uint16 // Litte Endian (0b0BBBBBGGGGGRRRRR); e.g. 0x6180 is RGB555(0, 12, 24)
 
 var dmgPalette = [4]rgb555{
@@ -23,3 +25,18 @@ var cgbPalette = [8]rgb555{
 	0x1CF2, // (18, 7, 7)
 	0x0000, // (0, 0, 0)
 }
+
+// DMGShade returns the shade (0: white .. 3: black) of a pixel drawn with the DMG palette.
+// Super Game Boy colours the screen with these shades, as it only receives the 2bit output of the LCD.
+func DMGShade(c color.NRGBA) uint8 {
+	shade, diff := uint8(0), 0x100
+	for i, p := range dmgPalette {
+		r5 := uint8(p & 0x1F)
+		d := int(c.R) - int((r5<<3)|(r5>>2))
+		d = max(d, -d)
+		if d < diff {
+			shade, diff = uint8(i), d
+		}
+	}
+	return shade
+}
@@ -72,10 +72,16 @@ func New(cpu CPU) *PPU {
 }
 
 func (p *PPU) Reset() {
+	// 前回の実行の内容が残っているとムービーの再生結果が変わるので、メモリも含めて全部初期化する
+	clear(p.RAM.Data[:])
+	clear(p.OAM[:])
+	clear(p.ioreg[:])
 	p.r = software.New(p.RAM.Data[:], p.Palette[:], p.OAM[:], p.cpu.IsCGBMode)
+	p.cycles = 0
 	p.Frame = 0
 	p.Lx, p.Ly = 0, 0
-	p.STAT = 0x80
+	p.LCDC, p.STAT, p.LYC = 0, 0x80, 0
+	p.enableLatch = false
 	p.RAM.Bank = 0
 	p.objCount = 0
 	p.DMA.Active, p.DMA.Src, p.DMA.Until = false, 0, 0
@@ -94,6 +100,13 @@ func (p *PPU) Screen() []color.NRGBA {
 	return p.screen[:]
 }
 
+// Blank fills the screen with white. (e.g. LCD is not driven during STOP mode)
+func (p *PPU) Blank() {
+	for i := range p.screen {
+		p.screen[i] = color.NRGBA{0xFF, 0xFF, 0xFF, 0xFF}
+	}
+}
+
 func (p *PPU) Run(cycles8MHz int64) {
 	if p.DMA.Active {
 		p.runDMA(cycles8MHz)
@@ -0,0 +1,316 @@
+// Package printer emulates the Game Boy Printer connected to the serial port.
+package printer
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+/*
+パケットの形式 (GBが内部クロックで1バイトずつ送る)
+
+	0x88 0x33 command compression lengthLo lengthHi data... checksumLo checksumHi 0x00 0x00
+
+チェックサムは command から data の最後までの和
+最後の2バイトの間、プリンタは 0x81 (接続されている) とステータスを返す それ以外は 0x00 を返す
+*/
+
+const (
+	cmdInit   = 0x01
+	cmdPrint  = 0x02
+	cmdData   = 0x04
+	cmdBreak  = 0x08
+	cmdStatus = 0x0F
+)
+
+// ステータス
+const (
+	statusChecksum    = 1 << 0
+	statusBusy        = 1 << 1 // 印刷中
+	statusFull        = 1 << 2 // バッファがいっぱい
+	statusUnprocessed = 1 << 3 // まだ印刷していないデータがある
+	statusPacketError = 1 << 4
+)
+
+const (
+	width      = 160
+	bufferSize = width * 144 / 4 // 2bppで160x144ピクセル分 (DATAパケット9個)
+	marginUnit = 8               // 余白1単位のピクセル数
+	alive      = 0x81
+
+	// 16ピクセルの帯1つを印刷するのにかかるマスターサイクル数 (1/8秒)
+	bandCycles = 8 * 1024 * 1024 / 8
+)
+
+// 感熱紙なので白黒の4階調
+var palette = color.Palette{
+	color.Gray{0xFF},
+	color.Gray{0xAA},
+	color.Gray{0x55},
+	color.Gray{0x00},
+}
+
+// パケットの受信状態
+type state uint8
+
+const (
+	stateMagic1 state = iota
+	stateMagic2
+	stateCommand
+	stateCompression
+	stateLengthLo
+	stateLengthHi
+	stateData
+	stateChecksumLo
+	stateChecksumHi
+	stateAlive
+	stateStatus
+)
+
+// Printer is a Game Boy Printer. Connect it to the serial port with cpu.Serial.Connect.
+type Printer struct {
+	// OnPrint is called with the printed paper when a print is finished, i.e. when the Game Boy feeds the paper after the image.
+	OnPrint func(img image.Image)
+
+	status uint8
+	busy   int64   // 印刷が終わるまでのマスターサイクル数
+	buffer []uint8 // 受け取った画像データ (2bppのタイルを横に20枚ずつ並べたもの)
+	paper  []uint8 // 印刷済みで、まだ切り取っていない紙 (1ピクセル1バイトの階調)
+
+	// 受信中のパケット
+	state       state
+	command     uint8
+	compression bool
+	length      uint16
+	data        []uint8
+	checksum    uint16 // 計算したもの
+	received    uint16 // パケットに書かれているもの
+
+	in, out uint8 // シフトレジスタ
+	bits    int
+}
+
+func New() *Printer {
+	return &Printer{}
+}
+
+// Exchange implements cpu.SerialDevice.
+func (p *Printer) Exchange(out bool) bool {
+	in := p.out&0x80 != 0
+	p.out <<= 1
+	p.in <<= 1
+	if out {
+		p.in |= 1
+	}
+	p.bits++
+	if p.bits == 8 {
+		p.bits = 0
+		p.out = p.receive(p.in)
+	}
+	return in
+}
+
+// Run implements cpu.ClockedSerialDevice.
+func (p *Printer) Run(cycles8MHz int64) {
+	if p.busy > 0 {
+		p.busy -= cycles8MHz
+		if p.busy <= 0 {
+			p.status &^= statusBusy
+		}
+	}
+}
+
+// 1バイト受け取って、次に送るバイトを返す
+func (p *Printer) receive(b uint8) uint8 {
+	switch p.state {
+	case stateMagic1:
+		if b == 0x88 {
+			p.state = stateMagic2
+		}
+	case stateMagic2:
+		switch b {
+		case 0x33:
+			p.state = stateCommand
+			p.checksum = 0
+		case 0x88:
+		default:
+			p.state = stateMagic1
+		}
+	case stateCommand:
+		p.command = b
+		p.checksum += uint16(b)
+		p.state = stateCompression
+	case stateCompression:
+		p.compression = b&0x01 != 0
+		p.checksum += uint16(b)
+		p.state = stateLengthLo
+	case stateLengthLo:
+		p.length = uint16(b)
+		p.checksum += uint16(b)
+		p.state = stateLengthHi
+	case stateLengthHi:
+		p.length |= uint16(b) << 8
+		p.checksum += uint16(b)
+		p.data = p.data[:0]
+		p.state = stateData
+		if p.length == 0 {
+			p.state = stateChecksumLo
+		}
+	case stateData:
+		p.data = append(p.data, b)
+		p.checksum += uint16(b)
+		if len(p.data) >= int(p.length) {
+			p.state = stateChecksumLo
+		}
+	case stateChecksumLo:
+		p.received = uint16(b)
+		p.state = stateChecksumHi
+	case stateChecksumHi:
+		p.received |= uint16(b) << 8
+		p.state = stateAlive
+		return alive
+	case stateAlive:
+		p.execute()
+		p.state = stateStatus
+		return p.status
+	case stateStatus:
+		p.state = stateMagic1
+	}
+	return 0x00
+}
+
+func (p *Printer) execute() {
+	if p.received != p.checksum {
+		p.status |= statusChecksum
+		return
+	}
+	p.status &^= statusChecksum
+
+	switch p.command {
+	case cmdInit:
+		p.buffer = p.buffer[:0]
+		p.status = 0
+	case cmdData:
+		data := p.data
+		if p.compression {
+			data = decompress(data)
+		}
+		p.buffer = append(p.buffer, data[:min(len(data), bufferSize-len(p.buffer))]...)
+		if len(p.buffer) > 0 {
+			p.status |= statusUnprocessed
+		}
+		if len(p.buffer) >= bufferSize {
+			p.status |= statusFull
+		}
+	case cmdPrint:
+		if len(p.data) < 4 {
+			p.status |= statusPacketError
+			return
+		}
+		p.print(p.data[0], p.data[1], p.data[2])
+	case cmdBreak:
+		p.buffer = p.buffer[:0]
+		p.status &^= statusBusy | statusFull | statusUnprocessed
+		p.busy = 0
+	case cmdStatus:
+	default:
+		p.status |= statusPacketError
+	}
+}
+
+// RLE: 制御バイトのbit7が立っていれば、次の1バイトを (n&0x7F)+2 回繰り返す そうでなければ続く n+1 バイトをそのまま使う
+func decompress(data []uint8) []uint8 {
+	out := make([]uint8, 0, len(data)*2)
+	for i := 0; i < len(data); {
+		n := data[i]
+		i++
+		if n&0x80 != 0 {
+			if i >= len(data) {
+				break
+			}
+			for range int(n&0x7F) + 2 {
+				out = append(out, data[i])
+			}
+			i++
+		} else {
+			end := min(i+int(n)+1, len(data))
+			out = append(out, data[i:end]...)
+			i = end
+		}
+	}
+	return out
+}
+
+// margins の上位4ビットが印刷前、下位4ビットが印刷後の紙送りの量
+// 印刷後に紙送りがあれば、そこで1枚の印刷が終わったものとして OnPrint を呼ぶ
+func (p *Printer) print(sheets, margins, pal uint8) {
+	before, after := int(margins>>4), int(margins&0x0F)
+	p.feed(before)
+
+	rows := 0
+	if sheets > 0 {
+		rows = len(p.buffer) / (width / 4) // 1行40バイト (2bppで160ピクセル)
+		for range sheets {
+			p.paper = append(p.paper, render(p.buffer, pal)...)
+		}
+	}
+	p.buffer = p.buffer[:0]
+
+	p.feed(after)
+	if after > 0 && len(p.paper) > 0 {
+		p.cut()
+	}
+
+	p.status &^= statusFull | statusUnprocessed
+	p.status |= statusBusy
+	p.busy = int64((rows+15)/16*int(max(sheets, 1))+before+after) * bandCycles
+}
+
+func (p *Printer) feed(n int) {
+	p.paper = append(p.paper, make([]uint8, n*marginUnit*width)...)
+}
+
+func (p *Printer) cut() {
+	img := image.NewPaletted(image.Rect(0, 0, width, len(p.paper)/width), palette)
+	copy(img.Pix, p.paper)
+	p.paper = nil
+	if p.OnPrint != nil {
+		p.OnPrint(img)
+	}
+}
+
+// 2bppのタイルを横20枚ずつ並べたデータを1ピクセル1バイトにする
+func render(buffer []uint8, pal uint8) []uint8 {
+	const tilesPerRow = width / 8
+	rows := len(buffer) / (16 * tilesPerRow) * 8
+	pixels := make([]uint8, rows*width)
+	for y := range rows {
+		for x := range width {
+			tile := (y/8)*tilesPerRow + x/8
+			lo, hi := buffer[tile*16+(y%8)*2], buffer[tile*16+(y%8)*2+1]
+			bit := 7 - uint(x%8)
+			c := ((hi>>bit)&1)<<1 | (lo>>bit)&1
+			pixels[y*width+x] = (pal >> (c * 2)) & 0b11
+		}
+	}
+	return pixels
+}
+
+// WritePNG writes img to a new PNG file in dir and returns its path.
+func WritePNG(dir string, img image.Image) (string, error) {
+	name := filepath.Join(dir, fmt.Sprintf("print-%s.png", time.Now().Format("20060102-150405.000")))
+	f, err := os.Create(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		return "", err
+	}
+	return name, nil
+}
@@ -0,0 +1,211 @@
+// Package rewind keeps recent emulator states in memory and plays the game backwards.
+package rewind
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+)
+
+const (
+	DefaultInterval = 2  // frames
+	DefaultSeconds  = 60 // seconds
+	framesPerSecond = 60
+)
+
+var errSnapshot = errors.New("failed to take snapshot")
+
+type Options struct {
+	Interval int // 何フレームごとにスナップショットを取るか
+	Seconds  int // 何秒前まで巻き戻せるか
+}
+
+// 1つ新しいスナップショットとのXORをflateで圧縮したもの
+type delta struct {
+	frame uint64
+	data  []uint8
+}
+
+// 1フレームの入力
+type input struct {
+	keys uint8   // GB.KeyInputs
+	x, y float64 // GB.Tilt (MBC7の加速度センサー)
+}
+
+// Rewinder records the state every Interval frames and the inputs (buttons and tilt) of every frame.
+//
+// Call Capture right before each GB.RunFrame. Only the newest snapshot is kept as is, and older ones are kept as compressed deltas against the next newer one,
+// so that dropping the oldest snapshot is cheap and walking backwards only needs to decode one delta per snapshot.
+type Rewinder struct {
+	g        *gb.GB
+	interval uint64
+	capacity uint64 // frames
+
+	frame       uint64 // 次に実行するフレーム
+	latest      []uint8
+	latestFrame uint64
+	deltas      []delta // 古い順
+	inputs      []input // inputs[i] は frame (base+i) の入力
+	base        uint64
+
+	buf bytes.Buffer
+	fw  *flate.Writer
+}
+
+func New(g *gb.GB, opts Options) *Rewinder {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultInterval
+	}
+	if opts.Seconds <= 0 {
+		opts.Seconds = DefaultSeconds
+	}
+	fw, _ := flate.NewWriter(nil, flate.BestSpeed)
+	return &Rewinder{
+		g:        g,
+		interval: uint64(opts.Interval),
+		capacity: uint64(opts.Seconds * framesPerSecond),
+		fw:       fw,
+	}
+}
+
+// Reset discards the history. Call it after loading a ROM or a save state.
+func (r *Rewinder) Reset() {
+	r.frame, r.base = 0, 0
+	r.latest, r.deltas, r.inputs = nil, nil, nil
+}
+
+// Frames returns how many frames can be rewound.
+func (r *Rewinder) Frames() int {
+	if r.latest == nil {
+		return 0
+	}
+	return int(r.frame - r.oldest())
+}
+
+// Capture records the inputs of the frame about to run, and the state every Interval frames.
+func (r *Rewinder) Capture() error {
+	x, y := r.g.Tilt()
+	r.inputs = append(r.inputs, input{r.g.KeyInputs(), x, y})
+
+	if r.frame%r.interval == 0 && (r.latest == nil || r.frame > r.latestFrame) {
+		if err := r.push(); err != nil {
+			return err
+		}
+	}
+	r.frame++
+	return nil
+}
+
+func (r *Rewinder) push() error {
+	r.buf.Reset()
+	if !r.g.Serialize(&r.buf) {
+		return errSnapshot
+	}
+	state := bytes.Clone(r.buf.Bytes())
+
+	if r.latest != nil {
+		data, err := r.compress(xor(r.latest, state))
+		if err != nil {
+			return err
+		}
+		r.deltas = append(r.deltas, delta{r.latestFrame, data})
+	}
+	r.latest, r.latestFrame = state, r.frame
+
+	// 古すぎるものを捨てる
+	for len(r.deltas) > 0 && r.frame-r.deltas[0].frame > r.capacity {
+		r.deltas = r.deltas[1:]
+	}
+	if oldest := r.oldest(); oldest > r.base {
+		r.inputs = r.inputs[oldest-r.base:]
+		r.base = oldest
+	}
+	return nil
+}
+
+// Rewind goes back the given number of frames and returns how many frames were actually rewound.
+// The state is restored from the nearest older snapshot and the frames in between are replayed with the recorded inputs (with audio muted).
+func (r *Rewinder) Rewind(frames int) (int, error) {
+	if r.latest == nil || frames <= 0 {
+		return 0, nil
+	}
+	target := r.frame - min(uint64(frames), r.frame-r.oldest())
+
+	// 画面も巻き戻すため、可能なら target より前のスナップショットから1フレーム以上再実行する
+	for len(r.deltas) > 0 && r.latestFrame >= target {
+		if err := r.pop(); err != nil {
+			return 0, err
+		}
+	}
+	if !r.g.Deserialize(bytes.NewReader(r.latest)) {
+		return 0, errSnapshot
+	}
+
+	mute := r.g.APU.Mute
+	r.g.APU.Mute = true
+	for f := r.latestFrame; f < target; f++ {
+		in := r.inputs[f-r.base]
+		r.g.SetKeyInputs(in.keys)
+		r.g.SetTilt(in.x, in.y)
+		r.g.RunFrame()
+	}
+	r.g.APU.Mute = mute
+
+	rewound := int(r.frame - target)
+	r.frame = target
+	r.inputs = r.inputs[:target-r.base]
+	return rewound, nil
+}
+
+// 1つ古いスナップショットに戻す
+func (r *Rewinder) pop() error {
+	d := r.deltas[len(r.deltas)-1]
+	data, err := r.decompress(d.data, len(r.latest))
+	if err != nil {
+		return err
+	}
+	r.latest, r.latestFrame = xor(r.latest, data), d.frame
+	r.deltas = r.deltas[:len(r.deltas)-1]
+	return nil
+}
+
+func (r *Rewinder) oldest() uint64 {
+	if len(r.deltas) > 0 {
+		return r.deltas[0].frame
+	}
+	return r.latestFrame
+}
+
+func (r *Rewinder) compress(data []uint8) ([]uint8, error) {
+	r.buf.Reset()
+	r.fw.Reset(&r.buf)
+	if _, err := r.fw.Write(data); err != nil {
+		return nil, err
+	}
+	if err := r.fw.Close(); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(r.buf.Bytes()), nil
+}
+
+func (r *Rewinder) decompress(data []uint8, size int) ([]uint8, error) {
+	fr := flate.NewReader(bytes.NewReader(data))
+	defer fr.Close()
+	out := make([]uint8, size)
+	if _, err := io.ReadFull(fr, out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// スナップショットの大部分は変化しないので、XORを取るとほとんど0になり圧縮が効く
+func xor(a, b []uint8) []uint8 {
+	out := make([]uint8, len(b))
+	for i := range out {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
@@ -0,0 +1,45 @@
+package rewind
+
+import (
+	"testing"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+)
+
+// 0x0150 で止まっているだけの MBC7 のROM
+func mbc7ROM() []uint8 {
+	rom := make([]uint8, 32*1024)
+	copy(rom[0x100:], []uint8{0x00, 0xC3, 0x50, 0x01})
+	copy(rom[0x134:], "TILT")
+	rom[0x147] = 0x22
+	copy(rom[0x150:], []uint8{0x18, 0xFE})
+	sum := uint8(0)
+	for _, b := range rom[0x134:0x14D] {
+		sum = sum - b - 1
+	}
+	rom[0x14D] = sum
+	return rom
+}
+
+func TestRewindReplaysTilt(t *testing.T) {
+	g := gb.New(gb.MODEL_CGB, nil)
+	if err := g.LoadROM(mbc7ROM()); err != nil {
+		t.Fatal(err)
+	}
+	r := New(g, Options{})
+	for i := range 10 {
+		g.SetTilt(float64(i)/10, -float64(i)/10)
+		if err := r.Capture(); err != nil {
+			t.Fatal(err)
+		}
+		g.RunFrame()
+	}
+
+	// フレーム7 に戻すと、フレーム6 までが記録した入力で再実行される
+	if n, err := r.Rewind(3); err != nil || n != 3 {
+		t.Fatalf("rewound %d frames: %v", n, err)
+	}
+	if x, y := g.Tilt(); x != 0.6 || y != -0.6 {
+		t.Errorf("tilt (%v, %v), want (0.6, -0.6)", x, y)
+	}
+}
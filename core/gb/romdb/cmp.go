@@ -0,0 +1,146 @@
+package romdb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ClrMamePro の形式
+
+	clrmamepro (
+		name "Nintendo - Game Boy"
+	)
+
+	game (
+		name "Tetris (World) (Rev 1)"
+		description "Tetris (World) (Rev 1)"
+		rom ( name "Tetris (World) (Rev 1).gb" size 32768 crc 46DF91AD sha1 ... flags verified )
+	)
+*/
+
+// key value または key ( ... ) の並び
+type cmpNode struct {
+	key, value string
+	children   []cmpNode
+}
+
+type cmpLexer struct {
+	data []uint8
+	pos  int
+}
+
+// 次のトークン ( と ) はそれぞれ1つのトークン 文字列なら quoted が true
+func (l *cmpLexer) next() (tok string, quoted bool, ok bool) {
+	for l.pos < len(l.data) && strings.IndexByte(" \t\r\n", l.data[l.pos]) >= 0 {
+		l.pos++
+	}
+	if l.pos >= len(l.data) {
+		return "", false, false
+	}
+	start := l.pos
+	switch l.data[l.pos] {
+	case '(', ')':
+		l.pos++
+		return string(l.data[start:l.pos]), false, true
+	case '"':
+		end := bytes.IndexByte(l.data[start+1:], '"')
+		if end < 0 {
+			l.pos = len(l.data)
+			return string(l.data[start+1:]), true, true
+		}
+		l.pos = start + 1 + end + 1
+		return string(l.data[start+1 : start+1+end]), true, true
+	}
+	for l.pos < len(l.data) && strings.IndexByte(" \t\r\n()\"", l.data[l.pos]) < 0 {
+		l.pos++
+	}
+	return string(l.data[start:l.pos]), false, true
+}
+
+// ) か終端までの key value の並びを読む
+func (l *cmpLexer) block(depth int) ([]cmpNode, error) {
+	var nodes []cmpNode
+	for {
+		key, quoted, ok := l.next()
+		if !ok {
+			if depth > 0 {
+				return nil, errors.New("unexpected end of file")
+			}
+			return nodes, nil
+		}
+		if key == ")" && !quoted {
+			if depth == 0 {
+				return nil, errors.New("unexpected ')'")
+			}
+			return nodes, nil
+		}
+
+		val, quoted, ok := l.next()
+		if !ok {
+			return nil, fmt.Errorf("no value for %q", key)
+		}
+		n := cmpNode{key: key}
+		if val == "(" && !quoted {
+			children, err := l.block(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			n.children = children
+		} else {
+			n.value = val
+		}
+		nodes = append(nodes, n)
+	}
+}
+
+func (n *cmpNode) get(key string) string {
+	for _, c := range n.children {
+		if c.key == key {
+			return c.value
+		}
+	}
+	return ""
+}
+
+func parseCMP(db *DB, data []uint8) error {
+	l := &cmpLexer{data: data}
+	nodes, err := l.block(0)
+	if err != nil {
+		return err
+	}
+	for _, n := range nodes {
+		switch n.key {
+		case "clrmamepro":
+			db.Name = n.get("name")
+		case "game", "machine":
+			g := &Game{Name: n.get("name"), Description: n.get("description")}
+			for _, c := range n.children {
+				if c.key != "rom" || c.get("crc") == "" {
+					continue
+				}
+				crc, err := parseCRC(c.get("crc"))
+				if err != nil {
+					return err
+				}
+				size, _ := strconv.ParseInt(c.get("size"), 10, 64)
+				status := c.get("status")
+				if status == "" {
+					status = c.get("flags") // libretro-database
+				}
+				g.ROMs = append(g.ROMs, ROM{
+					Name:   c.get("name"),
+					Size:   size,
+					CRC32:  crc,
+					SHA1:   strings.ToLower(c.get("sha1")),
+					Status: status,
+				})
+			}
+			db.add(g)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+// Package romdb identifies ROMs with a DAT file of No-Intro, Redump or libretro-database.
+//
+// Both the Logiqx XML format and the ClrMamePro text format are supported. Nothing is downloaded; the DAT file must be on the local disk.
+package romdb
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidDAT = errors.New("invalid DAT file")
+
+// Game is an entry of the DAT file.
+type Game struct {
+	Name        string // "Tetris (World) (Rev 1)"
+	Description string
+	Region      string // "World", "USA, Europe" など (名前の最初の括弧)
+	Revision    string // "1", "A", "v1.1" など 無ければ ""
+	ROMs        []ROM
+}
+
+// ROM is a file of the Game.
+type ROM struct {
+	Name   string
+	Size   int64
+	CRC32  uint32
+	SHA1   string // 小文字の16進数 DATに無ければ ""
+	Status string // "verified", "baddump", "nodump" または ""
+}
+
+// Verified returns true if the dump has been verified by several people.
+func (r *ROM) Verified() bool { return r.Status == "verified" }
+
+// BadDump returns true if the DAT lists the dump as known to be bad.
+func (r *ROM) BadDump() bool { return r.Status == "baddump" }
+
+// Match is the result of Identify.
+type Match struct {
+	*Game
+	ROM *ROM
+}
+
+// DB is the parsed DAT file.
+type DB struct {
+	Name  string // "Nintendo - Game Boy" など
+	Games []*Game
+
+	bySHA1 map[string]Match
+	byCRC  map[uint32][]Match
+}
+
+// Open parses the DAT files at paths and merges them. (e.g. Game Boy and Game Boy Color)
+func Open(paths ...string) (*DB, error) {
+	db := newDB()
+	for _, path := range paths {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		d, err := Parse(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if db.Name == "" {
+			db.Name = d.Name
+		}
+		for _, g := range d.Games {
+			db.add(g)
+		}
+	}
+	return db, nil
+}
+
+// Parse reads a DAT file in the Logiqx XML format or the ClrMamePro format.
+func Parse(r io.Reader) (*DB, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	data = bytes.TrimPrefix(data, []uint8{0xEF, 0xBB, 0xBF}) // UTF-8 BOM
+	data = bytes.TrimLeft(data, " \t\r\n")
+
+	db := newDB()
+	if bytes.HasPrefix(data, []uint8("<")) {
+		err = parseXML(db, data)
+	} else {
+		err = parseCMP(db, data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidDAT, err)
+	}
+	return db, nil
+}
+
+func newDB() *DB {
+	return &DB{
+		bySHA1: make(map[string]Match),
+		byCRC:  make(map[uint32][]Match),
+	}
+}
+
+func (db *DB) add(g *Game) {
+	g.Region, g.Revision = parseName(g.Name)
+	db.Games = append(db.Games, g)
+	for i := range g.ROMs {
+		m := Match{g, &g.ROMs[i]}
+		if m.ROM.SHA1 != "" {
+			db.bySHA1[m.ROM.SHA1] = m
+		}
+		db.byCRC[m.ROM.CRC32] = append(db.byCRC[m.ROM.CRC32], m)
+	}
+}
+
+// Identify looks up rom by SHA-1, or by CRC32 and size for the entries without SHA-1.
+// It returns nil if rom is not in the DAT, which means the ROM is hacked, a bad dump or just a homebrew.
+func (db *DB) Identify(rom []uint8) *Match {
+	sum := sha1.Sum(rom)
+	if m, ok := db.bySHA1[hex.EncodeToString(sum[:])]; ok {
+		return &m
+	}
+	crc := crc32.ChecksumIEEE(rom)
+	for _, m := range db.byCRC[crc] {
+		if m.ROM.SHA1 == "" && (m.ROM.Size == 0 || m.ROM.Size == int64(len(rom))) {
+			return &m
+		}
+	}
+	return nil
+}
+
+// No-Intro の命名規則: "タイトル (地域) (言語) (Rev 1) ..."
+func parseName(name string) (region, revision string) {
+	for i, s := range strings.Split(name, "(")[1:] {
+		s, _, _ = strings.Cut(s, ")")
+		switch {
+		case i == 0:
+			region = s
+		case strings.HasPrefix(s, "Rev "):
+			revision = strings.TrimPrefix(s, "Rev ")
+		case len(s) > 1 && s[0] == 'v' && '0' <= s[1] && s[1] <= '9':
+			revision = s
+		}
+	}
+	return region, revision
+}
+
+func parseCRC(s string) (uint32, error) {
+	crc, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("bad crc %q", s)
+	}
+	return uint32(crc), nil
+}
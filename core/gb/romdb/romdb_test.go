@@ -0,0 +1,100 @@
+package romdb
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+var (
+	romA = []uint8("verified rom")
+	romB = []uint8("rom without sha1")
+)
+
+func sha1Hex(data []uint8) string { return fmt.Sprintf("%X", sha1.Sum(data)) }
+
+func testDATs() map[string]string {
+	return map[string]string{
+		"xml": fmt.Sprintf(`<?xml version="1.0"?>
+<datafile>
+	<header><name>Nintendo - Game Boy</name></header>
+	<game name="Tetris (World) (Rev 1)">
+		<description>Tetris (World) (Rev 1)</description>
+		<rom name="Tetris (World) (Rev 1).gb" size="%d" crc="%08X" sha1="%s" status="verified"/>
+	</game>
+	<game name="Demo (Japan) (v1.1)">
+		<rom name="Demo (Japan) (v1.1).gb" size="%d" crc="%08x"/>
+		<rom name="missing.gb" status="nodump"/>
+	</game>
+</datafile>`, len(romA), crc32.ChecksumIEEE(romA), sha1Hex(romA), len(romB), crc32.ChecksumIEEE(romB)),
+
+		"cmp": fmt.Sprintf("\xEF\xBB\xBF"+`clrmamepro (
+	name "Nintendo - Game Boy"
+)
+
+game (
+	name "Tetris (World) (Rev 1)"
+	description "Tetris (World) (Rev 1)"
+	rom ( name "Tetris (World) (Rev 1).gb" size %d crc %08X sha1 %s flags verified )
+)
+
+game (
+	name "Demo (Japan) (v1.1)"
+	rom ( name "Demo (Japan) (v1.1).gb" size %d crc %08x )
+	rom ( name "missing.gb" )
+)
+`, len(romA), crc32.ChecksumIEEE(romA), sha1Hex(romA), len(romB), crc32.ChecksumIEEE(romB)),
+	}
+}
+
+func TestParse(t *testing.T) {
+	for format, dat := range testDATs() {
+		db, err := Parse(strings.NewReader(dat))
+		if err != nil {
+			t.Fatalf("%s: %v", format, err)
+		}
+		if db.Name != "Nintendo - Game Boy" || len(db.Games) != 2 {
+			t.Fatalf("%s: name %q, %d games", format, db.Name, len(db.Games))
+		}
+
+		m := db.Identify(romA)
+		if m == nil {
+			t.Fatalf("%s: verified ROM was not identified", format)
+		}
+		if m.Name != "Tetris (World) (Rev 1)" || m.Region != "World" || m.Revision != "1" || !m.ROM.Verified() {
+			t.Errorf("%s: %+v, ROM %+v", format, m.Game, m.ROM)
+		}
+		if m.ROM.SHA1 != strings.ToLower(sha1Hex(romA)) {
+			t.Errorf("%s: SHA1 %q", format, m.ROM.SHA1)
+		}
+
+		m = db.Identify(romB)
+		if m == nil {
+			t.Fatalf("%s: ROM without SHA-1 was not identified by CRC32", format)
+		}
+		if m.Region != "Japan" || m.Revision != "v1.1" || len(m.Game.ROMs) != 1 {
+			t.Errorf("%s: %+v", format, m.Game)
+		}
+
+		if m := db.Identify(append(romA, 0)); m != nil {
+			t.Errorf("%s: unknown ROM identified as %q", format, m.Name)
+		}
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	for _, dat := range []string{
+		`<datafile><game name="x"><rom crc="zz"/></game>`,
+		`game ( name "x"`,
+		`game ( name "x" ) )`,
+		`game ( rom ( crc 12345678x ) )`,
+		`clrmamepro ( name )`,
+	} {
+		if _, err := Parse(strings.NewReader(dat)); !errors.Is(err, ErrInvalidDAT) {
+			t.Errorf("%q: %v", dat, err)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package romdb
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// Logiqx XML (No-Intro, Redump)
+type xmlDatafile struct {
+	Header struct {
+		Name string `xml:"name"`
+	} `xml:"header"`
+	Games    []xmlGame `xml:"game"`
+	Machines []xmlGame `xml:"machine"` // MAME系のツールが出力したもの
+}
+
+type xmlGame struct {
+	Name        string `xml:"name,attr"`
+	Description string `xml:"description"`
+	ROMs        []struct {
+		Name   string `xml:"name,attr"`
+		Size   int64  `xml:"size,attr"`
+		CRC    string `xml:"crc,attr"`
+		SHA1   string `xml:"sha1,attr"`
+		Status string `xml:"status,attr"`
+	} `xml:"rom"`
+}
+
+func parseXML(db *DB, data []uint8) error {
+	var d xmlDatafile
+	if err := xml.Unmarshal(data, &d); err != nil {
+		return err
+	}
+	db.Name = d.Header.Name
+	for _, xg := range append(d.Games, d.Machines...) {
+		g := &Game{Name: xg.Name, Description: xg.Description}
+		for _, r := range xg.ROMs {
+			if r.CRC == "" {
+				continue // nodump
+			}
+			crc, err := parseCRC(r.CRC)
+			if err != nil {
+				return err
+			}
+			g.ROMs = append(g.ROMs, ROM{
+				Name:   r.Name,
+				Size:   r.Size,
+				CRC32:  crc,
+				SHA1:   strings.ToLower(r.SHA1),
+				Status: r.Status,
+			})
+		}
+		db.add(g)
+	}
+	return nil
+}
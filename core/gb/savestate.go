@@ -0,0 +1,353 @@
+package gb
+
+import (
+	"bufio"
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/akatsuki105/dawngb/core/gb/cpu"
+)
+
+/*
+セーブステートの形式 (リトルエンディアン)
+
+	stateHeader
+	chunk...     // Flags に stateCompressed が立っていれば、ここから後ろは flate で圧縮されている
+	"END " chunk
+
+各 chunk は chunkHeader の後に Size バイトのデータが続く。
+コンポーネントの構造体を変更したら、そのチャンクのバージョンを上げて migrations に古いバージョンからの変換を追加すること。
+*/
+
+// StateVersion is the version of the save state container format.
+// Version 0 is the legacy format which wrote Snapshot as a single struct.
+const StateVersion = 1
+
+const stateCompressed = 1 << 0
+
+var (
+	ErrInvalidState = errors.New("invalid save state")
+	ErrStateVersion = errors.New("save state was created by a newer version")
+	ErrStateROM     = errors.New("save state is for another ROM")
+	ErrStateModel   = errors.New("save state is for another model")
+
+	errNoCartridge = errors.New("no cartridge loaded")
+	errTruncated   = fmt.Errorf("%w: truncated", ErrInvalidState)
+)
+
+var stateMagic = [4]uint8{'D', 'A', 'W', 'N'}
+
+// チャンクのタグ
+var (
+	chunkCPU  = [4]uint8{'C', 'P', 'U', ' '}
+	chunkPPU  = [4]uint8{'P', 'P', 'U', ' '}
+	chunkAPU  = [4]uint8{'A', 'P', 'U', ' '}
+	chunkCart = [4]uint8{'C', 'A', 'R', 'T'}
+	chunkWRAM = [4]uint8{'W', 'R', 'A', 'M'}
+	chunkSRAM = [4]uint8{'S', 'R', 'A', 'M'} // 省略可能
+	chunkIR   = [4]uint8{'I', 'R', ' ', ' '} // 省略可能 (RP)
+	chunkSGB  = [4]uint8{'S', 'G', 'B', ' '} // MODEL_SGB のみ
+	chunkEnd  = [4]uint8{'E', 'N', 'D', ' '}
+
+	requiredChunks = [][4]uint8{chunkCPU, chunkPPU, chunkAPU, chunkCart, chunkWRAM}
+)
+
+// 各チャンクの現在のバージョン
+var chunkVersions = map[[4]uint8]uint16{
+	chunkCPU:  1, // 1: Stopped を追加
+	chunkPPU:  0,
+	chunkAPU:  0,
+	chunkCart: 0,
+	chunkWRAM: 0,
+	chunkSRAM: 0,
+	chunkIR:   0,
+	chunkSGB:  0,
+}
+
+// migrations[tag][v] はバージョン v のデータを v+1 に変換する
+var migrations = map[[4]uint8][]func(data []uint8) ([]uint8, error){
+	chunkCPU: {
+		func(data []uint8) ([]uint8, error) { return append(data, 0), nil }, // Stopped(bool) が末尾に追加された
+	},
+}
+
+type stateHeader struct {
+	Magic       [4]uint8 // "DAWN"
+	Version     uint64
+	Flags       uint32
+	Model       uint8
+	ROMChecksum uint32 // ROMファイルのCRC32
+}
+
+type chunkHeader struct {
+	Tag     [4]uint8
+	Version uint16
+	Size    uint32
+}
+
+type chunk struct {
+	version uint16
+	data    []uint8
+}
+
+// SaveState writes the current state to w. If compress is true, the chunks are compressed with flate.
+func (g *GB) SaveState(w io.Writer, compress bool) error {
+	if g.Cart == nil {
+		return errNoCartridge
+	}
+	if err := g.UpdateSnapshot(&g.Snap); err != nil {
+		return err
+	}
+
+	h := stateHeader{Magic: stateMagic, Version: StateVersion, Model: uint8(g.Model), ROMChecksum: g.Cart.CRC32}
+	if compress {
+		h.Flags |= stateCompressed
+	}
+	if err := binary.Write(w, binary.LittleEndian, h); err != nil {
+		return err
+	}
+
+	body := w
+	var fw *flate.Writer
+	if compress {
+		fw, _ = flate.NewWriter(w, flate.DefaultCompression)
+		body = fw
+	}
+
+	wram := struct {
+		Data [len(g.Snap.WRAM)]uint8
+		Bank uint8
+	}{g.Snap.WRAM, g.Snap.WRAMBank}
+	type stateChunk struct {
+		tag  [4]uint8
+		data any
+	}
+	chunks := []stateChunk{
+		{chunkCPU, g.Snap.CPU},
+		{chunkPPU, g.Snap.PPU},
+		{chunkAPU, g.Snap.APU},
+		{chunkCart, g.Snap.Cart},
+		{chunkWRAM, wram},
+		{chunkSRAM, g.Cart.SRAM()},
+		{chunkIR, g.IR.RP},
+	}
+	if g.SGB != nil {
+		chunks = append(chunks, stateChunk{chunkSGB, &g.SGB.sgbState})
+	}
+	chunks = append(chunks, stateChunk{chunkEnd, []uint8{}})
+	for _, c := range chunks {
+		if err := writeChunk(body, c.tag, c.data); err != nil {
+			return err
+		}
+	}
+
+	if fw != nil {
+		return fw.Close()
+	}
+	return nil
+}
+
+func writeChunk(w io.Writer, tag [4]uint8, data any) error {
+	h := chunkHeader{Tag: tag, Version: chunkVersions[tag], Size: uint32(binary.Size(data))}
+	if err := binary.Write(w, binary.LittleEndian, h); err != nil {
+		return err
+	}
+	return binary.Write(w, binary.LittleEndian, data)
+}
+
+// LoadState restores the state written by SaveState, or by the legacy Serialize of older versions.
+// The state is validated and migrated before any component is modified, so the emulator is left untouched on error.
+func (g *GB) LoadState(r io.Reader) error {
+	if g.Cart == nil {
+		return errNoCartridge
+	}
+
+	br := bufio.NewReader(r)
+	prefix, err := br.Peek(12)
+	if err != nil {
+		return errTruncated
+	}
+	if [4]uint8(prefix[:4]) != stateMagic {
+		return fmt.Errorf("%w: bad magic", ErrInvalidState)
+	}
+
+	var chunks map[[4]uint8]chunk
+	switch version := binary.LittleEndian.Uint64(prefix[4:]); {
+	case version == 0:
+		chunks, err = g.readLegacyState(br)
+	case version <= StateVersion:
+		chunks, err = g.readChunkedState(br)
+	default:
+		return fmt.Errorf("%w: format version %d", ErrStateVersion, version)
+	}
+	if err != nil {
+		return err
+	}
+
+	snap := NewSnapshot(0)
+	snap.Model = uint8(g.Model) // 一致していることは確認済み
+	if err := decodeChunks(chunks, snap); err != nil {
+		return err
+	}
+	if err := g.RestoreSnapshot(snap); err != nil {
+		return err
+	}
+	if c, ok := chunks[chunkSRAM]; ok {
+		g.Cart.LoadSRAM(c.data)
+	}
+	g.IR.reset()
+	if c, ok := chunks[chunkIR]; ok {
+		g.IR.RP = c.data[0] & 0xC1
+	}
+	g.IR.cartLED = g.Cart.IRLED()
+	if g.SGB != nil {
+		g.SGB.Joypad = cpu.JoypadSGB{Bits: -1, Players: 1}
+		g.SGB.reset()
+		if c, ok := chunks[chunkSGB]; ok {
+			binary.Read(bytes.NewReader(c.data), binary.LittleEndian, &g.SGB.sgbState) // サイズは確認済み
+		}
+	}
+	return nil
+}
+
+func (g *GB) readChunkedState(r io.Reader) (map[[4]uint8]chunk, error) {
+	var h stateHeader
+	if err := binary.Read(r, binary.LittleEndian, &h); err != nil {
+		return nil, errTruncated
+	}
+	if Model(h.Model) != g.Model {
+		return nil, fmt.Errorf("%w: saved on model %d, running model %d", ErrStateModel, h.Model, g.Model)
+	}
+	if h.ROMChecksum != g.Cart.CRC32 {
+		return nil, fmt.Errorf("%w: CRC32 %08X, loaded ROM %08X", ErrStateROM, h.ROMChecksum, g.Cart.CRC32)
+	}
+
+	body := r
+	if h.Flags&stateCompressed != 0 {
+		fr := flate.NewReader(r)
+		defer fr.Close()
+		body = fr
+	}
+
+	chunks := map[[4]uint8]chunk{}
+	for {
+		var ch chunkHeader
+		if err := binary.Read(body, binary.LittleEndian, &ch); err != nil {
+			return nil, errTruncated
+		}
+		if ch.Tag == chunkEnd {
+			return chunks, nil
+		}
+		if ch.Size > 16*1024*1024 {
+			return nil, fmt.Errorf("%w: chunk %q is too large", ErrInvalidState, ch.Tag[:])
+		}
+
+		data := make([]uint8, ch.Size)
+		if _, err := io.ReadFull(body, data); err != nil {
+			return nil, errTruncated
+		}
+		if _, ok := chunkVersions[ch.Tag]; !ok {
+			continue // 知らないチャンクは無視する
+		}
+		chunks[ch.Tag] = chunk{ch.Version, data}
+	}
+}
+
+// バージョン0: Snapshot をそのまま binary.Write していた頃の形式
+// 当時のコンポーネントの構造体のサイズで切り出して、バージョン0のチャンクとして扱う
+const (
+	legacyCPUSize  = 289
+	legacyPPUSize  = 16831
+	legacyAPUSize  = 399
+	legacyCartSize = 552
+	legacyWRAMSize = 4 * KB * 8
+)
+
+func (g *GB) readLegacyState(r io.Reader) (map[[4]uint8]chunk, error) {
+	data := make([]uint8, 76+1+legacyCPUSize+legacyPPUSize+legacyAPUSize+legacyCartSize+legacyWRAMSize+1+2*KB)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errTruncated
+	}
+
+	data = data[76:] // Header
+	if Model(data[0]) != g.Model {
+		return nil, fmt.Errorf("%w: saved on model %d, running model %d", ErrStateModel, data[0], g.Model)
+	}
+	data = data[1:]
+
+	chunks := map[[4]uint8]chunk{}
+	for _, c := range []struct {
+		tag  [4]uint8
+		size int
+	}{
+		{chunkCPU, legacyCPUSize},
+		{chunkPPU, legacyPPUSize},
+		{chunkAPU, legacyAPUSize},
+		{chunkCart, legacyCartSize},
+		{chunkWRAM, legacyWRAMSize + 1}, // WRAM, WRAMBank
+	} {
+		chunks[c.tag] = chunk{0, data[:c.size]}
+		data = data[c.size:]
+	}
+	return chunks, nil
+}
+
+// チャンクを最新のバージョンに変換して snap に読み込む
+func decodeChunks(chunks map[[4]uint8]chunk, snap *Snapshot) error {
+	for tag, c := range chunks {
+		current := chunkVersions[tag]
+		if c.version > current {
+			return fmt.Errorf("%w: chunk %q version %d", ErrStateVersion, tag[:], c.version)
+		}
+		for v := c.version; v < current; v++ {
+			data, err := migrations[tag][v](c.data)
+			if err != nil {
+				return fmt.Errorf("migrate chunk %q from version %d: %w", tag[:], v, err)
+			}
+			c.data = data
+		}
+		chunks[tag] = chunk{current, c.data}
+	}
+
+	for _, tag := range requiredChunks {
+		if _, ok := chunks[tag]; !ok {
+			return fmt.Errorf("%w: missing chunk %q", ErrInvalidState, tag[:])
+		}
+	}
+
+	if c, ok := chunks[chunkIR]; ok && len(c.data) != 1 {
+		return fmt.Errorf("%w: chunk %q has size %d", ErrInvalidState, chunkIR[:], len(c.data))
+	}
+	if c, ok := chunks[chunkSGB]; ok && len(c.data) != binary.Size(&sgbState{}) {
+		return fmt.Errorf("%w: chunk %q has size %d", ErrInvalidState, chunkSGB[:], len(c.data))
+	}
+
+	var wram struct {
+		Data [len(snap.WRAM)]uint8
+		Bank uint8
+	}
+	for _, c := range []struct {
+		tag [4]uint8
+		dst any
+	}{
+		{chunkCPU, &snap.CPU},
+		{chunkPPU, &snap.PPU},
+		{chunkAPU, &snap.APU},
+		{chunkCart, &snap.Cart},
+		{chunkWRAM, &wram},
+	} {
+		data := chunks[c.tag].data
+		if binary.Size(c.dst) != len(data) {
+			return fmt.Errorf("%w: chunk %q has size %d", ErrInvalidState, c.tag[:], len(data))
+		}
+		if err := binary.Read(bytes.NewReader(data), binary.LittleEndian, c.dst); err != nil {
+			return err
+		}
+	}
+	snap.WRAM, snap.WRAMBank = wram.Data, wram.Bank
+	return nil
+}
@@ -0,0 +1,149 @@
+package gb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// 0x0150 で INC A を繰り返すだけのROM
+func testROM(title string) []uint8 {
+	rom := make([]uint8, 32*KB)
+	copy(rom[0x100:], []uint8{0x00, 0xC3, 0x50, 0x01})
+	copy(rom[0x134:], title)
+	copy(rom[0x150:], []uint8{0x3C, 0x18, 0xFD})
+	sum := uint8(0)
+	for _, b := range rom[0x134:0x14D] {
+		sum = sum - b - 1
+	}
+	rom[0x14D] = sum
+	return rom
+}
+
+func newTestGB(t *testing.T, model Model, title string) *GB {
+	t.Helper()
+	g := New(model, nil)
+	if err := g.LoadROM(testROM(title)); err != nil {
+		t.Fatal(err)
+	}
+	return g
+}
+
+func TestStateRoundTrip(t *testing.T) {
+	for _, compress := range []bool{false, true} {
+		g := newTestGB(t, MODEL_CGB, "STATE")
+		g.RunFrame()
+		g.WRAM.Data[0x1234] = 0x56
+		var buf bytes.Buffer
+		if err := g.SaveState(&buf, compress); err != nil {
+			t.Fatal(err)
+		}
+		want := g.CPU.R
+
+		g.RunFrame()
+		g.WRAM.Data[0x1234] = 0
+		if err := g.LoadState(bytes.NewReader(buf.Bytes())); err != nil {
+			t.Fatalf("compress %v: %v", compress, err)
+		}
+		if g.CPU.R != want || g.WRAM.Data[0x1234] != 0x56 {
+			t.Errorf("compress %v: registers %+v, want %+v, WRAM 0x%02X", compress, g.CPU.R, want, g.WRAM.Data[0x1234])
+		}
+	}
+}
+
+// バージョン0 の形式 (Snapshot をそのまま書いていた) を作る
+func legacyState(t *testing.T, g *GB) []uint8 {
+	t.Helper()
+	if err := g.UpdateSnapshot(&g.Snap); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, Header{Magic: stateMagic})
+	buf.WriteByte(uint8(g.Model))
+	for _, c := range []struct {
+		name         string
+		data         any
+		size, legacy int // 今のサイズ, バージョン0 のサイズ
+	}{
+		{"CPU", g.Snap.CPU, legacyCPUSize + 1, legacyCPUSize}, // バージョン1 で Stopped が追加された
+		{"PPU", g.Snap.PPU, legacyPPUSize, legacyPPUSize},
+		{"APU", g.Snap.APU, legacyAPUSize, legacyAPUSize},
+		{"Cart", g.Snap.Cart, legacyCartSize, legacyCartSize},
+		{"WRAM", g.Snap.WRAM, legacyWRAMSize, legacyWRAMSize},
+	} {
+		if n := binary.Size(c.data); n != c.size {
+			t.Fatalf("%s snapshot is %d bytes, want %d; add a chunk version and a migration", c.name, n, c.size)
+		}
+		var b bytes.Buffer
+		binary.Write(&b, binary.LittleEndian, c.data)
+		buf.Write(b.Bytes()[:c.legacy])
+	}
+	buf.WriteByte(g.Snap.WRAMBank)
+	buf.Write(make([]uint8, 2*KB))
+	return buf.Bytes()
+}
+
+func TestLoadLegacyState(t *testing.T) {
+	g := newTestGB(t, MODEL_CGB, "LEGACY")
+	g.RunFrame()
+	g.WRAM.Data[0x7FFF] = 0x99
+	g.WRAM.Bank = 3
+	want := g.CPU.R
+	data := legacyState(t, g)
+
+	g2 := newTestGB(t, MODEL_CGB, "LEGACY")
+	if err := g2.LoadState(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if g2.CPU.R != want {
+		t.Errorf("registers %+v, want %+v", g2.CPU.R, want)
+	}
+	if g2.WRAM.Data[0x7FFF] != 0x99 || g2.WRAM.Bank != 3 {
+		t.Errorf("WRAM 0x%02X, bank %d", g2.WRAM.Data[0x7FFF], g2.WRAM.Bank)
+	}
+
+	g3 := newTestGB(t, MODEL_DMG, "LEGACY")
+	if err := g3.LoadState(bytes.NewReader(data)); !errors.Is(err, ErrStateModel) {
+		t.Errorf("other model: %v", err)
+	}
+	if err := g2.LoadState(bytes.NewReader(data[:len(data)-1])); !errors.Is(err, ErrInvalidState) {
+		t.Errorf("truncated: %v", err)
+	}
+}
+
+func TestLoadStateErrors(t *testing.T) {
+	g := newTestGB(t, MODEL_DMG, "STATE")
+	var buf bytes.Buffer
+	if err := g.SaveState(&buf, false); err != nil {
+		t.Fatal(err)
+	}
+	state := buf.Bytes()
+
+	badMagic := bytes.Clone(state)
+	badMagic[0] = 'X'
+	newer := bytes.Clone(state)
+	binary.LittleEndian.PutUint64(newer[4:], StateVersion+1)
+	cpuVersion := bytes.Clone(state)
+	binary.LittleEndian.PutUint16(cpuVersion[binary.Size(stateHeader{})+4:], chunkVersions[chunkCPU]+1)
+
+	for _, tt := range []struct {
+		name string
+		g    *GB
+		data []uint8
+		err  error
+	}{
+		{"bad magic", g, badMagic, ErrInvalidState},
+		{"newer format", g, newer, ErrStateVersion},
+		{"newer chunk", g, cpuVersion, ErrStateVersion},
+		{"truncated", g, state[:len(state)-8], ErrInvalidState},
+		{"empty", g, nil, ErrInvalidState},
+		{"other ROM", newTestGB(t, MODEL_DMG, "OTHER"), state, ErrStateROM},
+		{"other model", newTestGB(t, MODEL_CGB, "STATE"), state, ErrStateModel},
+	} {
+		if err := tt.g.LoadState(bytes.NewReader(tt.data)); !errors.Is(err, tt.err) {
+			t.Errorf("%s: %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
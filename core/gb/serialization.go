@@ -1,7 +1,6 @@
 package gb
 
 import (
-	"encoding/binary"
 	"errors"
 	"io"
 
@@ -81,26 +80,18 @@ func (g *GB) RestoreSnapshot(snap *Snapshot) error {
 	return nil
 }
 
+// Serialize writes an uncompressed save state to w. See SaveState for the error.
 func (g *GB) Serialize(w io.Writer) bool {
 	if w != nil {
-		err := g.UpdateSnapshot(&g.Snap)
-		if err != nil {
-			return false
-		}
-		binary.Write(w, binary.LittleEndian, g.Snap)
-		return true
+		return g.SaveState(w, false) == nil
 	}
 	return false
 }
 
+// Deserialize restores a save state from r. See LoadState for the error.
 func (g *GB) Deserialize(r io.Reader) bool {
 	if r != nil {
-		binary.Read(r, binary.LittleEndian, &g.Snap)
-		err := g.RestoreSnapshot(&g.Snap)
-		if err != nil {
-			return false
-		}
-		return true
+		return g.LoadState(r) == nil
 	}
 	return false
 }
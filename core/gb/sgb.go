@@ -0,0 +1,381 @@
+package gb
+
+import (
+	"encoding/binary"
+	"image/color"
+
+	"github.com/akatsuki105/dawngb/core/gb/cpu"
+	"github.com/akatsuki105/dawngb/core/gb/ppu"
+)
+
+// SGBのコマンド (パケットの先頭バイトの上位5ビット)
+const (
+	sgbPAL01    = 0x00
+	sgbPAL23    = 0x01
+	sgbPAL03    = 0x02
+	sgbPAL12    = 0x03
+	sgbATTR_BLK = 0x04
+	sgbATTR_LIN = 0x05
+	sgbATTR_DIV = 0x06
+	sgbATTR_CHR = 0x07
+	sgbPAL_SET  = 0x0A
+	sgbPAL_TRN  = 0x0B
+	sgbMLT_REQ  = 0x11
+	sgbCHR_TRN  = 0x13
+	sgbPCT_TRN  = 0x14
+	sgbATTR_TRN = 0x15
+	sgbATTR_SET = 0x16
+	sgbMASK_EN  = 0x17
+)
+
+// MASK_EN
+const (
+	sgbMaskNone   = 0
+	sgbMaskFreeze = 1 // 今の画面を表示し続ける
+	sgbMaskBlack  = 2
+	sgbMaskColor0 = 3
+)
+
+const (
+	sgbWidth, sgbHeight = 256, 224
+	sgbScreenX          = (sgbWidth - 160) / 2 // 枠の中のGBの画面の位置
+	sgbScreenY          = (sgbHeight - 144) / 2
+)
+
+// 電源を入れたときのパレット (DMGと同じ白黒)
+var sgbDefaultPalette = [4]uint16{0x7FFF, 0x56B5, 0x294A, 0x0000}
+
+// SGB is the Super Game Boy part of MODEL_SGB. It receives command packets through JOYP and colours the screen.
+//
+// Commands are only accepted from cartridges which declare SGB support in the header, as the real BIOS does.
+type SGB struct {
+	Border bool // 枠を表示する (Resolution は 256x224 になる)
+
+	g *GB
+	sgbState
+	screen [sgbWidth * sgbHeight]color.NRGBA
+}
+
+// セーブステートにそのまま書き込む
+type sgbState struct {
+	Joypad cpu.JoypadSGB
+
+	Command [7 * 16]uint8 // 受信中のコマンド (最大7パケット)
+	Packets uint8         // Command に受信したパケット数
+
+	Palettes       [4][4]uint16   // 色0 は全パレットで共通
+	SysPalettes    [512][4]uint16 // PAL_TRN で送られたもの (PAL_SET で選ぶ)
+	Attr           [20 * 18]uint8 // 8x8ピクセルごとのパレット
+	AttrFiles      [45][90]uint8  // ATTR_TRN で送られたもの (1バイトに4マス, 上位ビットから)
+	Mask           uint8
+	Frozen         [160 * 144]uint16 // MASK_EN で固定した画面
+	Tiles          [256 * 32]uint8   // 枠のタイル (SNESの4bpp)
+	Map            [32 * 28]uint16   // 枠のタイルマップ
+	BorderPalettes [4][16]uint16     // 枠のパレット (SNESのパレット4..7)
+
+	Transfer    uint8 // フレームの終わりにVRAMから読み込むコマンド (0 なら無し)
+	TransferArg uint8
+}
+
+func newSGB(g *GB) *SGB {
+	s := &SGB{Border: true, g: g}
+	g.CPU.Joypad.SGB = &s.Joypad
+	g.CPU.Joypad.OnPacket = s.receive
+	s.reset()
+	return s
+}
+
+// Joypad の状態は CPU.Reset で初期化される
+func (s *SGB) reset() {
+	s.sgbState = sgbState{Joypad: s.Joypad}
+	for i := range s.Palettes {
+		s.Palettes[i] = sgbDefaultPalette
+	}
+}
+
+func (s *SGB) receive(packet [16]uint8) {
+	if s.g.Cart == nil || !s.g.Cart.Header.SupportsSGB() {
+		return
+	}
+	if s.Packets == 0 && packet[0]&0x07 == 0 {
+		return // パケット数が0のコマンドは無い
+	}
+	copy(s.Command[int(s.Packets)*16:], packet[:])
+	s.Packets++
+	if n := s.Command[0] & 0x07; s.Packets >= n {
+		s.Packets = 0
+		s.execute(s.Command[:int(n)*16])
+	}
+}
+
+func (s *SGB) execute(data []uint8) {
+	switch cmd := data[0] >> 3; cmd {
+	case sgbPAL01:
+		s.setPalettes(0, 1, data)
+	case sgbPAL23:
+		s.setPalettes(2, 3, data)
+	case sgbPAL03:
+		s.setPalettes(0, 3, data)
+	case sgbPAL12:
+		s.setPalettes(1, 2, data)
+	case sgbATTR_BLK:
+		s.attrBlock(data)
+	case sgbATTR_LIN:
+		for _, b := range data[2:min(2+int(data[1]), len(data))] {
+			line, pal := int(b&0x1F), (b>>5)&0x03
+			for i := range 20 * 18 {
+				if (b&0x80 != 0 && i/20 == line) || (b&0x80 == 0 && i%20 == line) { // bit7: 横の線
+					s.Attr[i] = pal
+				}
+			}
+		}
+	case sgbATTR_DIV:
+		s.attrDivide(data)
+	case sgbATTR_CHR:
+		s.attrChr(data)
+	case sgbPAL_SET:
+		for i := range s.Palettes {
+			s.Palettes[i] = s.SysPalettes[binary.LittleEndian.Uint16(data[1+i*2:])&0x1FF]
+			s.Palettes[i][0] = s.Palettes[0][0]
+		}
+		if data[9]&0x80 != 0 {
+			s.applyAttrFile(data[9] & 0x3F)
+		}
+		if data[9]&0x40 != 0 {
+			s.Mask = sgbMaskNone
+		}
+	case sgbPAL_TRN, sgbCHR_TRN, sgbPCT_TRN, sgbATTR_TRN:
+		s.Transfer, s.TransferArg = cmd, data[1]
+	case sgbMLT_REQ:
+		s.Joypad.Players = [4]uint8{1, 2, 1, 4}[data[1]&0x03]
+		s.Joypad.Player = 0
+	case sgbATTR_SET:
+		s.applyAttrFile(data[1] & 0x3F)
+		if data[1]&0x40 != 0 {
+			s.Mask = sgbMaskNone
+		}
+	case sgbMASK_EN:
+		if data[1]&0x03 == sgbMaskFreeze && s.Mask != sgbMaskFreeze {
+			screen := s.g.PPU.Screen()
+			for i := range s.Frozen {
+				s.Frozen[i] = s.colorAt(screen, i%160, i/160)
+			}
+		}
+		s.Mask = data[1] & 0x03
+	}
+}
+
+// 色0 と、2つのパレットの色1..3
+func (s *SGB) setPalettes(a, b int, data []uint8) {
+	c0 := binary.LittleEndian.Uint16(data[1:])
+	for i := range s.Palettes {
+		s.Palettes[i][0] = c0
+	}
+	for i := range 3 {
+		s.Palettes[a][1+i] = binary.LittleEndian.Uint16(data[3+i*2:])
+		s.Palettes[b][1+i] = binary.LittleEndian.Uint16(data[9+i*2:])
+	}
+}
+
+// 6バイトずつのデータセット: 制御(bit0: 内側, bit1: 境界, bit2: 外側), パレット(内側, 境界, 外側の順に2ビットずつ), X1, Y1, X2, Y2
+func (s *SGB) attrBlock(data []uint8) {
+	for n := 0; n < int(data[1]) && 2+n*6+6 <= len(data); n++ {
+		d := data[2+n*6:]
+		ctrl, in, border, out := d[0]&0x07, d[1]&0x03, (d[1]>>2)&0x03, (d[1]>>4)&0x03
+		x1, y1, x2, y2 := int(d[2]&0x1F), int(d[3]&0x1F), int(d[4]&0x1F), int(d[5]&0x1F)
+		switch ctrl { // 内側か外側だけを指定すると、境界もそのパレットになる
+		case 0x01:
+			ctrl, border = 0x03, in
+		case 0x04:
+			ctrl, border = 0x06, out
+		}
+		for i := range 20 * 18 {
+			x, y := i%20, i/20
+			switch {
+			case x > x1 && x < x2 && y > y1 && y < y2:
+				if ctrl&0x01 != 0 {
+					s.Attr[i] = in
+				}
+			case x >= x1 && x <= x2 && y >= y1 && y <= y2:
+				if ctrl&0x02 != 0 {
+					s.Attr[i] = border
+				}
+			default:
+				if ctrl&0x04 != 0 {
+					s.Attr[i] = out
+				}
+			}
+		}
+	}
+}
+
+// 1本の線で画面を2つに分ける bit6 が立っていれば上下、そうでなければ左右
+func (s *SGB) attrDivide(data []uint8) {
+	after, before, on := data[1]&0x03, (data[1]>>2)&0x03, (data[1]>>4)&0x03
+	line := int(data[2] & 0x1F)
+	for i := range 20 * 18 {
+		pos := i % 20
+		if data[1]&0x40 != 0 {
+			pos = i / 20
+		}
+		switch {
+		case pos < line:
+			s.Attr[i] = before
+		case pos == line:
+			s.Attr[i] = on
+		default:
+			s.Attr[i] = after
+		}
+	}
+}
+
+// (X, Y) から1マス2ビットずつ順に指定する
+func (s *SGB) attrChr(data []uint8) {
+	x, y := int(data[1]&0x1F), int(data[2]&0x1F)
+	n := min(int(binary.LittleEndian.Uint16(data[3:])), 20*18, (len(data)-6)*4)
+	vertical := data[5] != 0
+	for i := 0; i < n && x < 20 && y < 18; i++ {
+		s.Attr[y*20+x] = (data[6+i/4] >> (6 - 2*(i%4))) & 0x03
+		if vertical {
+			if y++; y == 18 {
+				x, y = x+1, 0
+			}
+		} else {
+			if x++; x == 20 {
+				x, y = 0, y+1
+			}
+		}
+	}
+}
+
+func (s *SGB) applyAttrFile(n uint8) {
+	if int(n) >= len(s.AttrFiles) {
+		return
+	}
+	for i := range s.Attr {
+		s.Attr[i] = (s.AttrFiles[n][i/4] >> (6 - 2*(i%4))) & 0x03
+	}
+}
+
+// フレームの終わりに呼ばれる 実機では *_TRN の次のフレームで表示されている画面を読み込む
+func (s *SGB) endFrame() {
+	if s.Transfer == 0 {
+		return
+	}
+	data := s.vram()
+	switch s.Transfer {
+	case sgbPAL_TRN:
+		for i := range s.SysPalettes {
+			for j := range 4 {
+				s.SysPalettes[i][j] = binary.LittleEndian.Uint16(data[(i*4+j)*2:])
+			}
+		}
+	case sgbCHR_TRN:
+		copy(s.Tiles[int(s.TransferArg&0x01)*len(data):], data)
+	case sgbPCT_TRN:
+		for i := range s.Map {
+			s.Map[i] = binary.LittleEndian.Uint16(data[i*2:])
+		}
+		for p := range s.BorderPalettes {
+			for c := range 16 {
+				s.BorderPalettes[p][c] = binary.LittleEndian.Uint16(data[0x800+(p*16+c)*2:])
+			}
+		}
+	case sgbATTR_TRN:
+		for i := range s.AttrFiles {
+			copy(s.AttrFiles[i][:], data[i*90:])
+		}
+	}
+	s.Transfer = 0
+}
+
+// 画面に表示されている BG のタイル(左上から20x13枚)の 4KB
+func (s *SGB) vram() []uint8 {
+	p := s.g.PPU
+	tilemap := 0x1800
+	if p.LCDC&(1<<3) != 0 {
+		tilemap = 0x1C00
+	}
+	data := make([]uint8, 0, 20*13*16)
+	for y := range 13 {
+		for x := range 20 {
+			id := p.RAM.Data[tilemap+y*32+x]
+			addr := 0x1000 + int(int8(id))*16
+			if p.LCDC&(1<<4) != 0 {
+				addr = int(id) * 16
+			}
+			data = append(data, p.RAM.Data[addr:addr+16]...)
+		}
+	}
+	return data[:4*KB]
+}
+
+func (s *SGB) colorAt(screen []color.NRGBA, x, y int) uint16 {
+	shade := ppu.DMGShade(screen[y*160+x])
+	return s.Palettes[s.Attr[(y/8)*20+x/8]][shade]
+}
+
+// GBの画面を色付けして、枠と合成する
+func (s *SGB) render(screen []color.NRGBA) []color.NRGBA {
+	w, h, ox, oy := 160, 144, 0, 0
+	if s.Border {
+		w, h, ox, oy = sgbWidth, sgbHeight, sgbScreenX, sgbScreenY
+		backdrop := rgb555ToNRGBA(s.Palettes[0][0])
+		for i := range s.screen {
+			s.screen[i] = backdrop
+		}
+	}
+
+	for y := range 144 {
+		for x := range 160 {
+			var c uint16
+			switch s.Mask {
+			case sgbMaskNone:
+				c = s.colorAt(screen, x, y)
+			case sgbMaskFreeze:
+				c = s.Frozen[y*160+x]
+			case sgbMaskBlack:
+				c = 0x0000
+			case sgbMaskColor0:
+				c = s.Palettes[0][0]
+			}
+			s.screen[(oy+y)*w+ox+x] = rgb555ToNRGBA(c)
+		}
+	}
+
+	if s.Border {
+		s.drawBorder()
+	}
+	return s.screen[:w*h]
+}
+
+// 枠はGBの画面より手前に表示される(色0 は透明)
+//
+//	Map bit0-7: タイル番号, bit10-12: パレット(4..7), bit14: 左右反転, bit15: 上下反転
+func (s *SGB) drawBorder() {
+	for i, e := range s.Map {
+		tile := s.Tiles[int(e&0xFF)*32:]
+		pal := &s.BorderPalettes[(e>>10)&0x03]
+		for row := range 8 {
+			r := row
+			if e&(1<<15) != 0 {
+				r = 7 - row
+			}
+			for col := range 8 {
+				bit := 7 - col
+				if e&(1<<14) != 0 {
+					bit = col
+				}
+				c := (tile[r*2]>>bit)&1 | ((tile[r*2+1]>>bit)&1)<<1 | ((tile[16+r*2]>>bit)&1)<<2 | ((tile[16+r*2+1]>>bit)&1)<<3
+				if c != 0 {
+					s.screen[((i/32)*8+row)*sgbWidth+(i%32)*8+col] = rgb555ToNRGBA(pal[c])
+				}
+			}
+		}
+	}
+}
+
+func rgb555ToNRGBA(c uint16) color.NRGBA {
+	r5, g5, b5 := uint8(c&0x1F), uint8((c>>5)&0x1F), uint8((c>>10)&0x1F)
+	return color.NRGBA{(r5 << 3) | (r5 >> 2), (g5 << 3) | (g5 >> 2), (b5 << 3) | (b5 >> 2), 0xFF}
+}
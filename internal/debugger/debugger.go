@@ -6,3 +6,19 @@ type Debugger interface {
 	PrintLog(message string)
 	InstructionHook(id int, pc uint64) // breakpointのチェックはここで行う
 }
+
+// CPUState is the reason why the CPU executes no instruction.
+type CPUState uint8
+
+const (
+	CPURunning CPUState = iota
+	CPUHalted           // HALT で割り込みを待っている
+	CPUStopped          // STOP モード
+	CPULocked           // 不正なオペコードで止まっている
+)
+
+// IdleHooker is optionally implemented by a Debugger.
+// IdleHook is called instead of InstructionHook on every step in which the CPU executes no instruction, so that the debugger can stop a halted, stopped or locked up CPU.
+type IdleHooker interface {
+	IdleHook(pc uint64, state CPUState)
+}
@@ -0,0 +1,304 @@
+package debugger
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+/*
+条件式の文法 (C言語に近い優先順位)
+
+	expr    = binary
+	binary  = unary (op unary)*      op: || && == != < <= > >= | ^ & << >> + - * / %
+	unary   = ("!" | "~" | "-") unary | primary
+	primary = number | ident | "[" expr "]" | "(" expr ")"
+
+number は `$3F` `0x3F`(16進数) または `100`(10進数)
+ident はレジスタ名(A, F, B, C, D, E, H, L, AF, BC, DE, HL, SP, PC), BANK(ROMバンク), VALUE(ウォッチポイントで読み書きされた値), IOレジスタ名(rLYなど), シンボル名
+[addr] は addr の1バイトを読む
+*/
+
+type env struct {
+	machine Machine
+	value   int64 // VALUE
+}
+
+type expr func(e *env) int64
+
+type binaryOp struct {
+	op   string
+	prec int
+	fn   func(a, b int64) int64
+}
+
+var binaryOps = []binaryOp{
+	// 2文字の演算子を先に判定する
+	{"||", 1, func(a, b int64) int64 { return btoi(a != 0 || b != 0) }},
+	{"&&", 2, func(a, b int64) int64 { return btoi(a != 0 && b != 0) }},
+	{"==", 6, func(a, b int64) int64 { return btoi(a == b) }},
+	{"!=", 6, func(a, b int64) int64 { return btoi(a != b) }},
+	{"<=", 7, func(a, b int64) int64 { return btoi(a <= b) }},
+	{">=", 7, func(a, b int64) int64 { return btoi(a >= b) }},
+	{"<<", 8, func(a, b int64) int64 { return a << uint64(b&63) }},
+	{">>", 8, func(a, b int64) int64 { return a >> uint64(b&63) }},
+	{"<", 7, func(a, b int64) int64 { return btoi(a < b) }},
+	{">", 7, func(a, b int64) int64 { return btoi(a > b) }},
+	{"|", 3, func(a, b int64) int64 { return a | b }},
+	{"^", 4, func(a, b int64) int64 { return a ^ b }},
+	{"&", 5, func(a, b int64) int64 { return a & b }},
+	{"+", 9, func(a, b int64) int64 { return a + b }},
+	{"-", 9, func(a, b int64) int64 { return a - b }},
+	{"*", 10, func(a, b int64) int64 { return a * b }},
+	{"/", 10, func(a, b int64) int64 {
+		if b == 0 {
+			return 0
+		}
+		return a / b
+	}},
+	{"%", 10, func(a, b int64) int64 {
+		if b == 0 {
+			return 0
+		}
+		return a % b
+	}},
+}
+
+type parser struct {
+	src     string
+	pos     int
+	symbols *Symbols
+}
+
+func compile(src string, symbols *Symbols) (expr, error) {
+	p := &parser{src: src, symbols: symbols}
+	e, err := p.binary(1)
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.pos < len(p.src) {
+		return nil, p.errorf("unexpected %q", p.src[p.pos:])
+	}
+	return e, nil
+}
+
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("%s: %s", p.src, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) skipSpace() {
+	for p.pos < len(p.src) && p.src[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *parser) consume(s string) bool {
+	p.skipSpace()
+	if strings.HasPrefix(p.src[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+func (p *parser) binary(minPrec int) (expr, error) {
+	lhs, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		p.skipSpace()
+		i := slices.IndexFunc(binaryOps, func(op binaryOp) bool { return strings.HasPrefix(p.src[p.pos:], op.op) })
+		if i < 0 || binaryOps[i].prec < minPrec {
+			return lhs, nil
+		}
+
+		op := binaryOps[i]
+		p.pos += len(op.op)
+		rhs, err := p.binary(op.prec + 1)
+		if err != nil {
+			return nil, err
+		}
+		l := lhs
+		lhs = func(e *env) int64 { return op.fn(l(e), rhs(e)) }
+	}
+}
+
+func (p *parser) unary() (expr, error) {
+	switch {
+	case p.consume("!"):
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) int64 { return btoi(x(e) == 0) }, nil
+	case p.consume("~"):
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) int64 { return ^x(e) }, nil
+	case p.consume("-"):
+		x, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		return func(e *env) int64 { return -x(e) }, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (expr, error) {
+	switch {
+	case p.consume("("):
+		x, err := p.binary(1)
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume(")") {
+			return nil, p.errorf("missing ')'")
+		}
+		return x, nil
+
+	case p.consume("["):
+		addr, err := p.binary(1)
+		if err != nil {
+			return nil, err
+		}
+		if !p.consume("]") {
+			return nil, p.errorf("missing ']'")
+		}
+		return func(e *env) int64 { return int64(e.machine.ViewMemory(0, uint32(uint16(addr(e))), 1)) }, nil
+	}
+
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) && isIdentChar(p.src[p.pos]) {
+		p.pos++
+	}
+	token := p.src[start:p.pos]
+	if token == "" {
+		if p.pos < len(p.src) {
+			return nil, p.errorf("unexpected %q", p.src[p.pos:])
+		}
+		return nil, p.errorf("unexpected end of expression")
+	}
+
+	if val, ok := parseNumber(token); ok {
+		return func(*env) int64 { return val }, nil
+	}
+	if x, ok := register(token); ok {
+		return x, nil
+	}
+	if addr, ok := ioRegisters[token]; ok {
+		return func(*env) int64 { return int64(addr) }, nil
+	}
+	if sym, ok := p.symbols.Lookup(token); ok {
+		return func(*env) int64 { return int64(sym.Addr) }, nil
+	}
+	return nil, p.errorf("unknown identifier %q", token)
+}
+
+func isIdentChar(c uint8) bool {
+	return c == '_' || c == '.' || c == '$' || c == '@' || c == '#' || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
+
+// $3F, 0x3F, 100
+func parseNumber(s string) (int64, bool) {
+	base := 10
+	switch {
+	case strings.HasPrefix(s, "$"):
+		s, base = s[1:], 16
+	case strings.HasPrefix(s, "0x"), strings.HasPrefix(s, "0X"):
+		s, base = s[2:], 16
+	}
+	val, err := strconv.ParseInt(s, base, 64)
+	if err != nil {
+		return 0, false
+	}
+	return val, true
+}
+
+func register(name string) (expr, bool) {
+	reg := func(i uint64) func(e *env) int64 {
+		return func(e *env) int64 { return int64(e.machine.GetValue(i)) }
+	}
+	// GetValue(0) は A が下位8bit, F が上位8bit
+	switch strings.ToUpper(name) {
+	case "A":
+		return func(e *env) int64 { return int64(e.machine.GetValue(0) & 0xFF) }, true
+	case "F":
+		return func(e *env) int64 { return int64(e.machine.GetValue(0) >> 8) }, true
+	case "AF":
+		return func(e *env) int64 {
+			af := e.machine.GetValue(0)
+			return int64((af&0xFF)<<8 | af>>8)
+		}, true
+	case "B":
+		return func(e *env) int64 { return int64(e.machine.GetValue(1) >> 8) }, true
+	case "C":
+		return func(e *env) int64 { return int64(e.machine.GetValue(1) & 0xFF) }, true
+	case "D":
+		return func(e *env) int64 { return int64(e.machine.GetValue(2) >> 8) }, true
+	case "E":
+		return func(e *env) int64 { return int64(e.machine.GetValue(2) & 0xFF) }, true
+	case "H":
+		return func(e *env) int64 { return int64(e.machine.GetValue(3) >> 8) }, true
+	case "L":
+		return func(e *env) int64 { return int64(e.machine.GetValue(3) & 0xFF) }, true
+	case "BC":
+		return reg(1), true
+	case "DE":
+		return reg(2), true
+	case "HL":
+		return reg(3), true
+	case "SP":
+		return reg(4), true
+	case "PC":
+		return reg(5), true
+	case "BANK":
+		return reg(romBank), true
+	case "VALUE":
+		return func(e *env) int64 { return e.value }, true
+	}
+	return nil, false
+}
+
+func btoi(b bool) int64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// IORegister is a named IO register. Names follow hardware.inc.
+type IORegister struct {
+	Name string
+	Addr uint16
+}
+
+// IORegisters lists the IO registers in address order.
+var IORegisters = []IORegister{
+	{"rP1", 0xFF00}, {"rSB", 0xFF01}, {"rSC", 0xFF02}, {"rDIV", 0xFF04}, {"rTIMA", 0xFF05}, {"rTMA", 0xFF06}, {"rTAC", 0xFF07}, {"rIF", 0xFF0F},
+	{"rNR10", 0xFF10}, {"rNR11", 0xFF11}, {"rNR12", 0xFF12}, {"rNR13", 0xFF13}, {"rNR14", 0xFF14},
+	{"rNR21", 0xFF16}, {"rNR22", 0xFF17}, {"rNR23", 0xFF18}, {"rNR24", 0xFF19},
+	{"rNR30", 0xFF1A}, {"rNR31", 0xFF1B}, {"rNR32", 0xFF1C}, {"rNR33", 0xFF1D}, {"rNR34", 0xFF1E},
+	{"rNR41", 0xFF20}, {"rNR42", 0xFF21}, {"rNR43", 0xFF22}, {"rNR44", 0xFF23},
+	{"rNR50", 0xFF24}, {"rNR51", 0xFF25}, {"rNR52", 0xFF26},
+	{"rLCDC", 0xFF40}, {"rSTAT", 0xFF41}, {"rSCY", 0xFF42}, {"rSCX", 0xFF43}, {"rLY", 0xFF44}, {"rLYC", 0xFF45}, {"rDMA", 0xFF46},
+	{"rBGP", 0xFF47}, {"rOBP0", 0xFF48}, {"rOBP1", 0xFF49}, {"rWY", 0xFF4A}, {"rWX", 0xFF4B},
+	{"rKEY1", 0xFF4D}, {"rVBK", 0xFF4F}, {"rHDMA1", 0xFF51}, {"rHDMA2", 0xFF52}, {"rHDMA3", 0xFF53}, {"rHDMA4", 0xFF54}, {"rHDMA5", 0xFF55},
+	{"rRP", 0xFF56}, {"rBCPS", 0xFF68}, {"rBCPD", 0xFF69}, {"rOCPS", 0xFF6A}, {"rOCPD", 0xFF6B}, {"rSVBK", 0xFF70}, {"rIE", 0xFFFF},
+}
+
+var ioRegisters = func() map[string]uint16 {
+	m := make(map[string]uint16, len(IORegisters))
+	for _, r := range IORegisters {
+		m[r.Name] = r.Addr
+	}
+	return m
+}()
@@ -0,0 +1,483 @@
+package debugger
+
+import (
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Machine is the emulator state the breakpoint manager inspects. *gb.GB satisfies it.
+type Machine interface {
+	GetValue(which uint64) uint64
+	ViewMemory(memID int, addr uint32, width int) uint64
+}
+
+// GetValue の引数
+const (
+	regPC   = 5
+	romBank = 2 << 56
+)
+
+type Kind uint8
+
+const (
+	Exec   Kind = iota // 命令の実行
+	Read               // メモリの読み込み
+	Write              // メモリの書き込み
+	Access             // 読み込み または 書き込み
+)
+
+func (k Kind) String() string {
+	return [...]string{"exec", "read", "write", "access"}[k]
+}
+
+// Breakpoint is an execution breakpoint or a watchpoint.
+type Breakpoint struct {
+	ID         int
+	Kind       Kind
+	Bank       int    // ROMバンク (0x4000..7FFF の実行ブレークポイントのみ有効, -1 ならどのバンクでも止まる)
+	Start, End uint16 // [Start, End]
+	Condition  string // 空なら常に成立
+	Log        string // 空でなければ停止せずにログを出力する (tracepoint)
+	After      int    // 条件が成立した回数がこれを超えてから止まる
+	HitCount   int    // 条件が成立した回数
+	Enabled    bool
+
+	cond expr
+	log  []logPart
+}
+
+func (bp *Breakpoint) String() string {
+	loc := fmt.Sprintf("%04X", bp.Start)
+	if bp.Bank >= 0 {
+		loc = fmt.Sprintf("%02X:%04X", bp.Bank, bp.Start)
+	}
+	if bp.End != bp.Start {
+		loc += fmt.Sprintf("-%04X", bp.End)
+	}
+
+	s := fmt.Sprintf("#%d %s %s hits=%d", bp.ID, bp.Kind, loc, bp.HitCount)
+	if bp.Condition != "" {
+		s += fmt.Sprintf(" if %s", bp.Condition)
+	}
+	if bp.After > 0 {
+		s += fmt.Sprintf(" after %d", bp.After)
+	}
+	if bp.Log != "" {
+		s += fmt.Sprintf(" log %q", bp.Log)
+	}
+	if !bp.Enabled {
+		s += " (disabled)"
+	}
+	return s
+}
+
+// Options are the optional settings of a breakpoint.
+type Options struct {
+	// Condition is an expression such as `A == $3F && [wLY] > 100`. The breakpoint is ignored while it evaluates to 0.
+	Condition string
+
+	// Log turns the breakpoint into a tracepoint which prints the message instead of stopping.
+	// `{expr}` in the message is replaced with the value of expr, e.g. "hp={[wHP]} a={A}".
+	Log string
+
+	// After is the number of hits to ignore before stopping.
+	After int
+}
+
+type Reason uint8
+
+const (
+	HitBreakpoint Reason = iota
+	HitWatchpoint
+	HitPaused  // Pause
+	HitStepped // Step
+)
+
+// Hit describes why the emulation stopped.
+type Hit struct {
+	Reason     Reason
+	Breakpoint *Breakpoint // HitBreakpoint, HitWatchpoint のみ
+	PC         uint16
+	Addr       uint16   // HitWatchpoint のみ
+	Value      uint8    // HitWatchpoint のみ, 読み書きされた値
+	Write      bool     // HitWatchpoint のみ
+	CPU        CPUState // 命令を実行せずに止まったときのCPUの状態 (IdleHook のみ)
+}
+
+// フックから参照するブレークポイントの一覧 (変更するたびに作り直す)
+type table struct {
+	exec        map[uint16][]*Breakpoint
+	watch       []*Breakpoint
+	read, write bool
+}
+
+// Manager is a breakpoint engine implementing Debugger.
+//
+// Attach it to the emulator with GB.AttachDebugger. When a breakpoint or watchpoint is hit, OnBreak is called inside InstructionHook before the instruction is executed.
+// OnBreak may block to keep the emulation stopped, or return and let the frontend leave the frame loop (in that case call Resume before continuing).
+type Manager struct {
+	OnBreak func(hit Hit)
+	OnLog   func(message string) // tracepoint や PrintLog の出力先 (nilなら捨てる)
+
+	m       Machine
+	symbols *Symbols
+
+	mu          sync.Mutex
+	breakpoints []*Breakpoint
+	nextID      int
+	table       atomic.Pointer[table]
+
+	pause, step atomic.Bool
+	pending     *Hit // ウォッチポイントは命令の途中で引っかかるので、次の命令の前で止まる
+	skip        int  // 次の命令でこのPCの実行ブレークポイントを無視する
+}
+
+func NewManager(m Machine) *Manager {
+	d := &Manager{m: m, symbols: NewSymbols(), nextID: 1, skip: -1}
+	d.table.Store(&table{exec: map[uint16][]*Breakpoint{}})
+	return d
+}
+
+// LoadSymbols loads an RGBDS .sym file. Symbols can be used in locations and expressions.
+func (d *Manager) LoadSymbols(r io.Reader) error {
+	return d.symbols.Load(r)
+}
+
+// Add adds a breakpoint at location.
+// location is an address ("4A10", "$4A10", "0x4A10"), a bank-qualified address ("03:4A10"), a symbol or an inclusive range of them ("C000-C0FF").
+func (d *Manager) Add(kind Kind, location string, opts Options) (*Breakpoint, error) {
+	bank, start, end, err := d.parseLocation(location)
+	if err != nil {
+		return nil, err
+	}
+	if end < start {
+		return nil, fmt.Errorf("invalid range: %s", location)
+	}
+
+	bp := &Breakpoint{
+		Kind: kind, Bank: bank, Start: start, End: end,
+		Condition: opts.Condition, Log: opts.Log, After: opts.After,
+		Enabled: true,
+	}
+	if opts.Condition != "" {
+		bp.cond, err = compile(opts.Condition, d.symbols)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if opts.Log != "" {
+		bp.log, err = parseLog(opts.Log, d.symbols)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	bp.ID = d.nextID
+	d.nextID++
+	d.breakpoints = append(d.breakpoints, bp)
+	d.rebuild()
+	return bp, nil
+}
+
+func (d *Manager) Remove(id int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	i := slices.IndexFunc(d.breakpoints, func(bp *Breakpoint) bool { return bp.ID == id })
+	if i < 0 {
+		return false
+	}
+	d.breakpoints = slices.Delete(d.breakpoints, i, i+1)
+	d.rebuild()
+	return true
+}
+
+func (d *Manager) Enable(id int, enabled bool) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, bp := range d.breakpoints {
+		if bp.ID == id {
+			bp.Enabled = enabled
+			d.rebuild()
+			return true
+		}
+	}
+	return false
+}
+
+// Ignore makes the breakpoint ignore its next n hits.
+func (d *Manager) Ignore(id, n int) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, bp := range d.breakpoints {
+		if bp.ID == id {
+			bp.After = bp.HitCount + n
+			return true
+		}
+	}
+	return false
+}
+
+// Breakpoints returns copies of all breakpoints ordered by ID.
+func (d *Manager) Breakpoints() []Breakpoint {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	result := make([]Breakpoint, len(d.breakpoints))
+	for i, bp := range d.breakpoints {
+		result[i] = *bp
+	}
+	return result
+}
+
+// Eval evaluates an expression against the current state.
+func (d *Manager) Eval(src string) (int64, error) {
+	e, err := compile(src, d.symbols)
+	if err != nil {
+		return 0, err
+	}
+	return e(&env{machine: d.m}), nil
+}
+
+// Pause stops the emulation before the next instruction, or on the next step while the CPU is halted, stopped or locked up.
+// It is safe to call from any goroutine.
+func (d *Manager) Pause() { d.pause.Store(true) }
+
+// CancelPause drops a Pause which has not stopped the emulation yet.
+func (d *Manager) CancelPause() { d.pause.Store(false) }
+
+// Step stops the emulation again after the next instruction is executed.
+func (d *Manager) Step() { d.step.Store(true) }
+
+// Resume makes the manager ignore the execution breakpoint at the current PC once,
+// so that a frontend which left the frame loop on a break doesn't stop at the same place again.
+func (d *Manager) Resume() {
+	d.skip = int(uint16(d.m.GetValue(regPC)))
+}
+
+// 呼び出し側で mu をロックすること
+func (d *Manager) rebuild() {
+	t := &table{exec: map[uint16][]*Breakpoint{}}
+	for _, bp := range d.breakpoints {
+		if !bp.Enabled {
+			continue
+		}
+		switch bp.Kind {
+		case Exec:
+			for addr := uint32(bp.Start); addr <= uint32(bp.End); addr++ {
+				t.exec[uint16(addr)] = append(t.exec[uint16(addr)], bp)
+			}
+		case Read:
+			t.watch, t.read = append(t.watch, bp), true
+		case Write:
+			t.watch, t.write = append(t.watch, bp), true
+		case Access:
+			t.watch, t.read, t.write = append(t.watch, bp), true, true
+		}
+	}
+	d.table.Store(t)
+}
+
+func (d *Manager) parseLocation(location string) (bank int, start, end uint16, err error) {
+	first, last, isRange := strings.Cut(strings.TrimSpace(location), "-")
+	bank, start, err = d.parseAddr(strings.TrimSpace(first))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	end = start
+	if isRange {
+		_, end, err = d.parseAddr(strings.TrimSpace(last))
+		if err != nil {
+			return 0, 0, 0, err
+		}
+	}
+	return bank, start, end, nil
+}
+
+func (d *Manager) parseAddr(s string) (int, uint16, error) {
+	if sym, ok := d.symbols.Lookup(s); ok {
+		if sym.Addr >= 0x4000 && sym.Addr < 0x8000 {
+			return int(sym.Bank), sym.Addr, nil
+		}
+		return -1, sym.Addr, nil
+	}
+	return parseBankAddr(s)
+}
+
+// ReadMemoryHook implements Debugger.
+func (d *Manager) ReadMemoryHook(_ uint32, addr uint64, width int) {
+	if !d.table.Load().read {
+		return
+	}
+	// フックは実際に読む前に呼ばれるので、読まれる値は副作用なしで覗ける
+	d.watch(Read, uint16(addr), width, uint8(d.m.ViewMemory(0, uint32(addr), 1)))
+}
+
+// WriteMemoryHook implements Debugger.
+func (d *Manager) WriteMemoryHook(_ uint32, addr uint64, width int, data uint64) {
+	if !d.table.Load().write {
+		return
+	}
+	d.watch(Write, uint16(addr), width, uint8(data))
+}
+
+// PrintLog implements Debugger.
+func (d *Manager) PrintLog(message string) {
+	if d.OnLog != nil {
+		d.OnLog(message)
+	}
+}
+
+// InstructionHook implements Debugger.
+func (d *Manager) InstructionHook(_ int, pc uint64) {
+	skip := d.skip
+	d.skip = -1
+
+	hit := d.pending
+	d.pending = nil
+	paused, stepped := d.pause.Swap(false), d.step.Swap(false)
+	switch {
+	case hit != nil:
+	case paused:
+		hit = &Hit{Reason: HitPaused}
+	case stepped:
+		hit = &Hit{Reason: HitStepped}
+	case int(pc) != skip:
+		for _, bp := range d.table.Load().exec[uint16(pc)] {
+			if d.matchBank(bp, uint16(pc)) && d.check(bp, 0) {
+				hit = &Hit{Reason: HitBreakpoint, Breakpoint: bp}
+				break
+			}
+		}
+	}
+
+	if hit != nil && d.OnBreak != nil {
+		hit.PC = uint16(pc)
+		d.OnBreak(*hit)
+	}
+}
+
+// IdleHook implements IdleHooker. Only Pause, Step and pending watchpoints are serviced, as breakpoints are never hit without executing an instruction.
+func (d *Manager) IdleHook(pc uint64, state CPUState) {
+	hit := d.pending
+	d.pending = nil
+	paused, stepped := d.pause.Swap(false), d.step.Swap(false)
+	switch {
+	case hit != nil:
+	case paused:
+		hit = &Hit{Reason: HitPaused}
+	case stepped:
+		hit = &Hit{Reason: HitStepped}
+	default:
+		return
+	}
+
+	if d.OnBreak != nil {
+		hit.PC, hit.CPU = uint16(pc), state
+		d.OnBreak(*hit)
+	}
+}
+
+func (d *Manager) watch(kind Kind, addr uint16, width int, value uint8) {
+	if d.pending != nil {
+		return
+	}
+	for _, bp := range d.table.Load().watch {
+		if bp.Kind != kind && bp.Kind != Access {
+			continue
+		}
+		if uint32(addr)+uint32(width) > uint32(bp.Start) && addr <= bp.End && d.check(bp, int64(value)) {
+			d.pending = &Hit{Reason: HitWatchpoint, Breakpoint: bp, Addr: addr, Value: value, Write: kind == Write}
+			return
+		}
+	}
+}
+
+func (d *Manager) matchBank(bp *Breakpoint, pc uint16) bool {
+	switch {
+	case bp.Bank < 0 || pc >= 0x8000:
+		return true
+	case pc < 0x4000:
+		return bp.Bank == 0
+	}
+	return uint64(bp.Bank) == d.m.GetValue(romBank)
+}
+
+// 条件とヒット数を判定して、止まるべきなら true を返す
+func (d *Manager) check(bp *Breakpoint, value int64) bool {
+	e := &env{machine: d.m, value: value}
+	if bp.cond != nil && bp.cond(e) == 0 {
+		return false
+	}
+
+	d.mu.Lock()
+	bp.HitCount++
+	hits := bp.HitCount
+	d.mu.Unlock()
+	if hits <= bp.After {
+		return false
+	}
+
+	if bp.log != nil {
+		if d.OnLog != nil {
+			d.OnLog(formatLog(bp.log, e))
+		}
+		return false
+	}
+	return true
+}
+
+// ログのメッセージは文字列と {expr} の並び
+type logPart struct {
+	text string
+	expr expr
+}
+
+func parseLog(src string, symbols *Symbols) ([]logPart, error) {
+	parts := []logPart{}
+	for src != "" {
+		before, after, ok := strings.Cut(src, "{")
+		if before != "" {
+			parts = append(parts, logPart{text: before})
+		}
+		if !ok {
+			break
+		}
+
+		inner, rest, ok := strings.Cut(after, "}")
+		if !ok {
+			return nil, fmt.Errorf("missing '}' in log: %s", src)
+		}
+		e, err := compile(inner, symbols)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, logPart{expr: e})
+		src = rest
+	}
+	return parts, nil
+}
+
+func formatLog(parts []logPart, e *env) string {
+	sb := strings.Builder{}
+	for _, p := range parts {
+		if p.expr == nil {
+			sb.WriteString(p.text)
+			continue
+		}
+		val := p.expr(e)
+		switch {
+		case val >= 0 && val <= 0xFF:
+			fmt.Fprintf(&sb, "$%02X", val)
+		case val >= 0 && val <= 0xFFFF:
+			fmt.Fprintf(&sb, "$%04X", val)
+		default:
+			fmt.Fprintf(&sb, "%d", val)
+		}
+	}
+	return sb.String()
+}
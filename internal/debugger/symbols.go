@@ -0,0 +1,77 @@
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type Symbol struct {
+	Name string
+	Bank uint16
+	Addr uint16
+}
+
+// Symbols is a symbol table loaded from RGBDS .sym files.
+type Symbols struct {
+	byName map[string]Symbol
+}
+
+func NewSymbols() *Symbols {
+	return &Symbols{byName: map[string]Symbol{}}
+}
+
+// Load reads a .sym file.
+//
+//	; comment
+//	00:0150 Main
+//	03:4a10 Engine.update
+func (s *Symbols) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text, _, _ := strings.Cut(scanner.Text(), ";")
+		fields := strings.Fields(text)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return fmt.Errorf("invalid symbol at line %d: %s", line, scanner.Text())
+		}
+
+		bank, addr, err := parseBankAddr(fields[0])
+		if err != nil {
+			return fmt.Errorf("invalid symbol at line %d: %w", line, err)
+		}
+		s.byName[fields[1]] = Symbol{Name: fields[1], Bank: uint16(max(bank, 0)), Addr: addr}
+	}
+	return scanner.Err()
+}
+
+func (s *Symbols) Lookup(name string) (Symbol, bool) {
+	if s == nil {
+		return Symbol{}, false
+	}
+	sym, ok := s.byName[name]
+	return sym, ok
+}
+
+// "03:4A10" や "4A10" をパースする (bankが指定されていない場合は -1)
+func parseBankAddr(s string) (bank int, addr uint16, err error) {
+	bank = -1
+	if b, a, ok := strings.Cut(s, ":"); ok {
+		val, err := strconv.ParseUint(strings.TrimPrefix(b, "$"), 16, 16)
+		if err != nil {
+			return 0, 0, fmt.Errorf("invalid bank: %s", s)
+		}
+		bank, s = int(val), a
+	}
+
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(s), "$"), "0x")
+	val, err := strconv.ParseUint(s, 16, 16)
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid address: %s", s)
+	}
+	return bank, uint16(val), nil
+}
@@ -1,5 +1,10 @@
 package config
 
+import (
+	"encoding/json"
+	"os"
+)
+
 type GB struct {
 	Model uint8 // 0: DMG, 1: SGB, 2: CGB
 	Intro bool
@@ -15,11 +20,40 @@ type Logger struct {
 	Level  string
 }
 
+// Game is the settings for a game. It is keyed by the game name in the No-Intro DAT.
+type Game struct {
+	Model *uint8 // nil なら GB.Model を使う
+}
+
 type Config struct {
 	ShowFPS bool
 	Audio   Audio
 	Logger  Logger
 	GB      GB
+	Games   map[string]Game // キーは No-Intro のゲーム名 (e.g. "Tetris (World) (Rev 1)")
+}
+
+// LoadGames reads the per-game settings from a JSON file.
+//
+//	{"Tetris (World) (Rev 1)": {"Model": 0}}
+func LoadGames(path string) (map[string]Game, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	games := map[string]Game{}
+	if err := json.Unmarshal(data, &games); err != nil {
+		return nil, err
+	}
+	return games, nil
+}
+
+// Model returns the model to run the game with. name is the game name in the DAT, or "" if the ROM is not identified.
+func (c *Config) Model(name string) uint8 {
+	if g, ok := c.Games[name]; ok && name != "" && g.Model != nil {
+		return *g.Model
+	}
+	return c.GB.Model
 }
 
 var DefaultConfig = Config{
@@ -0,0 +1,346 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/akatsuki105/dawngb/internal/debugger"
+)
+
+type command struct {
+	names []string
+	usage string
+	help  string
+	run   func(d *dbg, args []string) error
+}
+
+var commands []command
+
+func init() {
+	commands = []command{
+		{[]string{"step", "s"}, "[N]", "Execute N instructions.", (*dbg).step},
+		{[]string{"next", "n"}, "", "Execute one instruction, stepping over CALL and RST.", (*dbg).next},
+		{[]string{"continue", "c"}, "", "Run until a breakpoint is hit or Ctrl-C is pressed.", (*dbg).cont},
+		{[]string{"frame", "f"}, "[N|+N]", "Run until frame N. Without N, show the current frame.", (*dbg).frame},
+		{[]string{"break", "b"}, "LOC [if EXPR]", "Stop when the instruction at LOC is executed.", breakCmd(debugger.Exec)},
+		{[]string{"watch", "w"}, "LOC [if EXPR]", "Stop when LOC is written. VALUE in EXPR is the written value.", breakCmd(debugger.Write)},
+		{[]string{"rwatch"}, "LOC [if EXPR]", "Stop when LOC is read. VALUE in EXPR is the read value.", breakCmd(debugger.Read)},
+		{[]string{"awatch"}, "LOC [if EXPR]", "Stop when LOC is read or written.", breakCmd(debugger.Access)},
+		{[]string{"tracepoint", "tp"}, "LOC MESSAGE", "Print MESSAGE when the instruction at LOC is executed. {EXPR} in MESSAGE is replaced with its value.", (*dbg).tracepoint},
+		{[]string{"ignore"}, "ID N", "Ignore the next N hits of the breakpoint.", (*dbg).ignore},
+		{[]string{"breakpoints", "bl"}, "", "List breakpoints.", (*dbg).listBreakpoints},
+		{[]string{"delete", "d"}, "ID", "Delete the breakpoint.", (*dbg).deleteBreakpoint},
+		{[]string{"enable"}, "ID", "Enable the breakpoint.", enableCmd(true)},
+		{[]string{"disable"}, "ID", "Disable the breakpoint.", enableCmd(false)},
+		{[]string{"registers", "r"}, "", "Show CPU registers.", (*dbg).registers},
+		{[]string{"set"}, "REG VALUE", "Set a CPU register. (A, F, B, C, D, E, H, L, AF, BC, DE, HL, SP, PC)", (*dbg).set},
+		{[]string{"print", "p"}, "EXPR", "Evaluate an expression.", (*dbg).print},
+		{[]string{"x"}, "ADDR [LEN] | REGION OFFSET [LEN]", "Hexdump memory. REGION is rom, vram, wram, oam, hram or palette.", (*dbg).hexdump},
+		{[]string{"io"}, "", "Dump IO registers.", (*dbg).io},
+		{[]string{"disassemble", "dis"}, "[ADDR] [N]", "Disassemble N instructions from ADDR.", (*dbg).disassemble},
+		{[]string{"png"}, "PATH", "Save the current frame as PNG.", (*dbg).png},
+		{[]string{"symbols", "sym"}, "PATH", "Load an RGBDS .sym file.", (*dbg).symbols},
+		{[]string{"help", "h"}, "", "Show this help.", (*dbg).help},
+		{[]string{"quit", "q"}, "", "Quit.", nil},
+	}
+}
+
+var errUsage = errors.New("invalid arguments")
+
+// quit なら true を返す
+func (d *dbg) exec(line string) (bool, error) {
+	args := strings.Fields(line)
+	for _, cmd := range commands {
+		for _, name := range cmd.names {
+			if name != args[0] {
+				continue
+			}
+			if cmd.run == nil {
+				return true, nil
+			}
+			err := cmd.run(d, args[1:])
+			if errors.Is(err, errUsage) {
+				err = fmt.Errorf("usage: %s %s", cmd.names[0], cmd.usage)
+			}
+			return false, err
+		}
+	}
+	return false, fmt.Errorf("unknown command: %s (try help)", args[0])
+}
+
+func (d *dbg) help(args []string) error {
+	for _, cmd := range commands {
+		fmt.Fprintf(d.out, "  %-28s %s\n", strings.Join(cmd.names, ", ")+" "+cmd.usage, cmd.help)
+	}
+	fmt.Fprintln(d.out, "\nLOC is an address (4A10, $4A10, 0x4A10), a bank-qualified address (03:4A10), a symbol or a range (C000-C0FF).")
+	fmt.Fprintln(d.out, "ADDR, LEN and VALUE are hex numbers (C000) or expressions ($C000, HL + 2).")
+	fmt.Fprintln(d.out, "EXPR uses registers, [addr] memory reads, IO registers (rLY) and symbols, e.g. A == $3F && [rLY] > 100.")
+	return nil
+}
+
+func (d *dbg) step(args []string) error {
+	n, err := optionalInt(args, 1)
+	if err != nil {
+		return err
+	}
+	for range n {
+		if !d.stepInstruction() {
+			break
+		}
+	}
+	d.report()
+	return nil
+}
+
+// 1命令実行する (halt中は割り込みが来るまで待つ), 中断されたら false を返す
+func (d *dbg) stepInstruction() bool {
+	d.hit = nil
+	d.m.Resume()
+	start := d.g.CPU.Cycles
+	for {
+		d.g.Step()
+		if d.g.Broken() {
+			return false
+		}
+		if !d.g.CPU.Halted || d.g.CPU.Cycles-start >= frameCycles {
+			return true
+		}
+	}
+}
+
+func (d *dbg) next(args []string) error {
+	r := &d.g.CPU.R
+	pc, sp := r.PC, r.SP
+	text, length := d.g.Disassemble(pc)
+	if !strings.HasPrefix(text, "call") && !strings.HasPrefix(text, "rst") {
+		return d.step(nil)
+	}
+
+	// 呼び出し先から戻ってくるまで実行する
+	ret := pc + uint16(length)
+	for d.stepInstruction() {
+		if r.PC == ret && r.SP >= sp {
+			break
+		}
+	}
+	d.report()
+	return nil
+}
+
+func (d *dbg) cont(args []string) error {
+	d.run(func() bool { return false })
+	return nil
+}
+
+func (d *dbg) frame(args []string) error {
+	if len(args) == 0 {
+		fmt.Fprintf(d.out, "frame %d\n", d.g.PPU.Frame)
+		return nil
+	}
+
+	target := d.g.PPU.Frame
+	n, err := strconv.ParseUint(strings.TrimPrefix(args[0], "+"), 10, 64)
+	if err != nil {
+		return errUsage
+	}
+	if strings.HasPrefix(args[0], "+") {
+		target += n
+	} else {
+		target = n
+	}
+
+	d.run(func() bool { return d.g.PPU.Frame >= target })
+	return nil
+}
+
+// done が true を返すか、ブレークポイントや Ctrl-C で止まるまでフレーム単位で実行する
+func (d *dbg) run(done func() bool) {
+	d.hit = nil
+	d.interrupted.Store(false)
+	d.m.Resume()
+	for !done() {
+		d.g.RunFrame()
+		if d.g.Broken() {
+			break
+		}
+		if d.interrupted.Load() { // デバッガのフックで止まらなかったときのために、フレームごとにも確認する
+			d.m.CancelPause()
+			fmt.Fprintln(d.out, "interrupted")
+			break
+		}
+	}
+	d.interrupted.Store(false)
+	d.report()
+}
+
+// 停止した理由と現在の命令を表示する
+func (d *dbg) report() {
+	if hit := d.hit; hit != nil && d.g.Broken() {
+		switch hit.Reason {
+		case debugger.HitBreakpoint:
+			fmt.Fprintf(d.out, "breakpoint #%d\n", hit.Breakpoint.ID)
+		case debugger.HitWatchpoint:
+			access := "read"
+			if hit.Write {
+				access = "write"
+			}
+			fmt.Fprintf(d.out, "watchpoint #%d: %s $%02X at %04X\n", hit.Breakpoint.ID, access, hit.Value, hit.Addr)
+		case debugger.HitPaused:
+			fmt.Fprintln(d.out, "paused")
+		}
+	}
+	d.printLocation()
+}
+
+func breakCmd(kind debugger.Kind) func(d *dbg, args []string) error {
+	return func(d *dbg, args []string) error {
+		if len(args) == 0 {
+			return errUsage
+		}
+		opts := debugger.Options{}
+		if len(args) > 1 {
+			if args[1] != "if" || len(args) == 2 {
+				return errUsage
+			}
+			opts.Condition = strings.Join(args[2:], " ")
+		}
+		bp, err := d.m.Add(kind, args[0], opts)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(d.out, bp)
+		return nil
+	}
+}
+
+func (d *dbg) tracepoint(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	bp, err := d.m.Add(debugger.Exec, args[0], debugger.Options{Log: strings.Join(args[1:], " ")})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(d.out, bp)
+	return nil
+}
+
+func (d *dbg) ignore(args []string) error {
+	if len(args) != 2 {
+		return errUsage
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil {
+		return errUsage
+	}
+	n, err := strconv.Atoi(args[1])
+	if err != nil {
+		return errUsage
+	}
+	if !d.m.Ignore(id, n) {
+		return fmt.Errorf("no breakpoint #%d", id)
+	}
+	return nil
+}
+
+func (d *dbg) listBreakpoints(args []string) error {
+	bps := d.m.Breakpoints()
+	if len(bps) == 0 {
+		fmt.Fprintln(d.out, "no breakpoints")
+	}
+	for _, bp := range bps {
+		fmt.Fprintln(d.out, &bp)
+	}
+	return nil
+}
+
+func (d *dbg) deleteBreakpoint(args []string) error {
+	id, err := requiredInt(args)
+	if err != nil {
+		return err
+	}
+	if !d.m.Remove(id) {
+		return fmt.Errorf("no breakpoint #%d", id)
+	}
+	return nil
+}
+
+func enableCmd(enabled bool) func(d *dbg, args []string) error {
+	return func(d *dbg, args []string) error {
+		id, err := requiredInt(args)
+		if err != nil {
+			return err
+		}
+		if !d.m.Enable(id, enabled) {
+			return fmt.Errorf("no breakpoint #%d", id)
+		}
+		return nil
+	}
+}
+
+func (d *dbg) print(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+	val, err := d.m.Eval(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(d.out, "$%X (%d)\n", val, val)
+	return nil
+}
+
+func (d *dbg) symbols(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	return d.loadSymbols(args[0])
+}
+
+// "0150" のような16進数 または 式 (e.g. "HL", "$C000", "wPlayerX + 1")
+// ブレークポイントのアドレスと同じく、数字だけなら16進数として扱う
+func (d *dbg) eval(s string) (uint16, error) {
+	val, err := d.evalInt(s)
+	return uint16(val), err
+}
+
+func (d *dbg) evalInt(s string) (int64, error) {
+	if !isRegister(s) {
+		if val, err := strconv.ParseUint(s, 16, 32); err == nil {
+			return int64(val), nil
+		}
+	}
+	return d.m.Eval(s)
+}
+
+func isRegister(s string) bool {
+	switch strings.ToUpper(s) {
+	case "A", "F", "B", "C", "D", "E", "H", "L", "AF", "BC", "DE", "HL", "SP", "PC":
+		return true
+	}
+	return false
+}
+
+func optionalInt(args []string, def int) (int, error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n <= 0 {
+		return 0, errUsage
+	}
+	return n, nil
+}
+
+func requiredInt(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errUsage
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil {
+		return 0, errUsage
+	}
+	return n, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+	"github.com/akatsuki105/dawngb/internal/debugger"
+)
+
+// ExitCode represents program's status code
+type ExitCode int
+
+// exit code
+const (
+	ExitCodeOK ExitCode = iota
+	ExitCodeError
+)
+
+var (
+	model    = flag.String("model", "cgb", "Hardware model. (dmg, cgb)")
+	biosPath = flag.String("bios", "", "Path to boot ROM. If empty, boot directly.")
+	symPath  = flag.String("sym", "", "Path to RGBDS .sym file. If empty, look for <ROM name>.sym next to the ROM.")
+	script   = flag.String("x", "", "Execute commands from this file before reading stdin.")
+)
+
+func main() {
+	os.Exit(int(run()))
+}
+
+func run() ExitCode {
+	flag.Parse()
+	if flag.NArg() != 1 {
+		fmt.Fprintln(os.Stderr, "usage: dbg [flags] ROM")
+		flag.PrintDefaults()
+		return ExitCodeError
+	}
+
+	d, err := newDebugger(flag.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitCodeError
+	}
+
+	// 実行中の Ctrl-C はエミュレーションを止めるだけ 止まる前にもう一度押されたら終了する
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	go func() {
+		for range sig {
+			if d.interrupted.Swap(true) {
+				fmt.Fprintln(os.Stderr, "interrupted twice, quitting")
+				os.Exit(int(ExitCodeError))
+			}
+			d.m.Pause()
+		}
+	}()
+
+	if *script != "" {
+		f, err := os.Open(*script)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitCodeError
+		}
+		quit := d.repl(f, false)
+		f.Close()
+		if quit {
+			return ExitCodeOK
+		}
+	}
+	d.repl(os.Stdin, true)
+	return ExitCodeOK
+}
+
+type dbg struct {
+	g   *gb.GB
+	m   *debugger.Manager
+	out io.Writer
+	hit *debugger.Hit // 直前に止まった理由
+
+	interrupted atomic.Bool // Ctrl-C が押されて、まだ止まっていない
+}
+
+func newDebugger(romPath string) (*dbg, error) {
+	rom, err := os.ReadFile(romPath)
+	if err != nil {
+		return nil, err
+	}
+
+	m := gb.MODEL_CGB
+	switch strings.ToLower(*model) {
+	case "dmg":
+		m = gb.MODEL_DMG
+	case "cgb":
+	default:
+		return nil, fmt.Errorf("unknown model: %s", *model)
+	}
+
+	g := gb.New(m, nil)
+	if *biosPath != "" {
+		bios, err := os.ReadFile(*biosPath)
+		if err != nil {
+			return nil, err
+		}
+		if err := g.Load(gb.LOAD_BIOS, bios); err != nil {
+			return nil, err
+		}
+	}
+	if err := g.Load(gb.LOAD_ROM, rom); err != nil {
+		return nil, err
+	}
+	g.Reset()
+	if *biosPath == "" {
+		g.DirectBoot()
+	}
+
+	d := &dbg{g: g, m: debugger.NewManager(g), out: os.Stdout}
+	d.m.OnBreak = func(hit debugger.Hit) {
+		d.hit = &hit
+		g.Break()
+	}
+	d.m.OnLog = func(message string) { fmt.Fprintln(d.out, message) }
+	g.AttachDebugger(d.m)
+
+	path := *symPath
+	if path == "" {
+		path = strings.TrimSuffix(romPath, filepath.Ext(romPath)) + ".sym"
+		if _, err := os.Stat(path); err != nil {
+			return d, nil
+		}
+	}
+	if err := d.loadSymbols(path); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func (d *dbg) loadSymbols(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := d.m.LoadSymbols(f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	fmt.Fprintf(d.out, "loaded symbols from %s\n", path)
+	return nil
+}
+
+// quit コマンドが実行されたら true を返す
+func (d *dbg) repl(r io.Reader, interactive bool) bool {
+	scanner := bufio.NewScanner(r)
+	last := ""
+	for {
+		if interactive {
+			fmt.Fprint(d.out, "(dbg) ")
+		}
+		if !scanner.Scan() {
+			return true
+		}
+
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" && interactive {
+			line = last // 空行は直前のコマンドを繰り返す
+		}
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		last = line
+
+		quit, err := d.exec(line)
+		if err != nil {
+			fmt.Fprintln(d.out, "error:", err)
+		}
+		if quit {
+			return true
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"strings"
+
+	"github.com/akatsuki105/dawngb/core/gb/ppu"
+	"github.com/akatsuki105/dawngb/internal/debugger"
+)
+
+const frameCycles = 70224 * ppu.CYCLE
+
+// 現在のPCとその命令
+func (d *dbg) printLocation() {
+	pc := d.g.CPU.R.PC
+	text, _ := d.g.Disassemble(pc)
+	state := ""
+	switch {
+	case d.g.CPU.Stopped:
+		state = " (stopped)"
+	case d.g.CPU.Halted:
+		state = " (halted)"
+	}
+	fmt.Fprintf(d.out, "%s  %s%s\n", d.location(pc), text, state)
+}
+
+// 0x4000..7FFF はROMバンクも表示する
+func (d *dbg) location(addr uint16) string {
+	if addr >= 0x4000 && addr < 0x8000 {
+		return fmt.Sprintf("%02X:%04X", d.g.Cart.ROMBankNumber(), addr)
+	}
+	return fmt.Sprintf("%04X", addr)
+}
+
+func (d *dbg) registers(args []string) error {
+	r := &d.g.CPU.R
+	f := r.F.Pack()
+	flags := []uint8("----")
+	for i, c := range "ZNHC" {
+		if f&(0x80>>i) != 0 {
+			flags[i] = uint8(c)
+		}
+	}
+	ime := 0
+	if d.g.CPU.IME {
+		ime = 1
+	}
+
+	fmt.Fprintf(d.out, "AF=%02X%02X BC=%04X DE=%04X HL=%04X SP=%04X PC=%04X F=%s IME=%d IE=%02X IF=%02X\n",
+		r.A, f, r.BC.Pack(), r.DE.Pack(), r.HL.Pack(), r.SP, r.PC, flags, ime, d.g.CPU.IE, d.g.CPU.IF)
+	fmt.Fprintf(d.out, "LY=%02X frame=%d cycles=%d bank=%02X\n", d.g.ViewMemory(0, 0xFF44, 1), d.g.PPU.Frame, d.g.CPU.Cycles, d.g.Cart.ROMBankNumber())
+	d.printLocation()
+	return nil
+}
+
+func (d *dbg) set(args []string) error {
+	if len(args) < 2 {
+		return errUsage
+	}
+	val, err := d.eval(strings.Join(args[1:], " "))
+	if err != nil {
+		return err
+	}
+
+	r := &d.g.CPU.R
+	switch strings.ToUpper(args[0]) {
+	case "A":
+		r.A = uint8(val)
+	case "F":
+		r.F.Unpack(uint8(val))
+	case "B":
+		r.BC.Hi = uint8(val)
+	case "C":
+		r.BC.Lo = uint8(val)
+	case "D":
+		r.DE.Hi = uint8(val)
+	case "E":
+		r.DE.Lo = uint8(val)
+	case "H":
+		r.HL.Hi = uint8(val)
+	case "L":
+		r.HL.Lo = uint8(val)
+	case "AF":
+		r.A = uint8(val >> 8)
+		r.F.Unpack(uint8(val))
+	case "BC":
+		r.BC.Unpack(val)
+	case "DE":
+		r.DE.Unpack(val)
+	case "HL":
+		r.HL.Unpack(val)
+	case "SP":
+		r.SP = val
+	case "PC":
+		r.PC = val
+	default:
+		return fmt.Errorf("unknown register: %s", args[0])
+	}
+	return d.registers(nil)
+}
+
+// GetChunk で取得できる領域
+var regions = map[string]uint64{
+	"rom":     1 << 56,
+	"vram":    2 << 56,
+	"wram":    3 << 56,
+	"palette": 4<<56 | 0xFF,
+	"oam":     5 << 56,
+	"hram":    6 << 56,
+}
+
+func (d *dbg) hexdump(args []string) error {
+	if len(args) == 0 || len(args) > 3 {
+		return errUsage
+	}
+
+	if chunkID, ok := regions[strings.ToLower(args[0])]; ok {
+		data := d.g.GetChunk(chunkID)
+		if len(args) < 2 {
+			return errUsage
+		}
+		offset, err := d.evalInt(args[1]) // ROM は16bitに収まらない
+		if err != nil {
+			return err
+		}
+		if offset < 0 || int(offset) >= len(data) {
+			return fmt.Errorf("offset out of range: %X (size: %X)", offset, len(data))
+		}
+		length, err := d.length(args[2:])
+		if err != nil {
+			return err
+		}
+		d.dump(uint32(offset), min(length, len(data)-int(offset)), func(i uint32) uint8 { return data[i] })
+		return nil
+	}
+
+	// CPUから見えるアドレス空間
+	if len(args) > 2 {
+		return errUsage
+	}
+	addr, err := d.eval(args[0])
+	if err != nil {
+		return err
+	}
+	length, err := d.length(args[1:])
+	if err != nil {
+		return err
+	}
+	d.dump(uint32(addr), min(length, 0x10000-int(addr)), func(i uint32) uint8 { return uint8(d.g.ViewMemory(0, i, 1)) })
+	return nil
+}
+
+// [LEN] (デフォルトは 0x80)
+func (d *dbg) length(args []string) (int, error) {
+	if len(args) == 0 {
+		return 0x80, nil
+	}
+	val, err := d.evalInt(args[0])
+	if err != nil {
+		return 0, err
+	}
+	if val <= 0 {
+		return 0, errUsage
+	}
+	return int(val), nil
+}
+
+func (d *dbg) dump(addr uint32, length int, read func(i uint32) uint8) {
+	for row := 0; row < length; row += 16 {
+		hex, ascii := strings.Builder{}, strings.Builder{}
+		for i := 0; i < 16; i++ {
+			if row+i >= length {
+				hex.WriteString("   ")
+				continue
+			}
+			b := read(addr + uint32(row+i))
+			fmt.Fprintf(&hex, "%02X ", b)
+			if b >= 0x20 && b < 0x7F {
+				ascii.WriteByte(b)
+			} else {
+				ascii.WriteByte('.')
+			}
+		}
+		fmt.Fprintf(d.out, "%04X  %s %s\n", addr+uint32(row), hex.String(), ascii.String())
+	}
+}
+
+func (d *dbg) io(args []string) error {
+	for i, r := range debugger.IORegisters {
+		fmt.Fprintf(d.out, "%-7s %04X=%02X", r.Name, r.Addr, d.g.ViewMemory(0, uint32(r.Addr), 1))
+		if i%4 == 3 || i == len(debugger.IORegisters)-1 {
+			fmt.Fprintln(d.out)
+		} else {
+			fmt.Fprint(d.out, "    ")
+		}
+	}
+	return nil
+}
+
+func (d *dbg) disassemble(args []string) error {
+	addr := d.g.CPU.R.PC
+	if len(args) > 0 {
+		a, err := d.eval(args[0])
+		if err != nil {
+			return err
+		}
+		addr = a
+	}
+	n, err := optionalInt(args[min(len(args), 1):], 10)
+	if err != nil {
+		return err
+	}
+
+	for range n {
+		text, length := d.g.Disassemble(addr)
+		bytes := ""
+		for i := range length {
+			bytes += fmt.Sprintf("%02X ", d.g.ViewMemory(0, uint32(addr)+uint32(i), 1))
+		}
+		marker := "  "
+		if addr == d.g.CPU.R.PC {
+			marker = "=>"
+		}
+		fmt.Fprintf(d.out, "%s %-7s  %-9s %s\n", marker, d.location(addr), bytes, text)
+		addr += uint16(length)
+	}
+	return nil
+}
+
+func (d *dbg) png(args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+
+	w, h := d.g.Resolution()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	data := d.g.Screen()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, data[y*w+x])
+		}
+	}
+
+	f, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := png.Encode(f, img); err != nil {
+		return err
+	}
+	fmt.Fprintf(d.out, "saved frame %d to %s\n", d.g.PPU.Frame, args[0])
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"image"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akatsuki105/dawngb/core/gb/cartridge"
+)
+
+// Pocket Camera に映す画像 path がディレクトリなら、その中のPNGを名前順に1枚ずつ映す
+func loadCameraImage(path string) (cartridge.CameraImage, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		img, err := decodeImage(path)
+		if err != nil {
+			return nil, err
+		}
+		return &cartridge.StillImage{Picture: img}, nil
+	}
+
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	seq := &cartridge.ImageSequence{}
+	for _, e := range entries { // ReadDir は名前順
+		if e.IsDir() || !strings.EqualFold(filepath.Ext(e.Name()), ".png") {
+			continue
+		}
+		img, err := decodeImage(filepath.Join(path, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		seq.Images = append(seq.Images, img)
+	}
+	if len(seq.Images) == 0 {
+		return nil, fmt.Errorf("no PNG files in %s", path)
+	}
+	return seq, nil
+}
+
+func decodeImage(path string) (image.Image, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return img, nil
+}
@@ -4,32 +4,50 @@ import (
 	"bytes"
 	"fmt"
 	"image"
+	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/akatsuki105/dawngb/core/gb"
+	"github.com/akatsuki105/dawngb/core/gb/movie"
+	"github.com/akatsuki105/dawngb/core/gb/netlink"
+	"github.com/akatsuki105/dawngb/core/gb/rewind"
+	"github.com/akatsuki105/dawngb/core/gb/romdb"
 	"github.com/hajimehoshi/ebiten/v2"
 	"golang.org/x/exp/constraints"
 )
 
 type Emu struct {
 	Core    *gb.GB
+	Rewind  *rewind.Rewinder
 	Paused  bool
 	Reset   bool
 	HasBIOS bool
+	Title   string // ウィンドウのタイトルに表示するゲーム名
 	active  bool
 
 	Snapshot struct {
 		Enabled bool
 		Data    bytes.Buffer
 	}
+
+	Movie struct {
+		Recorder *movie.Recorder
+		Player   *movie.Player
+		path     string       // 録画の保存先
+		pending  *movie.Movie // 次のリセットから再生する
+	}
+
+	Link *netlink.Link // 通信対戦の相手
 }
 
 func createEmu[V constraints.Integer](model V) *Emu {
+	core := gb.New(gb.Model(model), App.Audio)
 	return &Emu{
-		Core:  gb.New(gb.Model(model), App.Audio),
-		Reset: true,
+		Core:   core,
+		Rewind: rewind.New(core, rewind.Options{}),
+		Reset:  true,
 	}
 }
 
@@ -80,25 +98,79 @@ func (e *Emu) LoadROM(data []uint8) error {
 	if err != nil {
 		return err
 	}
+	e.Core.Cart.Camera = App.Camera
+	h := e.Core.Cart.Header
+	e.Title = h.Title
+	slog.Info("ROM loaded", "title", h.Title, "mapper", h.Mapper, "rom", h.ROMSize, "ram", h.RAMSize, "battery", h.HasBattery)
+	if err := h.Verify(); err != nil {
+		slog.Warn("The ROM may be a bad dump", "error", err)
+	}
+	if App.DB != nil {
+		e.identify(App.DB)
+	}
 	e.active = true
 	e.Reset = true
 	return nil
 }
 
+// DATと照合して、正式なゲーム名と問題のあるダンプかどうかを調べる
+func (e *Emu) identify(db *romdb.DB) {
+	m := db.Identify(e.Core.Cart.ROM)
+	if m == nil {
+		slog.Warn("The ROM is not in the DAT; it may be a hacked or bad dump", "dat", db.Name, "crc32", fmt.Sprintf("%08X", e.Core.Cart.CRC32))
+		return
+	}
+	e.Title = m.Name
+	slog.Info("ROM identified", "name", m.Name, "region", m.Region, "revision", m.Revision, "verified", m.ROM.Verified())
+	if m.ROM.BadDump() {
+		slog.Warn("The DAT lists the ROM as a bad dump", "name", m.Name)
+	}
+}
+
 func (e *Emu) Update() error {
 	if !e.Paused && e.active {
 		if e.Reset {
 			e.Reset = false
+			// 途中でリセットされたら、そこまでの入力では再現できないのでムービーを終える
+			if e.movieActive() {
+				if err := e.StopMovie(); err != nil {
+					slog.Error("Failed to save movie", "error", err)
+				}
+			}
 			e.Core.Reset()
 			if !e.HasBIOS || !App.Config.GB.Intro {
 				e.Core.DirectBoot()
 			}
+			e.Rewind.Reset()
+			e.startMovie()
 		}
 
-		for key, input := range Inputs {
-			e.Core.SetKeyInput(key, input)
+		// 押している間は1フレームずつ巻き戻す
+		if Rewinding && e.canTravel() {
+			if _, err := e.Rewind.Rewind(1); err != nil {
+				slog.Error("Failed to rewind", "error", err)
+			}
+			return nil
+		}
+
+		if e.Movie.Player != nil && !e.Movie.Player.Next() {
+			slog.Info("Movie playback finished", "frames", e.Movie.Player.Frame())
+			e.Movie.Player = nil
+		}
+		if e.Movie.Player == nil {
+			for key, input := range Inputs {
+				e.Core.SetKeyInput(key, input)
+			}
+			e.Core.SetTilt(Tilt[0], Tilt[1])
+		}
+		if e.Movie.Recorder != nil {
+			e.Movie.Recorder.Capture()
+		}
+		if err := e.Rewind.Capture(); err != nil {
+			slog.Error("Failed to record rewind state", "error", err)
 		}
 		e.Core.RunFrame()
+		vibrate(e.Core.Rumble())
 	}
 	return nil
 }
@@ -106,7 +178,7 @@ func (e *Emu) Update() error {
 func (e *Emu) Draw(screen *ebiten.Image) {
 	if !e.Paused && e.active {
 		data := e.Core.Screen()
-		w, h := 160, 144
+		w, h := e.Core.Resolution()
 		img := image.NewNRGBA(image.Rect(0, 0, w, h))
 		for y := 0; y < h; y++ {
 			for x := 0; x < w; x++ {
@@ -140,22 +212,32 @@ func (e *Emu) LoadBIOS(data []uint8) error {
 
 func (e *Emu) SaveState() bool {
 	fmt.Println("State save")
-	ok := e.Core.Serialize(&e.Snapshot.Data)
-	if ok {
-		fmt.Println("State save failed")
-		e.Snapshot.Enabled = true
+	e.Snapshot.Data.Reset()
+	if err := e.Core.SaveState(&e.Snapshot.Data, true); err != nil {
+		fmt.Println("State save failed:", err)
+		return false
 	}
-	return ok
+	e.Snapshot.Enabled = true
+	return true
 }
 
 func (e *Emu) LoadState() bool {
 	fmt.Println("State load")
+	if !e.canTravel() {
+		fmt.Println("State load is disabled while a movie or a link session is active")
+		return false
+	}
 	if e.Snapshot.Enabled {
-		ok := e.Core.Deserialize(&e.Snapshot.Data)
-		if !ok {
-			fmt.Println("State load failed")
+		if err := e.Core.LoadState(bytes.NewReader(e.Snapshot.Data.Bytes())); err != nil {
+			fmt.Println("State load failed:", err)
 			return false
 		}
+		e.Rewind.Reset()
 	}
 	return true
 }
+
+// ムービーの録画・再生中や通信中に巻き戻しやステートロードで過去に戻ると、入力の記録や相手との同期が崩れる
+func (e *Emu) canTravel() bool {
+	return !e.movieActive() && e.Link == nil
+}
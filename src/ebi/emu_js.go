@@ -49,10 +49,8 @@ func loadROM(this js.Value, args []js.Value) any {
 }
 
 func loadSave(this js.Value, args []js.Value) any {
-	sram, err := App.Emu.Core.Dump(gb.DUMP_SAVE)
-	if err == nil {
-		size := len(sram)
-		newSram := make([]uint8, size)
+	if App.Emu.Core.Cart != nil {
+		newSram := make([]uint8, args[0].Get("length").Int()) // RTCのフッタが付いている場合があるので、ファイルの大きさのまま読み込む
 		js.CopyBytesToGo(newSram, args[0])
 		App.Emu.LoadSave(newSram)
 	}
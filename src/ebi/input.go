@@ -1,6 +1,8 @@
 package main
 
 import (
+	"time"
+
 	"github.com/hajimehoshi/ebiten/v2"
 	"github.com/hajimehoshi/ebiten/v2/inpututil"
 )
@@ -38,6 +40,12 @@ var Inputs = map[string]bool{
 	"RIGHT":  false,
 }
 
+// Rキーを押している間は巻き戻す
+var Rewinding bool
+
+// MBC7の加速度センサーに送る傾き (G) 右スティックか、マウスの左ボタンを押している間は画面の中心からのカーソルの位置
+var Tilt [2]float64
+
 func Input() {
 	for key := range Inputs {
 		Inputs[key] = false
@@ -49,8 +57,10 @@ func Input() {
 	} else if inpututil.IsKeyJustPressed(ebiten.KeyF4) {
 		App.Emu.LoadState()
 	}
+	Rewinding = ebiten.IsKeyPressed(ebiten.KeyR)
 	pollKeyboard()
 	pollGamepad()
+	pollTilt()
 }
 
 func pollKeyboard() {
@@ -90,3 +100,36 @@ func pollGamepad() {
 		}
 	}
 }
+
+func pollTilt() {
+	Tilt = [2]float64{}
+	if ebiten.IsMouseButtonPressed(ebiten.MouseButtonLeft) {
+		x, y := ebiten.CursorPosition()
+		w, h := App.Emu.Core.Resolution()
+		Tilt[0] = float64(2*x-w) / float64(w)
+		Tilt[1] = float64(2*y-h) / float64(h)
+		return
+	}
+	for _, id := range ebiten.AppendGamepadIDs(nil) {
+		x := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisRightStickHorizontal)
+		y := ebiten.StandardGamepadAxisValue(id, ebiten.StandardGamepadAxisRightStickVertical)
+		if x != 0 || y != 0 {
+			Tilt = [2]float64{x, y}
+			return
+		}
+	}
+}
+
+// 振動カートリッジのモーターに合わせてゲームパッドを振動させる 毎フレーム呼ぶので、途切れないように2フレーム分振動させる
+func vibrate(strength float64) {
+	if strength <= 0 {
+		return
+	}
+	for _, id := range ebiten.AppendGamepadIDs(nil) {
+		ebiten.VibrateGamepad(id, &ebiten.VibrateGamepadOptions{
+			Duration:        2 * time.Second / 60,
+			StrongMagnitude: strength,
+			WeakMagnitude:   strength,
+		})
+	}
+}
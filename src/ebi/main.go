@@ -10,6 +10,9 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/akatsuki105/dawngb/core/gb/cartridge"
+	"github.com/akatsuki105/dawngb/core/gb/gdbserver"
+	"github.com/akatsuki105/dawngb/core/gb/romdb"
 	"github.com/akatsuki105/dawngb/src/config"
 	"github.com/hajimehoshi/ebiten/v2"
 )
@@ -30,6 +33,8 @@ type AppState struct {
 	Emu     *Emu
 	Audio   *AudioManager
 	Logger  *slog.Logger
+	DB      *romdb.DB // nil なら -dat が指定されていない
+	Camera  cartridge.CameraImage
 }
 
 var App = AppState{
@@ -37,6 +42,17 @@ var App = AppState{
 	Config: config.DefaultConfig,
 }
 
+var (
+	gdbAddr    = flag.String("gdb", "", "Listen for GDB remote connections on this address. (e.g. :1234)")
+	recordPath = flag.String("record", "", "Record the inputs from power-on to this movie file.")
+	playPath   = flag.String("play", "", "Play back this movie file. BizHawk .bk2 files are also accepted.")
+	linkAddr   = flag.String("link", "", "Connect the link cable to another DawnGB over TCP. Wait for the peer with :PORT, or connect to it with HOST:PORT.")
+	printerDir = flag.String("printer", "", "Connect the Game Boy Printer and save the prints as PNG in this directory.")
+	cameraPath = flag.String("camera", "", "Show this PNG file, or the PNG files in this directory one by one, to the Pocket Camera. A test pattern is shown by default.")
+	datPaths   = flag.String("dat", "", "Identify ROMs with these No-Intro DAT files (XML or ClrMamePro), separated by the OS path list separator.")
+	gamesPath  = flag.String("games", "", `Per-game settings in JSON, keyed by the game name in the DAT. Needs -dat. (e.g. {"Tetris (World) (Rev 1)": {"Model": 0}})`)
+)
+
 func main() {
 	os.Exit(int(Run()))
 }
@@ -49,7 +65,41 @@ func Run() ExitCode {
 	App.Audio = NewAudioManager()
 	defer App.Audio.Close()
 
-	App.Emu = createEmu(App.Config.GB.Model)
+	if *datPaths != "" {
+		db, err := romdb.Open(filepath.SplitList(*datPaths)...)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitCodeError
+		}
+		App.DB = db
+	}
+	if *gamesPath != "" {
+		games, err := config.LoadGames(*gamesPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitCodeError
+		}
+		App.Config.Games = games
+	}
+
+	App.Emu = createEmu(App.model(flag.Arg(0)))
+	if *cameraPath != "" {
+		img, err := loadCameraImage(*cameraPath)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitCodeError
+		}
+		App.Camera = img
+	}
+
+	if *gdbAddr != "" {
+		server := gdbserver.New(App.Emu.Core)
+		go func() {
+			if err := server.ListenAndServe(*gdbAddr); err != nil {
+				slog.Error("GDB server stopped", "error", err)
+			}
+		}()
+	}
 
 	if flag.NArg() > 0 {
 		err := App.Emu.LoadROMFromPath(flag.Arg(0))
@@ -59,17 +109,46 @@ func Run() ExitCode {
 		}
 	}
 
+	// ムービーはROMを読み込んだ後でないとハッシュを確認できない
+	if *playPath != "" {
+		if err := App.Emu.PlayMovie(*playPath); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitCodeError
+		}
+	} else if *recordPath != "" {
+		App.Emu.RecordMovie(*recordPath)
+	}
+
+	if *linkAddr != "" && *printerDir != "" {
+		fmt.Fprintln(os.Stderr, "-link and -printer cannot be used at the same time")
+		return ExitCodeError
+	}
+	if *printerDir != "" {
+		App.Emu.ConnectPrinter(*printerDir)
+	}
+	if *linkAddr != "" {
+		if err := App.Emu.ConnectLink(*linkAddr); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitCodeError
+		}
+		defer App.Emu.Link.Close()
+	}
+
 	ebiten.SetTPS(60)
 	ebiten.SetWindowTitle(fmt.Sprintf("%s - 60.0 FPS", App.Name))
 	ebiten.SetScreenClearedEveryFrame(false)
 
 	{
 		f := ebiten.Monitor().DeviceScaleFactor()
-		w, h := float64(160)*f, float64(144)*f
-		ebiten.SetWindowSize(int(w), int(h))
+		w, h := App.Emu.Core.Resolution()
+		ebiten.SetWindowSize(int(float64(w)*f), int(float64(h)*f))
 	}
 
-	if err := ebiten.RunGame(&App); err != nil {
+	err := ebiten.RunGame(&App)
+	if err := App.Emu.StopMovie(); err != nil {
+		fmt.Fprintln(os.Stderr, "Failed to save movie:", err)
+	}
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return ExitCodeError
 	}
@@ -77,6 +156,27 @@ func Run() ExitCode {
 	return ExitCodeOK
 }
 
+// ROMのモデルを返す ゲームごとの設定は、DATで照合できたROMにだけ使う
+// モデルは起動後に変えられないので、ドロップされたROMには使わない
+func (app *AppState) model(path string) uint8 {
+	if app.DB == nil || path == "" {
+		return app.Config.GB.Model
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return app.Config.GB.Model // エラーは LoadROMFromPath で返す
+	}
+	m := app.DB.Identify(data)
+	if m == nil {
+		return app.Config.GB.Model
+	}
+	model := app.Config.Model(m.Name)
+	if model != app.Config.GB.Model {
+		slog.Info("Per-game model", "name", m.Name, "model", model)
+	}
+	return model
+}
+
 func (app *AppState) Update() error {
 	if app.Config.Audio.Enable {
 		app.Audio.Update()
@@ -93,6 +193,9 @@ func (app *AppState) Update() error {
 	if app.Counter&0xFF == 0 {
 		fps := ebiten.ActualTPS()
 		title := fmt.Sprintf("%s - %.1f FPS", app.Name, fps)
+		if app.Emu.Title != "" {
+			title = fmt.Sprintf("%s - %s - %.1f FPS", app.Name, app.Emu.Title, fps)
+		}
 		ebiten.SetWindowTitle(title)
 	}
 	return nil
@@ -103,7 +206,9 @@ func (app *AppState) Draw(screen *ebiten.Image) {
 }
 
 // 引数にウィンドウサイズをとり、画面の解像度を返す
-func (app *AppState) Layout(_, _ int) (screenWidth, screenHeight int) { return 160, 144 }
+func (app *AppState) Layout(_, _ int) (screenWidth, screenHeight int) {
+	return app.Emu.Core.Resolution()
+}
 
 func (app *AppState) initLogger() {
 	cfg := &app.Config.Logger
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akatsuki105/dawngb/core/gb/movie"
+)
+
+// 次のリセット(電源投入)から録画・再生を始める
+func (e *Emu) RecordMovie(path string) {
+	e.Movie.path = path
+}
+
+// .bk2 は BizHawk のムービーとして読み込む
+func (e *Emu) PlayMovie(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var m *movie.Movie
+	if strings.EqualFold(filepath.Ext(path), ".bk2") {
+		m, err = movie.ImportBK2(bytes.NewReader(data), int64(len(data)), e.Core)
+	} else {
+		m, err = movie.Read(bytes.NewReader(data))
+	}
+	if err != nil {
+		return err
+	}
+	e.Movie.pending = m
+	return nil
+}
+
+func (e *Emu) startMovie() {
+	var err error
+	switch {
+	case e.Movie.pending != nil:
+		e.Movie.Player, err = movie.NewPlayer(e.Core, e.Movie.pending)
+		e.Movie.pending = nil
+		if err == nil {
+			slog.Info("Movie playback started")
+		}
+	case e.Movie.path != "" && e.Movie.Recorder == nil:
+		e.Movie.Recorder, err = movie.NewRecorder(e.Core, false)
+		if err == nil {
+			slog.Info("Movie recording started", "path", e.Movie.path)
+		}
+	}
+	if err != nil {
+		slog.Error("Failed to start movie", "error", err)
+	}
+}
+
+// 録画中ならファイルに書き出す
+func (e *Emu) StopMovie() error {
+	e.Movie.Player = nil
+	if e.Movie.Recorder == nil {
+		return nil
+	}
+	m, path := e.Movie.Recorder.Movie(), e.Movie.path
+	e.Movie.Recorder, e.Movie.path = nil, ""
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := m.Write(f); err != nil {
+		return err
+	}
+	slog.Info("Movie saved", "path", path, "frames", m.Frames())
+	return nil
+}
+
+func (e *Emu) movieActive() bool {
+	return e.Movie.Recorder != nil || e.Movie.Player != nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"image"
+	"log/slog"
+	"net"
+
+	"github.com/akatsuki105/dawngb/core/gb/netlink"
+	"github.com/akatsuki105/dawngb/core/gb/printer"
+)
+
+// ホスト名を省略したら相手の接続を待つ
+func (e *Emu) ConnectLink(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+
+	var l *netlink.Link
+	if host == "" {
+		slog.Info("Waiting for link peer", "addr", addr)
+		l, err = netlink.Listen(addr, e.Core, netlink.Options{})
+	} else {
+		l, err = netlink.Dial(addr, e.Core, netlink.Options{})
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("Link connected", "peer", l.RemoteAddr())
+
+	l.OnError = func(err error) {
+		slog.Error("Link disconnected", "error", err)
+		e.Link = nil
+	}
+	e.Link = l
+	e.Reset = true // 両方とも電源投入から始める
+	return nil
+}
+
+// 印刷されたものは dir にPNGで保存する
+func (e *Emu) ConnectPrinter(dir string) {
+	p := printer.New()
+	p.OnPrint = func(img image.Image) {
+		path, err := printer.WritePNG(dir, img)
+		if err != nil {
+			slog.Error("Failed to save print", "error", err)
+			return
+		}
+		slog.Info("Printed", "path", path)
+	}
+	e.Core.CPU.Serial.Connect(p)
+}
@@ -28,4 +28,13 @@ static retro_input_state_t input_state_cb;
 static void _retro_set_input_state(retro_input_state_t cb) { input_state_cb = cb; }
 static int16_t call_input_state_cb(unsigned port, unsigned device, unsigned index, unsigned id) { return input_state_cb(port, device, index, id); }
 
+static struct retro_rumble_interface rumble;
+static bool get_rumble_interface(void) { return environ_cb(RETRO_ENVIRONMENT_GET_RUMBLE_INTERFACE, &rumble); }
+static void call_set_rumble_state(unsigned port, uint16_t strength) {
+  if (rumble.set_rumble_state) {
+    rumble.set_rumble_state(port, RETRO_RUMBLE_STRONG, strength);
+    rumble.set_rumble_state(port, RETRO_RUMBLE_WEAK, strength);
+  }
+}
+
 #endif  // DAWNGB_CFUNCS
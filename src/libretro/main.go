@@ -3,6 +3,7 @@ package main
 /*
 // libretro.h で RETRO_API がついてる宣言のコメントアウトが必要
 // https://github.com/libretro/RetroArch/blob/b443d9974a179ee45c0e5e913b9842c397998193/libretro-common/include/libretro.h
+#include <stdlib.h>
 #include "libretro.h"
 #include "cfuncs.h"
 #include "input.h"
@@ -17,6 +18,8 @@ import (
 	"unsafe"
 
 	"github.com/akatsuki105/dawngb/core/gb"
+	"github.com/akatsuki105/dawngb/core/gb/romdb"
+	"github.com/akatsuki105/dawngb/src/config"
 )
 
 const AUDIO_BUFFER_SIZE = 4096
@@ -31,6 +34,12 @@ const (
 	CGB_BIOS = "cgb_boot.bin"
 )
 
+// システムディレクトリに置かれていれば、ROMの照合に使う
+var datFiles = []string{"Nintendo - Game Boy.dat", "Nintendo - Game Boy Color.dat"}
+
+// システムディレクトリに置かれていれば、ゲームごとの設定に使う (キーはDATのゲーム名)
+const GAMES_FILE = "dawngb_games.json"
+
 var (
 	useBitmasks bool // この機能が有効な場合、入力は(libretro側で規定された)ビットマスクとして一括取得ができる(falseなら、ボタン1つずつ取得する必要がある)
 	keymap      = []uint{
@@ -70,6 +79,8 @@ type AppState struct {
 	}
 	SaveStateBuffer []uint8
 	SaveStateSize   int
+	DB              *romdb.DB // DATが無ければ nil
+	Games           map[string]config.Game
 }
 
 var app AppState = AppState{
@@ -135,6 +146,7 @@ func retro_init() {
 	// Input
 	{
 		useBitmasks = bool(C.call_environ_cb(C.RETRO_ENVIRONMENT_GET_INPUT_BITMASKS, nil))
+		C.get_rumble_interface()
 		// C.call_environ_cb(C.RETRO_ENVIRONMENT_SET_CONTROLLER_INFO, unsafe.Pointer(&C.ports[0]))
 		// C.call_environ_cb(C.RETRO_ENVIRONMENT_SET_INPUT_DESCRIPTORS, unsafe.Pointer(&C.descriptors_1p[0]))
 	}
@@ -153,9 +165,60 @@ func retro_init() {
 		}
 	}
 
+	// check DAT
+	app.DB = nil
+	if app.SystemDir != "./" {
+		var paths []string
+		for _, name := range datFiles {
+			if path := filepath.Join(app.SystemDir, name); fileExists(path) {
+				paths = append(paths, path)
+			}
+		}
+		if len(paths) > 0 {
+			if db, err := romdb.Open(paths...); err == nil {
+				app.DB = db
+			}
+		}
+	}
+	app.Games = nil
+	if app.SystemDir != "./" {
+		if games, err := config.LoadGames(filepath.Join(app.SystemDir, GAMES_FILE)); err == nil {
+			app.Games = games
+		}
+	}
+
 	app.Screen = make([]uint16, WIDTH*HEIGHT)
 }
 
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// DATと照合して、ゲーム名か問題のあるダンプかどうかをフロントエンドに表示する
+func identifyROM(rom []uint8) *romdb.Match {
+	if app.DB == nil {
+		return nil
+	}
+	m := app.DB.Identify(rom)
+	msg := ""
+	switch {
+	case m == nil:
+		msg = "DawnGB: The ROM is not in the DAT. It may be a hacked or bad dump."
+	case m.ROM.BadDump():
+		msg = "DawnGB: " + m.Name + " is a known bad dump."
+	case m.ROM.Verified():
+		msg = "DawnGB: " + m.Name + " (verified)"
+	default:
+		msg = "DawnGB: " + m.Name
+	}
+	cMsg := C.CString(msg)
+	defer C.free(unsafe.Pointer(cMsg))
+	cm := C.struct_retro_message{msg: cMsg, frames: 300}
+	C.call_environ_cb(C.RETRO_ENVIRONMENT_SET_MESSAGE, unsafe.Pointer(&cm))
+	return m
+}
+
 //export retro_deinit
 func retro_deinit() {
 	retro_unload_game()
@@ -229,10 +292,16 @@ func pollInput() {
 		pressed := (joypads>>keymap[i])&1 == 1
 		app.GB.SetKeyInput(keymapNames[keymap[i]], pressed)
 	}
+
+	// 右スティックでMBC7の加速度センサーを傾ける
+	x := C.call_input_state_cb(0, C.RETRO_DEVICE_ANALOG, C.RETRO_DEVICE_INDEX_ANALOG_RIGHT, C.RETRO_DEVICE_ID_ANALOG_X)
+	y := C.call_input_state_cb(0, C.RETRO_DEVICE_ANALOG, C.RETRO_DEVICE_INDEX_ANALOG_RIGHT, C.RETRO_DEVICE_ID_ANALOG_Y)
+	app.GB.SetTilt(float64(x)/0x8000, float64(y)/0x8000)
 }
 
 func update() {
 	app.GB.RunFrame()
+	C.call_set_rumble_state(0, C.uint16_t(app.GB.Rumble()*0xFFFF))
 	n, err := app.SampleBuffer.Read(app.Samples[:])
 	if err == nil && n >= 4 {
 		C.call_audio_batch_cb((*C.int16_t)(unsafe.Pointer(&app.Samples[0])), C.ulong(n/4))
@@ -310,24 +379,26 @@ func retro_load_game(info *C.struct_retro_game_info) C.bool {
 	}
 	app.ROM = data
 
-	intro := false
+	model, intro := gb.MODEL_CGB, false
 	if app.BIOS.exists {
 		if app.BIOS.isCGB {
-			app.GB = gb.New(gb.MODEL_CGB, app.SampleBuffer)
-			app.GB.Load(gb.LOAD_BIOS, app.BIOS.data)
 			intro = true
-		} else {
-			ext := filepath.Ext(romPath)
-			if ext == ".gbc" {
-				app.GB = gb.New(gb.MODEL_CGB, app.SampleBuffer) // DMGのBIOSしかない場合は、CGBでダイレクトに起動
-			} else {
-				app.GB = gb.New(gb.MODEL_DMG, app.SampleBuffer)
-				app.GB.Load(gb.LOAD_BIOS, app.BIOS.data)
-				intro = true
-			}
+		} else if filepath.Ext(romPath) != ".gbc" { // DMGのBIOSしかない場合は、.gbc はCGBでダイレクトに起動
+			model, intro = gb.MODEL_DMG, true
 		}
-	} else {
-		app.GB = gb.New(gb.MODEL_CGB, app.SampleBuffer)
+	}
+
+	// ゲームごとの設定でモデルを変える BIOSはモデルに合うときだけ使う
+	if m := identifyROM(app.ROM); m != nil {
+		if g, ok := app.Games[m.Name]; ok && g.Model != nil {
+			model = gb.Model(*g.Model)
+			intro = app.BIOS.exists && app.BIOS.isCGB == (model == gb.MODEL_CGB) && model != gb.MODEL_SGB
+		}
+	}
+
+	app.GB = gb.New(model, app.SampleBuffer)
+	if intro {
+		app.GB.Load(gb.LOAD_BIOS, app.BIOS.data)
 	}
 
 	if err := app.GB.Load(gb.LOAD_ROM, app.ROM); err != nil {
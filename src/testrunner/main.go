@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+)
+
+// ExitCode represents program's status code
+type ExitCode int
+
+// exit code
+const (
+	ExitCodeOK ExitCode = iota
+	ExitCodeError
+	ExitCodeFailed // 1つ以上のROMがPASSしなかった
+)
+
+var (
+	model    = flag.String("model", "cgb", "Hardware model. (dmg, cgb)")
+	biosPath = flag.String("bios", "", "Path to boot ROM. If empty, boot directly.")
+	frames   = flag.Int("frames", 60*60, "Max frames to run each ROM.")
+	cycles   = flag.Int64("cycles", 0, "Max master cycles(8MHz) to run each ROM. 0 means unlimited.")
+	mode     = flag.String("mode", "auto", "Pass/fail detection. (auto, serial, mooneye, screen)")
+	refDir   = flag.String("ref", "", "Directory of reference PNGs for screen mode. If empty, look for <ROM name>.png next to the ROM.")
+	dumpDir  = flag.String("dump", "", "Directory to write the last screen of each ROM as PNG.")
+	jsonPath = flag.String("json", "", "Write results as JSON to this path. (\"-\" for stdout)")
+	jobs     = flag.Int("j", runtime.NumCPU(), "Number of ROMs to run in parallel.")
+
+	traceDir        = flag.String("trace", "", "Directory to write instruction traces in Gameboy Doctor format as <ROM name>.log.")
+	traceStartFrame = flag.Uint64("trace-start-frame", 0, "Start tracing at this frame.")
+	traceStopFrame  = flag.Uint64("trace-stop-frame", 0, "Stop tracing at this frame. 0 means no limit.")
+	traceStartPC    = flag.String("trace-start-pc", "", "Start tracing when PC reaches this address. (hex)")
+	traceStopPC     = flag.String("trace-stop-pc", "", "Stop tracing when PC reaches this address. (hex)")
+	traceMax        = flag.Int64("trace-max", 0, "Max size of each trace log in bytes. 0 means unlimited.")
+)
+
+func main() {
+	os.Exit(int(run()))
+}
+
+func run() ExitCode {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		fmt.Fprintln(os.Stderr, "usage: testrunner [flags] ROM_DIR_OR_FILE...")
+		flag.PrintDefaults()
+		return ExitCodeError
+	}
+
+	opts, err := newOptions()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitCodeError
+	}
+
+	if *traceDir != "" {
+		if err := os.MkdirAll(*traceDir, 0o755); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitCodeError
+		}
+	}
+
+	roms, err := collectROMs(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return ExitCodeError
+	}
+	if len(roms) == 0 {
+		fmt.Fprintln(os.Stderr, "no ROM found")
+		return ExitCodeError
+	}
+
+	results := runAll(roms, opts, max(*jobs, 1))
+
+	if *jsonPath != "-" {
+		printTable(os.Stdout, results)
+	}
+	if *jsonPath != "" {
+		if err := writeJSON(*jsonPath, results); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return ExitCodeError
+		}
+	}
+
+	for _, r := range results {
+		if r.Status != StatusPass {
+			return ExitCodeFailed
+		}
+	}
+	return ExitCodeOK
+}
+
+// ディレクトリが渡された場合は再帰的に .gb, .gbc を探す
+func collectROMs(paths []string) ([]string, error) {
+	roms := []string{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+		if !info.IsDir() {
+			roms = append(roms, path)
+			continue
+		}
+
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			switch strings.ToLower(filepath.Ext(p)) {
+			case ".gb", ".gbc":
+				if !d.IsDir() {
+					roms = append(roms, p)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(roms)
+	return roms, nil
+}
+
+func runAll(roms []string, opts *options, n int) []Result {
+	results := make([]Result, len(roms))
+	queue := make(chan int)
+
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range queue {
+				results[i] = runROM(roms[i], opts)
+			}
+		}()
+	}
+	for i := range roms {
+		queue <- i
+	}
+	close(queue)
+	wg.Wait()
+
+	return results
+}
+
+func printTable(w io.Writer, results []Result) {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROM\tRESULT\tMODE\tFRAMES\tDETAIL")
+	passed := 0
+	for _, r := range results {
+		if r.Status == StatusPass {
+			passed++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\n", r.ROM, strings.ToUpper(string(r.Status)), r.Mode, r.Frames, r.Detail)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\n%d/%d passed\n", passed, len(results))
+}
+
+func writeJSON(path string, results []Result) error {
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if path == "-" {
+		_, err = os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
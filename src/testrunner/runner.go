@@ -0,0 +1,246 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+	"github.com/akatsuki105/dawngb/core/gb/cpu"
+)
+
+type Status string
+
+const (
+	StatusPass    Status = "pass"
+	StatusFail    Status = "fail"
+	StatusTimeout Status = "timeout" // 予算内に判定がつかなかった
+	StatusError   Status = "error"   // ROMの読み込みに失敗したなど
+)
+
+// 判定方法
+const (
+	modeAuto    = "auto"
+	modeSerial  = "serial"  // Blargg: シリアル出力に "Passed" / "Failed" が出るか
+	modeMooneye = "mooneye" // Mooneye: LD B,B を実行したときのレジスタがフィボナッチ数列になっているか
+	modeScreen  = "screen"  // 最後の画面がリファレンスのPNGと一致するか
+)
+
+type Result struct {
+	ROM        string `json:"rom"`
+	Status     Status `json:"status"`
+	Mode       string `json:"mode"`
+	Frames     int    `json:"frames"`
+	Cycles     int64  `json:"cycles"`
+	Serial     string `json:"serial,omitempty"`
+	ScreenHash string `json:"screen_hash,omitempty"`
+	Detail     string `json:"detail,omitempty"`
+}
+
+type options struct {
+	model gb.Model
+	bios  []uint8
+	trace cpu.TraceOptions
+}
+
+func newOptions() (*options, error) {
+	opts := &options{}
+	switch strings.ToLower(*model) {
+	case "dmg":
+		opts.model = gb.MODEL_DMG
+	case "cgb":
+		opts.model = gb.MODEL_CGB
+	default:
+		return nil, fmt.Errorf("unknown model: %s", *model)
+	}
+
+	switch *mode {
+	case modeAuto, modeSerial, modeMooneye, modeScreen:
+	default:
+		return nil, fmt.Errorf("unknown mode: %s", *mode)
+	}
+
+	startPC, err := parsePC(*traceStartPC)
+	if err != nil {
+		return nil, err
+	}
+	stopPC, err := parsePC(*traceStopPC)
+	if err != nil {
+		return nil, err
+	}
+	opts.trace = cpu.TraceOptions{
+		StartFrame: *traceStartFrame,
+		StopFrame:  *traceStopFrame,
+		StartPC:    startPC,
+		StopPC:     stopPC,
+		MaxBytes:   *traceMax,
+	}
+
+	if *biosPath != "" {
+		bios, err := os.ReadFile(*biosPath)
+		if err != nil {
+			return nil, err
+		}
+		opts.bios = bios
+	}
+	return opts, nil
+}
+
+// "0150" や "0x0150" をパースする(空文字列なら無効)
+func parsePC(s string) (int, error) {
+	if s == "" {
+		return cpu.NoPC, nil
+	}
+	val, err := strconv.ParseUint(strings.TrimPrefix(strings.ToLower(s), "0x"), 16, 16)
+	if err != nil {
+		return cpu.NoPC, fmt.Errorf("invalid PC: %s", s)
+	}
+	return int(val), nil
+}
+
+// probe はデバッガフックを使ってテストROMの終了を検出する
+type probe struct {
+	g       *gb.GB
+	serial  []uint8
+	verdict Status
+	mode    string
+}
+
+func (p *probe) ReadMemoryHook(memory uint32, addr uint64, width int) {}
+func (p *probe) PrintLog(message string)                              {}
+
+func (p *probe) WriteMemoryHook(memory uint32, addr uint64, width int, data uint64) {
+	if *mode != modeAuto && *mode != modeSerial {
+		return
+	}
+
+	// SCに0x81(内部クロックで転送開始)が書き込まれた時点のSBが送信されるバイト
+	if addr == 0xFF02 && (data&0x81) == 0x81 {
+		p.serial = append(p.serial, p.g.CPU.Serial.SB)
+		out := string(p.serial)
+		switch {
+		case strings.Contains(out, "Passed"):
+			p.verdict, p.mode = StatusPass, modeSerial
+		case strings.Contains(out, "Failed"):
+			p.verdict, p.mode = StatusFail, modeSerial
+		}
+	}
+}
+
+func (p *probe) InstructionHook(id int, pc uint64) {
+	if *mode != modeAuto && *mode != modeMooneye {
+		return
+	}
+
+	if p.g.ViewMemory(0, uint32(pc), 1) != 0x40 { // LD B,B
+		return
+	}
+
+	r := &p.g.CPU.R
+	b, c, d, e, h, l := r.BC.Hi, r.BC.Lo, r.DE.Hi, r.DE.Lo, r.HL.Hi, r.HL.Lo
+	switch {
+	case b == 3 && c == 5 && d == 8 && e == 13 && h == 21 && l == 34:
+		p.verdict, p.mode = StatusPass, modeMooneye
+	case b == 0x42 && c == 0x42 && d == 0x42 && e == 0x42 && h == 0x42 && l == 0x42:
+		p.verdict, p.mode = StatusFail, modeMooneye
+	}
+}
+
+func runROM(path string, opts *options) Result {
+	result := Result{ROM: path, Mode: *mode}
+
+	rom, err := os.ReadFile(path)
+	if err != nil {
+		result.Status, result.Detail = StatusError, err.Error()
+		return result
+	}
+
+	g := gb.New(opts.model, nil)
+	if opts.bios != nil {
+		if err := g.Load(gb.LOAD_BIOS, opts.bios); err != nil {
+			result.Status, result.Detail = StatusError, err.Error()
+			return result
+		}
+	}
+	if err := g.Load(gb.LOAD_ROM, rom); err != nil {
+		result.Status, result.Detail = StatusError, err.Error()
+		return result
+	}
+	g.Reset()
+	if opts.bios == nil {
+		g.DirectBoot()
+	}
+
+	p := &probe{g: g}
+	g.AttachDebugger(p)
+
+	if *traceDir != "" {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".log"
+		f, err := os.Create(filepath.Join(*traceDir, name))
+		if err != nil {
+			result.Status, result.Detail = StatusError, err.Error()
+			return result
+		}
+		defer f.Close()
+		w := bufio.NewWriter(f)
+		defer w.Flush()
+		g.AttachTracer(w, opts.trace)
+	}
+
+	for result.Frames < *frames && (*cycles == 0 || g.CPU.Cycles < *cycles) && p.verdict == "" {
+		g.RunFrame()
+		result.Frames++
+	}
+	result.Cycles = g.CPU.Cycles
+	result.Serial = string(p.serial)
+
+	screen := newScreenImage(g)
+	result.ScreenHash = hashScreen(screen)
+	if *dumpDir != "" {
+		name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path)) + ".png"
+		if err := writePNG(filepath.Join(*dumpDir, name), screen); err != nil {
+			result.Status, result.Detail = StatusError, err.Error()
+			return result
+		}
+	}
+
+	if p.verdict != "" {
+		result.Status, result.Mode = p.verdict, p.mode
+		result.Detail = lastLine(result.Serial)
+		return result
+	}
+
+	if *mode == modeAuto || *mode == modeScreen {
+		ref, ok := findReference(path)
+		if ok {
+			result.Mode = modeScreen
+			match, err := compareScreen(screen, ref)
+			switch {
+			case err != nil:
+				result.Status, result.Detail = StatusError, err.Error()
+			case match:
+				result.Status, result.Detail = StatusPass, filepath.Base(ref)
+			default:
+				result.Status, result.Detail = StatusFail, "screen mismatch: "+filepath.Base(ref)
+			}
+			return result
+		}
+		if *mode == modeScreen {
+			result.Status, result.Detail = StatusError, "reference PNG not found"
+			return result
+		}
+	}
+
+	result.Status = StatusTimeout
+	result.Detail = lastLine(result.Serial)
+	return result
+}
+
+// シリアル出力の最後の空でない行を返す(テーブルに表示するため)
+func lastLine(s string) string {
+	lines := strings.Split(strings.TrimSpace(s), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
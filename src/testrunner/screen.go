@@ -0,0 +1,88 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/akatsuki105/dawngb/core/gb"
+)
+
+func newScreenImage(g *gb.GB) *image.NRGBA {
+	w, h := g.Resolution()
+	img := image.NewNRGBA(image.Rect(0, 0, w, h))
+	data := g.Screen()
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.SetNRGBA(x, y, data[y*w+x])
+		}
+	}
+	return img
+}
+
+// RGBのみをハッシュする(アルファは常に0xFFなので無視)
+func hashScreen(img *image.NRGBA) string {
+	h := sha1.New()
+	for i := 0; i < len(img.Pix); i += 4 {
+		h.Write(img.Pix[i : i+3])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return png.Encode(f, img)
+}
+
+func findReference(romPath string) (string, bool) {
+	name := strings.TrimSuffix(filepath.Base(romPath), filepath.Ext(romPath)) + ".png"
+	dir := filepath.Dir(romPath)
+	if *refDir != "" {
+		dir = *refDir
+	}
+	path := filepath.Join(dir, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", false
+	}
+	return path, true
+}
+
+func compareScreen(screen *image.NRGBA, refPath string) (bool, error) {
+	f, err := os.Open(refPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	ref, err := png.Decode(f)
+	if err != nil {
+		return false, fmt.Errorf("%s: %w", refPath, err)
+	}
+	if ref.Bounds().Size() != screen.Bounds().Size() {
+		return false, nil
+	}
+
+	min := ref.Bounds().Min
+	for y := 0; y < screen.Rect.Dy(); y++ {
+		for x := 0; x < screen.Rect.Dx(); x++ {
+			r0, g0, b0, _ := screen.At(x, y).RGBA()
+			r1, g1, b1, _ := ref.At(min.X+x, min.Y+y).RGBA()
+			if (r0>>8) != (r1>>8) || (g0>>8) != (g1>>8) || (b0>>8) != (b1>>8) {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
+}